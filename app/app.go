@@ -0,0 +1,318 @@
+// Package app assembles the blog API from its configuration. An App holds
+// every dependency of the handlers instead of package state, so several can
+// run in one process and other services can mount the blog handler in their
+// own server.
+package app
+
+import (
+	"blogklert/breaker"
+	"blogklert/cache"
+	"blogklert/controllers"
+	"blogklert/db"
+	"blogklert/middlewares"
+	"blogklert/outbox"
+	"blogklert/routes"
+	"blogklert/store"
+	"blogklert/webhooks"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+)
+
+// Options override the dependencies an App builds from its configuration.
+type Options struct {
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+	// Clock defaults to the system clock.
+	Clock func() time.Time
+	// DB is used instead of opening Config.DBURL. The App does not close it.
+	DB *sql.DB
+	// Driver is the database driver of DB, by default the one selected by
+	// the scheme of Config.DBURL.
+	Driver string
+	// Store replaces the Postgres post store. Changes only reach the event
+	// stream and webhooks if it records them in the outbox of DB.
+	Store store.PostStore
+}
+
+// App is an assembled instance of the blog API.
+type App struct {
+	Config *db.Config
+	// DB holds the posts and, on Postgres, the webhooks and outbox.
+	DB *sql.DB
+	// Driver is the database driver of DB, db.Postgres or db.SQLite.
+	Driver string
+	Store  store.PostStore
+	// Redis and RedisBreaker are nil when Redis is not configured.
+	Redis        *redis.Client
+	RedisBreaker *breaker.Breaker
+	Cache        cache.Cache
+	Logger       *log.Logger
+	Clock        func() time.Time
+
+	handlers *controllers.Handlers
+	handler  http.Handler
+	ownsDB   bool
+	// replicas are the read replica connections, balanced by replicated.
+	replicas   []*sql.DB
+	replicated *store.Replicated
+	// stop ends the background work started by New.
+	stop context.CancelFunc
+}
+
+// New connects to the databases named by config and builds the handlers.
+// Call Run to process background work and Close to release the connections.
+func New(ctx context.Context, config *db.Config, opts Options) (*App, error) {
+	a := &App{Config: config, DB: opts.DB, Driver: opts.Driver, Store: opts.Store, Logger: opts.Logger, Clock: opts.Clock}
+	if a.Logger == nil {
+		a.Logger = log.Default()
+	}
+	if a.Clock == nil {
+		a.Clock = time.Now
+	}
+	if a.Driver == "" {
+		a.Driver = db.Driver(config.DBURL)
+	}
+
+	policies, err := postPolicies(config.Sanitize)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.DB == nil {
+		a.DB, err = db.OpenDB(ctx, config.DBURL)
+		if err != nil {
+			return nil, err
+		}
+		a.ownsDB = true
+	}
+	if a.Store == nil {
+		a.Store = newPostStore(a.DB, a.Driver, a.Clock)
+	}
+
+	// Spread reads over the replicas that keep up with the primary
+	if len(config.Replicas.URLs) > 0 {
+		if a.Driver != db.Postgres {
+			a.Close()
+			return nil, fmt.Errorf("read replicas require Postgres, not %s", a.Driver)
+		}
+		a.replicas, err = db.OpenReplicas(config.Replicas.URLs)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		replicas := make([]store.ReplicaStore, len(a.replicas))
+		for i, conn := range a.replicas {
+			replicas[i] = store.NewPostgres(conn, nil)
+		}
+		a.replicated = store.NewReplicated(a.Store, replicas, config.Replicas.MaxLag)
+		a.replicated.Check(ctx)
+		a.Store = a.replicated
+	}
+
+	// Redis is optional: without it posts are read straight from the store
+	// and the event stream is unavailable
+	a.Redis, a.RedisBreaker, err = db.OpenRedis(ctx, config.Redis)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to initialize Redis: %w", err)
+	}
+
+	background, stop := context.WithCancel(context.Background())
+	a.stop = stop
+	var locker cache.Locker
+	a.Cache, locker = newPostCache(background, a.Redis, config.Cache)
+
+	a.handlers = controllers.New(controllers.Deps{
+		Posts: controllers.PostConfig{
+			Store:          a.Store,
+			Policies:       policies,
+			RequireIfMatch: config.RequireIfMatch,
+			HTTPCache:      controllers.HTTPCacheConfig(config.HTTPCache),
+			IdempotencyTTL: config.IdempotencyTTL,
+			Cache:          a.Cache,
+			CacheLoader:    &cache.Loader{Cache: a.Cache, Locker: locker, LockTTL: config.Cache.LockTTL},
+			CacheTTL: controllers.CacheTTLConfig{
+				List:   config.Cache.ListTTL,
+				Detail: config.Cache.DetailTTL,
+				Stale:  config.Cache.StaleTTL,
+			},
+		},
+		Events:               controllers.EventsConfig(config.Events),
+		AllowPrivateWebhooks: config.AllowPrivateWebhooks,
+		DB:                   a.DB,
+		Driver:               a.Driver,
+		Redis:                a.Redis,
+		RedisBreaker:         a.RedisBreaker,
+		Logger:               a.Logger,
+		Clock:                a.Clock,
+		Background:           background,
+	})
+
+	a.handler, err = routes.SetupRoutes(config, a.handlers)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to set up routes: %w", err)
+	}
+	return a, nil
+}
+
+// Handler serves the REST, GraphQL and event stream APIs, the metrics and
+// the health check.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// GRPCServer returns a new gRPC server exposing PostService.
+func (a *App) GRPCServer() *grpc.Server {
+	return routes.SetupGRPCServer(a.Config, a.handlers)
+}
+
+// Migrate applies pending migrations and, when any was applied, flushes the
+// data cached under the previous schema.
+func (a *App) Migrate(ctx context.Context) error {
+	migrated, err := db.Migrate(ctx, a.DB, a.Driver)
+	if err != nil {
+		return err
+	}
+	if flusher, ok := a.Cache.(*cache.Namespace); ok && migrated {
+		version, err := flusher.Flush(ctx)
+		if err != nil {
+			a.Logger.Printf("failed to flush the cache after migrating: %v", err)
+		} else {
+			a.Logger.Printf("cache flushed after migrating: namespace version %d", version)
+		}
+	}
+	return nil
+}
+
+// Run retries Redis while it is down, checks the lag of read replicas,
+// relays outbox events and delivers queued webhooks until ctx is done. Only
+// Postgres holds an outbox.
+func (a *App) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	if a.RedisBreaker != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.RedisBreaker.Run(ctx)
+		}()
+	}
+	if a.replicated != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.replicated.Run(ctx)
+		}()
+	}
+	if a.Driver != db.Postgres {
+		wg.Wait()
+		return
+	}
+
+	relay := outbox.NewRelay(a.DB)
+	var replicaLag time.Duration
+	if a.replicated != nil {
+		// A replica in rotation may fall further behind until the next check
+		replicaLag = a.replicated.MaxLag + a.replicated.CheckInterval
+	}
+	a.handlers.RegisterOutboxHandlers(relay, replicaLag)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		relay.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		dispatcher := webhooks.NewDispatcher(a.DB)
+		dispatcher.AllowPrivateTargets = a.Config.AllowPrivateWebhooks
+		dispatcher.Run(ctx)
+	}()
+	wg.Wait()
+}
+
+// Close stops the background work started by New and closes the connections
+// the App opened.
+func (a *App) Close() error {
+	if a.stop != nil {
+		a.stop()
+	}
+	var err error
+	if a.Redis != nil {
+		err = a.Redis.Close()
+	}
+	if a.ownsDB && a.DB != nil {
+		if closeErr := a.DB.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	for _, replica := range a.replicas {
+		if closeErr := replica.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// newPostStore returns the store for driver. Postgres records every change
+// in the outbox; other databases have none.
+func newPostStore(conn *sql.DB, driver string, clock func() time.Time) store.PostStore {
+	if driver == db.SQLite {
+		sqlite := store.NewSQLite(conn, nil)
+		sqlite.Clock = clock
+		return sqlite
+	}
+	postgres := store.NewPostgres(conn, controllers.PostChangeRecorder(clock))
+	postgres.Clock = clock
+	return postgres
+}
+
+// newPostCache returns the Redis cache, fronted by an in-process LRU unless
+// its size is zero and namespaced by the version stored in Redis, and the
+// Redis lock shared by replicas. The LRU drops keys deleted by other
+// instances as soon as Redis announces them, until ctx is done. Without
+// Redis nothing is cached: a process-local cache could not be invalidated
+// across replicas.
+func newPostCache(ctx context.Context, client *redis.Client, cfg db.CacheConfig) (cache.Cache, cache.Locker) {
+	if client == nil {
+		return cache.Noop{}, nil
+	}
+	remote := cache.NewRedis(client)
+	if cfg.LocalSize <= 0 {
+		return cache.NewNamespace(remote, remote), remote
+	}
+	local := cache.NewLRU(cfg.LocalSize, cfg.LocalTTL)
+	go remote.Subscribe(ctx, local.Evict)
+	return cache.NewNamespace(cache.NewTiered(local, remote), remote), remote
+}
+
+// postPolicies resolves the configured sanitization policy names.
+func postPolicies(cfg db.SanitizeConfig) (controllers.PostPolicies, error) {
+	policies := controllers.DefaultPostPolicies
+	for _, field := range []struct {
+		name   string
+		policy string
+		dst    *middlewares.SanitizePolicy
+	}{
+		{"title", cfg.TitlePolicy, &policies.Title},
+		{"excerpt", cfg.ExcerptPolicy, &policies.Excerpt},
+		{"body", cfg.BodyPolicy, &policies.Body},
+	} {
+		if field.policy == "" {
+			continue
+		}
+		policy, err := middlewares.LookupSanitizePolicy(field.policy)
+		if err != nil {
+			return controllers.PostPolicies{}, fmt.Errorf("invalid %s sanitize policy: %w", field.name, err)
+		}
+		*field.dst = policy
+	}
+	return policies, nil
+}
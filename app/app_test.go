@@ -0,0 +1,80 @@
+package app_test
+
+import (
+	"blogklert/app"
+	"blogklert/db"
+	"blogklert/store"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func TestAppsShareProcess(t *testing.T) {
+	// The handle is never used: posts live in memory and Redis is unset.
+	conn, err := sql.Open("postgres", "postgres://localhost/unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	config := &db.Config{BearerToken: "token", GraphQL: db.GraphQLConfig{MaxDepth: 5, MaxComplexity: 100}}
+	newApp := func() *app.App {
+		a, err := app.New(context.Background(), config, app.Options{DB: conn, Store: store.NewMemory()})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+	first, second := newApp(), newApp()
+
+	do := func(a *app.App, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(first, "POST", "/v1/posts", `{"title":"Hello","excerpt":"Short","body":"Body"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name  string
+		app   *app.App
+		posts int
+	}{
+		{"first", first, 1},
+		{"second", second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.app, "GET", "/v1/posts", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("list: status %d: %s", rec.Code, rec.Body)
+			}
+			var posts []json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &posts); err != nil {
+				t.Fatalf("list: %v: %s", err, rec.Body)
+			}
+			if len(posts) != tt.posts {
+				t.Errorf("got %d posts, want %d", len(posts), tt.posts)
+			}
+
+			rec = do(tt.app, "GET", "/debug/vars", "")
+			var vars map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil || vars["cache"] == nil {
+				t.Errorf("metrics: status %d, cache %s, err %v", rec.Code, vars["cache"], err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Package breaker implements a circuit breaker for an optional dependency.
+// After a run of consecutive failures the circuit opens and calls fail fast
+// with ErrOpen, while a background probe checks the dependency and closes the
+// circuit once it answers again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of calling a dependency whose circuit is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit.
+type State int
+
+const (
+	// Closed lets calls through.
+	Closed State = iota
+	// Open fails calls fast until a probe succeeds.
+	Open
+)
+
+func (s State) String() string {
+	if s == Open {
+		return "open"
+	}
+	return "closed"
+}
+
+// Status describes a circuit for health checks.
+type Status struct {
+	State State
+	// Since is when the circuit entered State.
+	Since time.Time
+	// LastError is the failure that opened the circuit.
+	LastError error
+}
+
+// Breaker tracks the health of one dependency. It is safe for concurrent use.
+type Breaker struct {
+	name      string
+	threshold int
+	interval  time.Duration
+	probe     func(ctx context.Context) error
+
+	mu       sync.Mutex
+	state    State
+	since    time.Time
+	failures int
+	lastErr  error
+}
+
+// New returns a closed Breaker that opens after threshold consecutive
+// failures. While open, Run calls probe every interval.
+func New(name string, threshold int, interval time.Duration, probe func(ctx context.Context) error) *Breaker {
+	return &Breaker{name: name, threshold: threshold, interval: interval, probe: probe, since: time.Now()}
+}
+
+// Allow reports whether a call may go through.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == Closed
+}
+
+// Success records a successful call.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// Failure records a failed call, opening the circuit at the threshold.
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open {
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.failures >= b.threshold {
+		b.setState(Open)
+	}
+}
+
+// Trip opens the circuit at once, for example when the dependency is
+// unreachable at startup.
+func (b *Breaker) Trip(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	if b.state != Open {
+		b.setState(Open)
+	}
+}
+
+// setState switches the circuit. The caller holds mu.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.since = time.Now()
+	b.failures = 0
+	if state == Open {
+		log.Printf("%s circuit opened: %v", b.name, b.lastErr)
+	} else {
+		b.lastErr = nil
+		log.Printf("%s circuit closed", b.name)
+	}
+}
+
+// Status returns the current state of the circuit.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Status{State: b.state, Since: b.since, LastError: b.lastErr}
+}
+
+// Run probes the dependency while the circuit is open, closing it on the
+// first success, until ctx is cancelled.
+func (b *Breaker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if b.Allow() {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, b.interval)
+		err := b.probe(probeCtx)
+		cancel()
+
+		b.mu.Lock()
+		if err == nil && b.state == Open {
+			b.setState(Closed)
+		} else if err != nil {
+			b.lastErr = err
+		}
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,79 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name  string
+		calls []error
+		want  State
+	}{
+		{name: "Below threshold", calls: []error{errDown, errDown}, want: Closed},
+		{name: "At threshold", calls: []error{errDown, errDown, errDown}, want: Open},
+		{name: "Success resets the count", calls: []error{errDown, errDown, nil, errDown, errDown}, want: Closed},
+		{name: "No calls", want: Closed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("test", 3, time.Second, nil)
+			for _, err := range tt.calls {
+				if err != nil {
+					b.Failure(err)
+				} else {
+					b.Success()
+				}
+			}
+			status := b.Status()
+			if status.State != tt.want {
+				t.Errorf("Expected state %v, got %v", tt.want, status.State)
+			}
+			if b.Allow() != (tt.want == Closed) {
+				t.Errorf("Allow() = %v in state %v", b.Allow(), status.State)
+			}
+			if tt.want == Open && !errors.Is(status.LastError, errDown) {
+				t.Errorf("Expected the last error to be recorded, got %v", status.LastError)
+			}
+		})
+	}
+}
+
+func TestBreaker_Run(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	b := New("test", 1, 5*time.Millisecond, func(context.Context) error {
+		probes.Add(1)
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("still down")
+	})
+	b.Trip(errors.New("unreachable at startup"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	time.Sleep(30 * time.Millisecond)
+	if b.Allow() || probes.Load() == 0 {
+		t.Fatalf("Expected the circuit to stay open while probes fail (probes: %d)", probes.Load())
+	}
+
+	healthy.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for !b.Allow() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !b.Allow() {
+		t.Fatal("Expected a successful probe to close the circuit")
+	}
+	if status := b.Status(); status.LastError != nil {
+		t.Errorf("Expected the error to be cleared, got %v", status.LastError)
+	}
+}
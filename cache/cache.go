@@ -0,0 +1,145 @@
+// Package cache provides the hash cache used for post data: an interface with
+// Redis, in-process LRU, two-tier and no-op implementations, plus typed JSON
+// helpers. Each key holds a hash whose fields are stored and expire together,
+// and is tagged with the entities it contains so writes can invalidate every
+// key holding an entity without knowing their names.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores hashes of encoded values under string keys.
+type Cache interface {
+	// Get returns field of the hash at key and whether it was found.
+	Get(ctx context.Context, key, field string) ([]byte, bool, error)
+	// GetMulti returns field of each hash in keys, with nil for misses.
+	GetMulti(ctx context.Context, keys []string, field string) ([][]byte, error)
+	// Set stores values in the hash at key, resets its expiry to ttl and
+	// adds key to tags.
+	Set(ctx context.Context, key string, values map[string][]byte, ttl time.Duration, tags ...string) error
+	// Delete removes the hashes at keys.
+	Delete(ctx context.Context, keys ...string) error
+	// Retire hides the hashes at keys from Get but keeps them readable
+	// through GetStale for staleFor, so readers can be served while one of
+	// them refreshes the value.
+	Retire(ctx context.Context, staleFor time.Duration, keys ...string) error
+	// GetStale returns field of a hash retired less than its stale window ago.
+	GetStale(ctx context.Context, key, field string) ([]byte, bool, error)
+	// Invalidate retires every key added to any of tags, as Retire does, and
+	// returns them.
+	Invalidate(ctx context.Context, staleFor time.Duration, tags ...string) ([]string, error)
+	// Stats returns lookup counters per tier.
+	Stats() map[string]Stats
+}
+
+// Stats counts cache lookups.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+	// StaleHits counts stale values served by GetStale.
+	StaleHits uint64 `json:"stale_hits"`
+}
+
+// metrics records lookups for Stats. It is safe for concurrent use.
+type metrics struct {
+	hits, misses, errors, staleHits atomic.Uint64
+}
+
+func (m *metrics) record(found bool, err error) {
+	switch {
+	case err != nil:
+		m.errors.Add(1)
+	case found:
+		m.hits.Add(1)
+	default:
+		m.misses.Add(1)
+	}
+}
+
+func (m *metrics) recordStale(found bool) {
+	if found {
+		m.staleHits.Add(1)
+	}
+}
+
+func (m *metrics) snapshot() Stats {
+	return Stats{Hits: m.hits.Load(), Misses: m.misses.Load(), Errors: m.errors.Load(), StaleHits: m.staleHits.Load()}
+}
+
+// GetJSON decodes field of the hash at key into a T.
+func GetJSON[T any](ctx context.Context, c Cache, key, field string) (T, bool, error) {
+	var value T
+	data, ok, err := c.Get(ctx, key, field)
+	if err != nil || !ok {
+		return value, false, err
+	}
+	if err := decode(data, &value, key, field); err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+func decode(data []byte, value interface{}, key, field string) error {
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("error decoding cached %s %s: %w", key, field, err)
+	}
+	return nil
+}
+
+// GetMultiJSON decodes field of each hash in keys, with nil for misses.
+func GetMultiJSON[T any](ctx context.Context, c Cache, keys []string, field string) ([]*T, error) {
+	data, err := c.GetMulti(ctx, keys, field)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*T, len(keys))
+	for i, item := range data {
+		if item == nil {
+			continue
+		}
+		values[i] = new(T)
+		if err := decode(item, values[i], keys[i], field); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// SetJSON encodes value and stores it as field of the hash at key, tagged
+// with tags.
+func SetJSON(ctx context.Context, c Cache, key, field string, value interface{}, ttl time.Duration, tags ...string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding %s %s for the cache: %w", key, field, err)
+	}
+	return c.Set(ctx, key, map[string][]byte{field: data}, ttl, tags...)
+}
+
+// Noop is a Cache that stores nothing, for tests and for running without a cache.
+type Noop struct{}
+
+func (Noop) Get(context.Context, string, string) ([]byte, bool, error) { return nil, false, nil }
+
+func (Noop) GetMulti(_ context.Context, keys []string, _ string) ([][]byte, error) {
+	return make([][]byte, len(keys)), nil
+}
+
+func (Noop) Set(context.Context, string, map[string][]byte, time.Duration, ...string) error {
+	return nil
+}
+
+func (Noop) Delete(context.Context, ...string) error { return nil }
+
+func (Noop) Retire(context.Context, time.Duration, ...string) error { return nil }
+
+func (Noop) GetStale(context.Context, string, string) ([]byte, bool, error) { return nil, false, nil }
+
+func (Noop) Invalidate(context.Context, time.Duration, ...string) ([]string, error) { return nil, nil }
+
+func (Noop) Stats() map[string]Stats { return map[string]Stats{} }
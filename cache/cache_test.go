@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := NewLRU(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_ = c.Set(ctx, "a", map[string][]byte{"f": []byte("1")}, time.Hour)
+	_ = c.Set(ctx, "b", map[string][]byte{"f": []byte("2")}, 0)
+	if _, ok, _ := c.Get(ctx, "a", "f"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	// b is now the least recently used key and is evicted by c.
+	_ = c.Set(ctx, "c", map[string][]byte{"f": []byte("3")}, 0)
+
+	tests := []struct {
+		name  string
+		key   string
+		field string
+		want  string
+		found bool
+	}{
+		{name: "Recently used", key: "a", field: "f", want: "1", found: true},
+		{name: "Evicted", key: "b", field: "f"},
+		{name: "Newest", key: "c", field: "f", want: "3", found: true},
+		{name: "Missing field", key: "a", field: "g"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := c.Get(ctx, tt.key, tt.field)
+			if err != nil || ok != tt.found || string(value) != tt.want {
+				t.Errorf("Get(%q, %q) = %q, %v, %v; want %q, %v", tt.key, tt.field, value, ok, err, tt.want, tt.found)
+			}
+		})
+	}
+
+	// Entries never outlive maxTTL, whatever ttl they were stored with.
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a", "f"); ok {
+		t.Error("Expected a to expire after maxTTL")
+	}
+
+	stats := c.Stats()["local"]
+	if stats.Hits != 3 || stats.Misses != 3 {
+		t.Errorf("Expected 3 hits and 3 misses, got %+v", stats)
+	}
+}
+
+func TestLRU_Delete(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 0)
+	_ = c.Set(ctx, "a", map[string][]byte{"f": []byte("1")}, 0)
+	_ = c.Set(ctx, "b", map[string][]byte{"f": []byte("2")}, 0)
+	_ = c.Delete(ctx, "a", "missing")
+	if _, ok, _ := c.Get(ctx, "a", "f"); ok {
+		t.Error("Expected a to be deleted")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Expected 1 key left, got %d", c.Len())
+	}
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	local := NewLRU(10, time.Minute)
+	remote := NewLRU(10, 0)
+	c := NewTiered(local, remote)
+
+	_ = remote.Set(ctx, "a", map[string][]byte{"f": []byte("1")}, 0)
+	if value, ok, _ := c.Get(ctx, "a", "f"); !ok || string(value) != "1" {
+		t.Fatalf("Expected a remote hit, got %q, %v", value, ok)
+	}
+	if _, ok, _ := local.Get(ctx, "a", "f"); !ok {
+		t.Error("Expected the remote hit to fill the local tier")
+	}
+
+	_ = c.Set(ctx, "b", map[string][]byte{"f": []byte("2")}, time.Hour)
+	values, err := c.GetMulti(ctx, []string{"a", "b", "missing"}, "f")
+	if err != nil || string(values[0]) != "1" || string(values[1]) != "2" || values[2] != nil {
+		t.Errorf("GetMulti() = %q, %v", values, err)
+	}
+
+	_ = c.Delete(ctx, "a")
+	for name, tier := range map[string]Cache{"local": local, "remote": remote} {
+		if _, ok, _ := tier.Get(ctx, "a", "f"); ok {
+			t.Errorf("Expected a to be deleted from the %s tier", name)
+		}
+	}
+
+	stats := c.Stats()
+	if _, ok := stats["local"]; !ok || len(stats) != 1 {
+		// Both tiers are LRUs here, so their stats share a name.
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestJSONHelpers(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 0)
+	type post struct {
+		Title string `json:"title"`
+	}
+
+	if err := SetJSON(ctx, c, "post:1", "full", post{Title: "Hello"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := GetJSON[post](ctx, c, "post:1", "full")
+	if err != nil || !ok || got.Title != "Hello" {
+		t.Errorf("GetJSON() = %+v, %v, %v", got, ok, err)
+	}
+
+	_ = c.Set(ctx, "post:2", map[string][]byte{"full": []byte("not json")}, 0)
+	if _, ok, err := GetJSON[post](ctx, c, "post:2", "full"); ok || err == nil {
+		t.Errorf("Expected a decoding error, got %v, %v", ok, err)
+	}
+
+	if _, ok, err := GetJSON[post](ctx, Noop{}, "post:1", "full"); ok || err != nil {
+		t.Errorf("Expected Noop to miss, got %v, %v", ok, err)
+	}
+}
+
+func TestLRU_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 0)
+	_ = c.Set(ctx, "post:1", map[string][]byte{"f": []byte("1")}, 0, "post:1")
+	_ = c.Set(ctx, "post:2", map[string][]byte{"f": []byte("2")}, 0, "post:2")
+	_ = c.Set(ctx, "posts", map[string][]byte{"f": []byte("all")}, 0, "posts", "post:1", "post:2")
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		present []string
+	}{
+		{name: "Unknown tag", tags: []string{"author:1"}, present: []string{"post:1", "post:2", "posts"}},
+		{name: "One entity", tags: []string{"post:1"}, want: []string{"post:1", "posts"}, present: []string{"post:2"}},
+		{name: "Already retired keys are reported again", tags: []string{"post:1", "post:2"}, want: []string{"post:1", "post:2", "posts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := c.Invalidate(ctx, time.Minute, tt.tags...)
+			sort.Strings(keys)
+			if err != nil || len(keys) != len(tt.want) {
+				t.Fatalf("Invalidate(%v) = %v, %v; want %v", tt.tags, keys, err, tt.want)
+			}
+			for i := range keys {
+				if keys[i] != tt.want[i] {
+					t.Fatalf("Invalidate(%v) = %v; want %v", tt.tags, keys, tt.want)
+				}
+			}
+			for _, key := range tt.present {
+				if _, ok, _ := c.Get(ctx, key, "f"); !ok {
+					t.Errorf("Expected %s to be untouched", key)
+				}
+			}
+			for _, key := range tt.want {
+				if _, ok, _ := c.Get(ctx, key, "f"); ok {
+					t.Errorf("Expected %s to be retired", key)
+				}
+				if _, ok, _ := c.GetStale(ctx, key, "f"); !ok {
+					t.Errorf("Expected %s to stay readable as stale", key)
+				}
+			}
+		})
+	}
+
+	// Storing a key again tags it afresh.
+	_ = c.Set(ctx, "post:1", map[string][]byte{"f": []byte("1")}, 0, "post:1")
+	_, _ = c.Invalidate(ctx, 0, "post:1")
+	if _, ok, _ := c.Get(ctx, "post:1", "f"); ok {
+		t.Error("Expected the refreshed key to be invalidated")
+	}
+}
+
+func TestTiered_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	local := NewLRU(10, time.Minute)
+	remote := NewLRU(10, 0)
+	c := NewTiered(local, remote)
+
+	// Copied locally from a remote hit, so only the remote tier knows its tags.
+	_ = remote.Set(ctx, "post:1", map[string][]byte{"f": []byte("1")}, 0, "post:1")
+	_, _, _ = c.Get(ctx, "post:1", "f")
+
+	if _, err := c.Invalidate(ctx, 0, "post:1"); err != nil {
+		t.Fatal(err)
+	}
+	for name, tier := range map[string]Cache{"local": local, "remote": remote} {
+		if _, ok, _ := tier.Get(ctx, "post:1", "f"); ok {
+			t.Errorf("Expected post:1 to be invalidated in the %s tier", name)
+		}
+	}
+}
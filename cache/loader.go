@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"blogklert/breaker"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// lockPollInterval is how often a reader waiting on another replica's lock
+// checks whether the value has been cached.
+const lockPollInterval = 50 * time.Millisecond
+
+// refreshTimeout bounds background refreshes, which outlive the request that
+// triggered them.
+const refreshTimeout = 30 * time.Second
+
+// Locker takes short-lived locks shared by every replica.
+type Locker interface {
+	// TryLock takes the lock named key for ttl, reporting false when another
+	// holder has it. The returned function releases the lock.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error)
+}
+
+// Loader fills a Cache on misses without stampeding the source: concurrent
+// misses for the same value within a process share one load, and across
+// replicas only the holder of a short lock loads while the others wait for
+// its result.
+type Loader struct {
+	Cache Cache
+	// Locker coordinates replicas; nil disables cross-replica locking.
+	Locker Locker
+	// LockTTL bounds how long replicas wait on a lock before loading anyway.
+	LockTTL time.Duration
+
+	group singleflight.Group
+}
+
+// Fetch returns field of the hash at key, calling load and caching its result
+// for ttl, tagged with tags, on a miss. A cache that cannot be read counts as a miss, so reads
+// fall back to load while the cache is down.
+func Fetch[T any](ctx context.Context, l *Loader, key, field string, ttl time.Duration, tags []string, load func(context.Context) (T, error)) (T, error) {
+	if value, ok, err := GetJSON[T](ctx, l.Cache, key, field); err == nil && ok {
+		return value, nil
+	}
+	return fill(ctx, l, key, field, ttl, tags, load)
+}
+
+// FetchStale is like Fetch, except that when key has been retired and still
+// holds a stale value, that value is returned at once while a single
+// background load refreshes it. stale reports whether that happened.
+func FetchStale[T any](ctx context.Context, l *Loader, key, field string, ttl time.Duration, tags []string, load func(context.Context) (T, error)) (value T, stale bool, err error) {
+	value, ok, err := GetJSON[T](ctx, l.Cache, key, field)
+	if err == nil && ok {
+		return value, false, nil
+	}
+
+	data, ok, err := l.Cache.GetStale(ctx, key, field)
+	if err == nil && ok {
+		if err := decode(data, &value, key, field); err == nil {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+				defer cancel()
+				if _, err := fill(ctx, l, key, field, ttl, tags, load); err != nil {
+					log.Printf("error refreshing %s %s: %v", key, field, err)
+				}
+			}()
+			return value, true, nil
+		}
+	}
+
+	value, err = fill(ctx, l, key, field, ttl, tags, load)
+	return value, false, err
+}
+
+// fill loads and caches a missing value, sharing the load with concurrent
+// callers. The load runs detached from ctx so one caller giving up does not
+// fail the others.
+func fill[T any](ctx context.Context, l *Loader, key, field string, ttl time.Duration, tags []string, load func(context.Context) (T, error)) (T, error) {
+	result := l.group.DoChan(key+"\x00"+field, func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		if l.Locker != nil && l.LockTTL > 0 {
+			unlock, ok, err := l.Locker.TryLock(ctx, key+":lock:"+field, l.LockTTL)
+			if err == nil && !ok {
+				if value, ok := waitFor[T](ctx, l, key, field); ok {
+					return value, nil
+				}
+			}
+			if ok {
+				defer unlock()
+				// The previous holder may have filled the cache since our miss.
+				if value, ok, err := GetJSON[T](ctx, l.Cache, key, field); err == nil && ok {
+					return value, nil
+				}
+			}
+		}
+
+		value, err := load(ctx)
+		if err != nil {
+			return value, err
+		}
+		if err := SetJSON(ctx, l.Cache, key, field, value, ttl, tags...); err != nil && !errors.Is(err, breaker.ErrOpen) {
+			log.Printf("error caching %s %s: %v", key, field, err)
+		}
+		return value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			var zero T
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	}
+}
+
+// waitFor polls the cache until another replica's load lands or its lock
+// expires.
+func waitFor[T any](ctx context.Context, l *Loader, key, field string) (T, bool) {
+	deadline := time.Now().Add(l.LockTTL)
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		<-ticker.C
+		if value, ok, err := GetJSON[T](ctx, l.Cache, key, field); err == nil && ok {
+			return value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"blogklert/breaker"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch_CoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	loader := &Loader{Cache: NewLRU(10, 0)}
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) ([]string, error) {
+		loads.Add(1)
+		<-release
+		return []string{"post"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = Fetch(ctx, loader, "posts", "summary", time.Minute, nil, load)
+		}(i)
+	}
+	// Let every reader miss before the load completes.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("Expected 1 load, got %d", n)
+	}
+	for i, result := range results {
+		if len(result) != 1 || result[0] != "post" {
+			t.Errorf("Reader %d got %v", i, result)
+		}
+	}
+	if _, ok, _ := loader.Cache.Get(ctx, "posts", "summary"); !ok {
+		t.Error("Expected the loaded value to be cached")
+	}
+}
+
+func TestFetchStale(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 0)
+	loader := &Loader{Cache: c}
+	_ = SetJSON(ctx, c, "posts", "summary", "old", 0)
+	_ = c.Retire(ctx, time.Minute, "posts")
+
+	refreshed := make(chan struct{})
+	load := func(context.Context) (string, error) {
+		defer close(refreshed)
+		return "new", nil
+	}
+
+	value, stale, err := FetchStale(ctx, loader, "posts", "summary", time.Minute, nil, load)
+	if err != nil || !stale || value != "old" {
+		t.Fatalf("FetchStale() = %q, %v, %v; want the stale value", value, stale, err)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a background refresh")
+	}
+	// The refresh caches its result just after load returns.
+	for i := 0; i < 100; i++ {
+		if value, ok, _ := GetJSON[string](ctx, c, "posts", "summary"); ok {
+			if value != "new" {
+				t.Errorf("Expected the refreshed value, got %q", value)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Expected the refreshed value to be cached")
+}
+
+func TestFetchStale_NoStaleValue(t *testing.T) {
+	loader := &Loader{Cache: NewLRU(10, 0)}
+	value, stale, err := FetchStale(context.Background(), loader, "posts", "summary", time.Minute, nil,
+		func(context.Context) (string, error) { return "loaded", nil })
+	if err != nil || stale || value != "loaded" {
+		t.Errorf("FetchStale() = %q, %v, %v; want a synchronous load", value, stale, err)
+	}
+}
+
+// heldLock is a Locker whose lock is always held by another replica.
+type heldLock struct{}
+
+func (heldLock) TryLock(context.Context, string, time.Duration) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func TestFetch_WaitsForLockHolder(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 0)
+	loader := &Loader{Cache: c, Locker: heldLock{}, LockTTL: time.Second}
+
+	// Another replica fills the cache while this one waits.
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		_ = SetJSON(ctx, c, "posts", "summary", "from replica", 0)
+	}()
+	value, err := Fetch(ctx, loader, "posts", "summary", time.Minute, nil, func(context.Context) (string, error) {
+		t.Error("Expected to wait for the lock holder instead of loading")
+		return "", nil
+	})
+	if err != nil || value != "from replica" {
+		t.Errorf("Fetch() = %q, %v", value, err)
+	}
+
+	// When the holder never delivers, the waiter loads once the lock expires.
+	loader.LockTTL = 2 * lockPollInterval
+	value, err = Fetch(ctx, loader, "other", "summary", time.Minute, nil, func(context.Context) (string, error) {
+		return "loaded", nil
+	})
+	if err != nil || value != "loaded" {
+		t.Errorf("Fetch() after lock expiry = %q, %v", value, err)
+	}
+}
+
+// downCache fails every operation, like a Redis cache whose circuit is open.
+type downCache struct{ Noop }
+
+func (downCache) Get(context.Context, string, string) ([]byte, bool, error) {
+	return nil, false, breaker.ErrOpen
+}
+
+func (downCache) GetStale(context.Context, string, string) ([]byte, bool, error) {
+	return nil, false, breaker.ErrOpen
+}
+
+func (downCache) Set(context.Context, string, map[string][]byte, time.Duration, ...string) error {
+	return breaker.ErrOpen
+}
+
+func TestFetch_CacheDown(t *testing.T) {
+	ctx := context.Background()
+	loader := &Loader{Cache: downCache{}}
+	load := func(context.Context) (string, error) { return "post", nil }
+
+	value, err := Fetch(ctx, loader, "post:1", "full", time.Minute, nil, load)
+	if err != nil || value != "post" {
+		t.Errorf("Fetch: expected the loaded value, got %q, %v", value, err)
+	}
+	value, stale, err := FetchStale(ctx, loader, "posts", "summary", time.Minute, nil, load)
+	if err != nil || stale || value != "post" {
+		t.Errorf("FetchStale: expected the loaded value, got %q, %v, %v", value, stale, err)
+	}
+}
+
+func TestLRU_Retire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := NewLRU(10, 0)
+	c.now = func() time.Time { return now }
+	_ = c.Set(ctx, "a", map[string][]byte{"f": []byte("1"), "g": []byte("2")}, 0)
+	_ = c.Retire(ctx, time.Minute, "a")
+
+	if _, ok, _ := c.Get(ctx, "a", "f"); ok {
+		t.Error("Expected a retired key to miss")
+	}
+	if value, ok, _ := c.GetStale(ctx, "a", "f"); !ok || string(value) != "1" {
+		t.Errorf("GetStale() = %q, %v", value, ok)
+	}
+
+	// A fresh value replaces every stale field.
+	_ = c.Set(ctx, "a", map[string][]byte{"f": []byte("3")}, 0)
+	if value, ok, _ := c.Get(ctx, "a", "f"); !ok || string(value) != "3" {
+		t.Errorf("Get() after refresh = %q, %v", value, ok)
+	}
+	if _, ok, _ := c.Get(ctx, "a", "g"); ok {
+		t.Error("Expected stale fields to be dropped by a refresh")
+	}
+
+	_ = c.Retire(ctx, time.Minute, "a")
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.GetStale(ctx, "a", "f"); ok {
+		t.Error("Expected the stale value to expire after its window")
+	}
+}
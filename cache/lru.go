@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is a bounded in-process Cache. Once it holds size keys, the least
+// recently used key is evicted to make room.
+type LRU struct {
+	size   int
+	maxTTL time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// tagged maps each tag to the keys stored with it.
+	tagged  map[string]map[string]struct{}
+	metrics metrics
+}
+
+type lruEntry struct {
+	key     string
+	fields  map[string][]byte
+	expires time.Time
+	tags    []string
+	// stale is set once the entry is retired.
+	stale bool
+}
+
+// NewLRU returns an LRU holding at most size keys. Entries never live longer
+// than maxTTL, which bounds how stale a copy can get when a deletion made by
+// another process is missed; zero means no bound.
+func NewLRU(size int, maxTTL time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		maxTTL:  maxTTL,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		tagged:  make(map[string]map[string]struct{}),
+	}
+}
+
+// remove drops element and its tags. The caller holds mu.
+func (c *LRU) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.untag(entry)
+}
+
+// untag removes entry from the keys of its tags. The caller holds mu.
+func (c *LRU) untag(entry *lruEntry) {
+	for _, tag := range entry.tags {
+		delete(c.tagged[tag], entry.key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+	entry.tags = nil
+}
+
+// lookup returns the unexpired entry at key, fresh or stale, dropping it when
+// expired. The caller holds mu.
+func (c *LRU) lookup(key string) *lruEntry {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return entry
+}
+
+// field returns field of the entry at key if its staleness matches stale.
+func (c *LRU) field(key, field string, stale bool) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry := c.lookup(key); entry != nil && entry.stale == stale {
+		return entry.fields[field]
+	}
+	return nil
+}
+
+func (c *LRU) Get(_ context.Context, key, field string) ([]byte, bool, error) {
+	value := c.field(key, field, false)
+	c.metrics.record(value != nil, nil)
+	return value, value != nil, nil
+}
+
+func (c *LRU) GetStale(_ context.Context, key, field string) ([]byte, bool, error) {
+	value := c.field(key, field, true)
+	c.metrics.recordStale(value != nil)
+	return value, value != nil, nil
+}
+
+func (c *LRU) GetMulti(ctx context.Context, keys []string, field string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _, _ = c.Get(ctx, key, field)
+	}
+	return values, nil
+}
+
+// Set stores values at key. A ttl of zero, or one above the LRU's maxTTL, is
+// replaced by maxTTL.
+func (c *LRU) Set(_ context.Context, key string, values map[string][]byte, ttl time.Duration, tags ...string) error {
+	if c.size <= 0 {
+		return nil
+	}
+	if ttl <= 0 || (c.maxTTL > 0 && ttl > c.maxTTL) {
+		ttl = c.maxTTL
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.lookup(key)
+	if entry != nil && entry.stale {
+		// A fresh value replaces the retired one entirely.
+		entry.fields = make(map[string][]byte, len(values))
+		entry.stale = false
+		c.untag(entry)
+	}
+	if entry == nil {
+		entry = &lruEntry{key: key, fields: make(map[string][]byte, len(values))}
+		c.entries[key] = c.order.PushFront(entry)
+		for c.order.Len() > c.size {
+			c.remove(c.order.Back())
+		}
+	}
+	for field, value := range values {
+		entry.fields[field] = value
+	}
+	entry.expires = expires
+	for _, tag := range tags {
+		if _, ok := c.tagged[tag][key]; ok {
+			continue
+		}
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = make(map[string]struct{})
+		}
+		c.tagged[tag][key] = struct{}{}
+		entry.tags = append(entry.tags, tag)
+	}
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, keys ...string) error {
+	c.Evict(keys...)
+	return nil
+}
+
+// Retire marks keys stale for staleFor, or evicts them when staleFor is zero.
+func (c *LRU) Retire(_ context.Context, staleFor time.Duration, keys ...string) error {
+	if staleFor <= 0 {
+		c.Evict(keys...)
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if entry := c.lookup(key); entry != nil && !entry.stale {
+			entry.stale = true
+			entry.expires = c.now().Add(staleFor)
+		}
+	}
+	return nil
+}
+
+// Evict drops keys from the LRU.
+func (c *LRU) Evict(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+// Invalidate retires the keys stored with any of tags.
+func (c *LRU) Invalidate(ctx context.Context, staleFor time.Duration, tags ...string) ([]string, error) {
+	c.mu.Lock()
+	var keys []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		for key := range c.tagged[tag] {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	c.mu.Unlock()
+	return keys, c.Retire(ctx, staleFor, keys...)
+}
+
+// Len returns the number of keys held, including expired ones not yet dropped.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) Stats() map[string]Stats {
+	return map[string]Stats{"local": c.metrics.snapshot()}
+}
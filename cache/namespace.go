@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versions stores a namespace version shared by every process.
+type Versions interface {
+	// Version returns the current version.
+	Version(ctx context.Context) (int64, error)
+	// Bump increments the version and returns it.
+	Bump(ctx context.Context) (int64, error)
+}
+
+// Namespace prefixes the keys and tags of a Cache with a version, so bumping
+// the version flushes the whole cache at once, for example after a deploy or
+// a migration changes what is cached. Keys written under older versions are
+// never read again and expire on their own.
+type Namespace struct {
+	cache    Cache
+	versions Versions
+}
+
+// NewNamespace returns c namespaced by the version held in versions.
+func NewNamespace(c Cache, versions Versions) *Namespace {
+	return &Namespace{cache: c, versions: versions}
+}
+
+// Flush bumps the namespace version and returns the new one.
+func (n *Namespace) Flush(ctx context.Context) (int64, error) {
+	return n.versions.Bump(ctx)
+}
+
+func (n *Namespace) prefix(ctx context.Context) (string, error) {
+	version, err := n.versions.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "v" + strconv.FormatInt(version, 10) + ":", nil
+}
+
+func prefixed(prefix string, names []string) []string {
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = prefix + name
+	}
+	return result
+}
+
+func (n *Namespace) Get(ctx context.Context, key, field string) ([]byte, bool, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return n.cache.Get(ctx, prefix+key, field)
+}
+
+func (n *Namespace) GetMulti(ctx context.Context, keys []string, field string) ([][]byte, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return n.cache.GetMulti(ctx, prefixed(prefix, keys), field)
+}
+
+func (n *Namespace) Set(ctx context.Context, key string, values map[string][]byte, ttl time.Duration, tags ...string) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.Set(ctx, prefix+key, values, ttl, prefixed(prefix, tags)...)
+}
+
+func (n *Namespace) Delete(ctx context.Context, keys ...string) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.Delete(ctx, prefixed(prefix, keys)...)
+}
+
+func (n *Namespace) Retire(ctx context.Context, staleFor time.Duration, keys ...string) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.Retire(ctx, staleFor, prefixed(prefix, keys)...)
+}
+
+func (n *Namespace) GetStale(ctx context.Context, key, field string) ([]byte, bool, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return n.cache.GetStale(ctx, prefix+key, field)
+}
+
+// Invalidate retires the keys tagged in the current namespace and returns
+// them without their prefix.
+func (n *Namespace) Invalidate(ctx context.Context, staleFor time.Duration, tags ...string) ([]string, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := n.cache.Invalidate(ctx, staleFor, prefixed(prefix, tags)...)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, prefix)
+	}
+	return keys, err
+}
+
+func (n *Namespace) Stats() map[string]Stats {
+	return n.cache.Stats()
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+// memoryVersions is a Versions held in memory.
+type memoryVersions struct{ version int64 }
+
+func (v *memoryVersions) Version(context.Context) (int64, error) { return v.version, nil }
+
+func (v *memoryVersions) Bump(context.Context) (int64, error) {
+	v.version++
+	return v.version, nil
+}
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	backing := NewLRU(10, 0)
+	c := NewNamespace(backing, &memoryVersions{})
+
+	_ = c.Set(ctx, "posts", map[string][]byte{"f": []byte("v0")}, 0, "posts")
+	if _, ok, _ := backing.Get(ctx, "v0:posts", "f"); !ok {
+		t.Fatal("Expected the key to be stored under the version prefix")
+	}
+	if keys, _ := c.Invalidate(ctx, 0, "posts"); len(keys) != 1 || keys[0] != "posts" {
+		t.Errorf("Expected Invalidate to return unprefixed keys, got %v", keys)
+	}
+
+	_ = c.Set(ctx, "posts", map[string][]byte{"f": []byte("v0")}, 0, "posts")
+	if version, err := c.Flush(ctx); err != nil || version != 1 {
+		t.Fatalf("Flush() = %d, %v", version, err)
+	}
+	if _, ok, _ := c.Get(ctx, "posts", "f"); ok {
+		t.Error("Expected the flush to hide keys of the previous version")
+	}
+	_ = c.Set(ctx, "posts", map[string][]byte{"f": []byte("v1")}, 0, "posts")
+	if value, ok, _ := c.Get(ctx, "posts", "f"); !ok || string(value) != "v1" {
+		t.Errorf("Expected the new version's value, got %q, %v", value, ok)
+	}
+}
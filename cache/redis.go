@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// invalidationChannel carries the keys deleted through a Redis cache, so other
+// processes can drop their local copies.
+const invalidationChannel = "cache:invalidate"
+
+// Redis is a Cache backed by Redis hashes. It also stores the namespace
+// version shared by every process (see Namespace).
+type Redis struct {
+	client  *redis.Client
+	metrics metrics
+
+	mu        sync.Mutex
+	version   int64
+	versionAt time.Time
+}
+
+// NewRedis returns a Cache using client.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (c *Redis) Get(ctx context.Context, key, field string) ([]byte, bool, error) {
+	value, err := c.client.HGet(ctx, key, field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		c.metrics.record(false, nil)
+		return nil, false, nil
+	}
+	c.metrics.record(err == nil, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) GetMulti(ctx context.Context, keys []string, field string) ([][]byte, error) {
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGet(ctx, key, field)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		c.metrics.record(false, err)
+		return nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	for i, cmd := range cmds {
+		value, err := cmd.Bytes()
+		c.metrics.record(err == nil, nil)
+		if err == nil {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, values map[string][]byte, ttl time.Duration, tags ...string) error {
+	keys := []string{key}
+	for _, tag := range tags {
+		keys = append(keys, tagPrefix+tag)
+	}
+	args := make([]interface{}, 0, 1+2*len(values))
+	args = append(args, ttl.Milliseconds())
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	return setScript.Run(ctx, c.client, keys, args...).Err()
+}
+
+// tagPrefix names the set holding the keys stored with a tag.
+const tagPrefix = "tag:"
+
+// setScript stores the field/value pairs in ARGV[2..] in the hash KEYS[1],
+// expiring it after ARGV[1] ms unless that is zero, and adds KEYS[1] to the
+// tag sets in KEYS[2..]. A tag set lives as long as its longest-lived key.
+var setScript = redis.NewScript(`
+local ttl = tonumber(ARGV[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+for i = 2, #KEYS do
+	local existed = redis.call('EXISTS', KEYS[i])
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if ttl == 0 then
+		redis.call('PERSIST', KEYS[i])
+	else
+		local remaining = redis.call('PTTL', KEYS[i])
+		if existed == 0 or (remaining >= 0 and remaining < ttl) then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	end
+end
+return 1`)
+
+// Delete removes keys and announces the deletion to other processes.
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, invalidationChannel, strings.Join(keys, "\n")).Err()
+}
+
+// staleSuffix names the key a retired hash is moved to.
+const staleSuffix = ":stale"
+
+// retireScript renames each existing key in the first half of KEYS to the
+// matching key in the second half and sets its expiry to ARGV[1] ms.
+var retireScript = redis.NewScript(`
+local n = #KEYS / 2
+for i = 1, n do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		redis.call('RENAME', KEYS[i], KEYS[n + i])
+		redis.call('PEXPIRE', KEYS[n + i], ARGV[1])
+	end
+end
+return n`)
+
+// Retire moves keys aside for staleFor and announces the deletion to other
+// processes. A zero staleFor deletes them.
+func (c *Redis) Retire(ctx context.Context, staleFor time.Duration, keys ...string) error {
+	if staleFor <= 0 || len(keys) == 0 {
+		return c.Delete(ctx, keys...)
+	}
+	scriptKeys := append([]string{}, keys...)
+	for _, key := range keys {
+		scriptKeys = append(scriptKeys, key+staleSuffix)
+	}
+	if err := retireScript.Run(ctx, c.client, scriptKeys, staleFor.Milliseconds()).Err(); err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, invalidationChannel, strings.Join(keys, "\n")).Err()
+}
+
+// Invalidate retires the keys stored with any of tags. The tag sets are left
+// to expire: a key stored again after its retirement is already a member.
+func (c *Redis) Invalidate(ctx context.Context, staleFor time.Duration, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	tagKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		tagKeys[i] = tagPrefix + tag
+	}
+	keys, err := c.client.SUnion(ctx, tagKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return keys, c.Retire(ctx, staleFor, keys...)
+}
+
+func (c *Redis) GetStale(ctx context.Context, key, field string) ([]byte, bool, error) {
+	value, err := c.client.HGet(ctx, key+staleSuffix, field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	c.metrics.recordStale(true)
+	return value, true, nil
+}
+
+// TryLock takes the lock named key for ttl unless another process holds it.
+// The returned function releases the lock if it is still held by this call.
+func (c *Redis) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := uuid.NewString()
+	ok, err := c.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		if err := unlockScript.Run(context.Background(), c.client, []string{key}, token).Err(); err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("error releasing lock %s: %v", key, err)
+		}
+	}, true, nil
+}
+
+// unlockScript deletes KEYS[1] only if it still holds the token ARGV[1].
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// Subscribe calls evict with the keys deleted through any Redis cache sharing
+// the server, until ctx is cancelled.
+func (c *Redis) Subscribe(ctx context.Context, evict func(keys ...string)) {
+	sub := c.client.Subscribe(ctx, invalidationChannel)
+	defer sub.Close()
+	failing := false
+	for {
+		message, err := sub.ReceiveMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// Log once per outage rather than on every reconnection attempt.
+			if !failing {
+				log.Printf("error receiving cache invalidations: %v", err)
+				failing = true
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		failing = false
+		evict(strings.Split(message.Payload, "\n")...)
+	}
+}
+
+// versionKey holds the namespace version.
+const versionKey = "cache:version"
+
+// versionRefresh is how long a namespace version is used before being read
+// again, which bounds how long other processes take to follow a Bump.
+const versionRefresh = time.Second
+
+// Version returns the namespace version, zero until the first Bump.
+func (c *Redis) Version(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	if !c.versionAt.IsZero() && time.Since(c.versionAt) < versionRefresh {
+		defer c.mu.Unlock()
+		return c.version, nil
+	}
+	c.mu.Unlock()
+
+	version, err := c.client.Get(ctx, versionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	c.setVersion(version)
+	return version, nil
+}
+
+// Bump increments the namespace version, making every key written under the
+// previous one unreachable.
+func (c *Redis) Bump(ctx context.Context) (int64, error) {
+	version, err := c.client.Incr(ctx, versionKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	c.setVersion(version)
+	return version, nil
+}
+
+func (c *Redis) setVersion(version int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = version
+	c.versionAt = time.Now()
+}
+
+func (c *Redis) Stats() map[string]Stats {
+	return map[string]Stats{"redis": c.metrics.snapshot()}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Tiered serves reads from a local LRU in front of a shared remote cache,
+// filling the LRU from remote hits. Writes and deletions go to both tiers.
+type Tiered struct {
+	local  *LRU
+	remote Cache
+}
+
+// NewTiered returns a Cache reading through local to remote. Deletions made by
+// other processes reach local only if it is subscribed to them (see
+// Redis.Subscribe); the LRU's maxTTL bounds staleness otherwise.
+func NewTiered(local *LRU, remote Cache) *Tiered {
+	return &Tiered{local: local, remote: remote}
+}
+
+func (c *Tiered) Get(ctx context.Context, key, field string) ([]byte, bool, error) {
+	if value, ok, _ := c.local.Get(ctx, key, field); ok {
+		return value, true, nil
+	}
+	value, ok, err := c.remote.Get(ctx, key, field)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	_ = c.local.Set(ctx, key, map[string][]byte{field: value}, 0)
+	return value, true, nil
+}
+
+func (c *Tiered) GetMulti(ctx context.Context, keys []string, field string) ([][]byte, error) {
+	values, _ := c.local.GetMulti(ctx, keys, field)
+	var missing []string
+	var indexes []int
+	for i, value := range values {
+		if value == nil {
+			missing = append(missing, keys[i])
+			indexes = append(indexes, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	fetched, err := c.remote.GetMulti(ctx, missing, field)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range fetched {
+		if value != nil {
+			values[indexes[i]] = value
+			_ = c.local.Set(ctx, missing[i], map[string][]byte{field: value}, 0)
+		}
+	}
+	return values, nil
+}
+
+func (c *Tiered) Set(ctx context.Context, key string, values map[string][]byte, ttl time.Duration, tags ...string) error {
+	if err := c.remote.Set(ctx, key, values, ttl, tags...); err != nil {
+		return err
+	}
+	return c.local.Set(ctx, key, values, ttl, tags...)
+}
+
+// Delete evicts keys locally even when the remote deletion fails, so this
+// process at least does not keep serving them.
+func (c *Tiered) Delete(ctx context.Context, keys ...string) error {
+	c.local.Evict(keys...)
+	return c.remote.Delete(ctx, keys...)
+}
+
+func (c *Tiered) Retire(ctx context.Context, staleFor time.Duration, keys ...string) error {
+	_ = c.local.Retire(ctx, staleFor, keys...)
+	return c.remote.Retire(ctx, staleFor, keys...)
+}
+
+// Invalidate retires the keys tagged remotely, which include keys this process
+// copied locally from remote hits without their tags, and the keys tagged
+// locally, even when the remote tier fails.
+func (c *Tiered) Invalidate(ctx context.Context, staleFor time.Duration, tags ...string) ([]string, error) {
+	local, _ := c.local.Invalidate(ctx, staleFor, tags...)
+	keys, err := c.remote.Invalidate(ctx, staleFor, tags...)
+	_ = c.local.Retire(ctx, staleFor, keys...)
+	if err != nil {
+		return local, err
+	}
+	return keys, nil
+}
+
+// GetStale reads the local tier, then the remote one. Stale remote values are
+// not copied locally.
+func (c *Tiered) GetStale(ctx context.Context, key, field string) ([]byte, bool, error) {
+	if value, ok, _ := c.local.GetStale(ctx, key, field); ok {
+		return value, true, nil
+	}
+	return c.remote.GetStale(ctx, key, field)
+}
+
+func (c *Tiered) Stats() map[string]Stats {
+	stats := c.remote.Stats()
+	for tier, s := range c.local.Stats() {
+		stats[tier] = s
+	}
+	return stats
+}
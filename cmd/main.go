@@ -1,13 +1,17 @@
 package main
 
 import (
-	"blogklert/routes"
+	"blogklert/app"
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -16,35 +20,75 @@ import (
 )
 
 func main() {
+	skipMigrations := flag.Bool("skip-migrations", os.Getenv("SKIP_MIGRATIONS") == "true",
+		"start without applying pending migrations, for deployments that run \"migrate up\" separately")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: main [-skip-migrations]\n       %s\n", strings.TrimPrefix(migrateUsage, "usage: "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	// Load configuration
 	config, err := db.LoadEnvConfig()
 	if err != nil {
 		log.Fatalf("failed to load ENV configuration: %v", err)
 	}
 
-	// Migrate the database
-	migrateCfg := db.MigrateConfig{
-		DBURL: config.DBURL,
+	// Connect to Postgres and Redis and assemble the API
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	startupCtx, cancelStartup := context.WithTimeout(backgroundCtx, 30*time.Second)
+	blog, err := app.New(startupCtx, config, app.Options{})
+	cancelStartup()
+	if err != nil {
+		log.Fatalf("failed to initialize the app: %v", err)
 	}
-	if err := db.Migrate(migrateCfg); err != nil {
+	defer blog.Close()
+
+	// Migrate the database. Replicas booting together wait for each other
+	// on an advisory lock, so this may outlast the startup timeout
+	if *skipMigrations {
+		log.Println("skipping database migrations")
+	} else if err := blog.Migrate(backgroundCtx); err != nil {
 		log.Fatalf("error migrating database: %v", err)
 	}
 
-	// Set up routes and middlewares
-	handler := routes.SetupRoutes(config)
-
 	srv := &http.Server{
 		Addr:           ":8000",
-		Handler:        handler,
+		Handler:        blog.Handler(),
 		ReadTimeout:    30 * time.Second,
 		WriteTimeout:   30 * time.Second,
 		MaxHeaderBytes: 1500,
 		IdleTimeout:    120 * time.Second,
 	}
 
+	// Set up the gRPC server on its own port
+	grpcServer := blog.GRPCServer()
+	grpcListener, err := net.Listen("tcp", config.GRPCAddr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", config.GRPCAddr, err)
+	}
+
 	// Use a wait group to manage graceful shutdown
 	var wg sync.WaitGroup
-	wg.Add(1)
+	wg.Add(3)
+
+	// Retry Redis while it is down, relay outbox events and deliver queued
+	// webhooks in the background
+	go func() {
+		defer wg.Done()
+		blog.Run(backgroundCtx)
+	}()
 
 	go func() {
 		defer wg.Done()
@@ -54,19 +98,41 @@ func main() {
 	}()
 	log.Println("server started on :8000")
 
+	go func() {
+		defer wg.Done()
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Fatalf("grpc serve(): %v", err)
+		}
+	}()
+	log.Printf("gRPC server started on %s", config.GRPCAddr)
+
 	// Wait for interrupt signal to gracefully shut down the server
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
+	stopBackground()
 
 	// Create a context with a timeout for shutdown
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancelShutdown()
 
+	// Stop the gRPC server gracefully, cancelling open streams at the deadline
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("server shutdown failed: %+v", err)
 	}
 
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
+
 	wg.Wait() // Wait for all goroutines to finish before exiting
 	log.Println("server exited gracefully")
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"blogklert/cache"
+	"blogklert/db"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+const migrateUsage = "usage: main migrate up|down|status|redo|create NAME"
+
+// migrationTemplate is the body of a migration written by migrate create.
+const migrationTemplate = `-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+`
+
+// runMigrate runs a migrate subcommand against the database at DB_URL:
+//
+//	up      applies every pending migration
+//	down    rolls back the latest migration
+//	status  lists the migrations and when they were applied
+//	redo    rolls back the latest migration and applies it again
+//	create  writes an empty migration for the DB_URL driver to the source tree
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	dataSourceName := os.Getenv("DB_URL")
+	driver := db.Driver(dataSourceName)
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		path, err := createMigration(db.MigrationsDir(driver), args[1], time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s; rebuild the binary to embed it\n", path)
+		return nil
+	}
+	switch {
+	case len(args) != 1:
+		return errors.New(migrateUsage)
+	case args[0] != "up" && args[0] != "down" && args[0] != "status" && args[0] != "redo":
+		return errors.New(migrateUsage)
+	}
+
+	if dataSourceName == "" {
+		return errors.New("database URL (DB_URL) environment variable is not set")
+	}
+	conn, err := db.OpenDB(ctx, dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	migrator, err := db.NewMigrator(conn, driver)
+	if err != nil {
+		return err
+	}
+
+	var results []*goose.MigrationResult
+	switch args[0] {
+	case "up":
+		results, err = migrator.Up(ctx)
+	case "down":
+		var result *goose.MigrationResult
+		result, err = migrator.Down(ctx)
+		results = append(results, result)
+	case "redo":
+		var down, up *goose.MigrationResult
+		if down, err = migrator.Down(ctx); err == nil {
+			results = append(results, down)
+			up, err = migrator.UpByOne(ctx)
+			results = append(results, up)
+		}
+	case "status":
+		return printStatus(ctx, migrator)
+	}
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		return errors.New("no migrations to roll back")
+	}
+
+	applied := 0
+	for _, result := range results {
+		if result != nil && result.Error == nil {
+			fmt.Printf("%-4s %s (%s)\n", result.Direction, db.MigrationName(result.Source), result.Duration.Round(time.Millisecond))
+			applied++
+		}
+	}
+	if applied > 0 {
+		flushCache(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if applied == 0 {
+		fmt.Println("no migrations to run")
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, migrator *goose.Provider) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-24s %s\n", "Applied At", "Migration")
+	for _, status := range statuses {
+		appliedAt := "Pending"
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.UTC().Format(time.DateTime)
+		}
+		fmt.Printf("%-24s %s\n", appliedAt, db.MigrationName(status.Source))
+	}
+	return nil
+}
+
+// flushCache discards the data the running instances cached under the
+// previous schema, when Redis is configured.
+func flushCache(ctx context.Context) {
+	client, _, err := db.OpenRedis(ctx, db.LoadRedisConfig())
+	if err != nil || client == nil {
+		return
+	}
+	defer client.Close()
+	version, err := cache.NewRedis(client).Bump(ctx)
+	if err != nil {
+		fmt.Printf("failed to flush the cache: %v\n", err)
+		return
+	}
+	fmt.Printf("cache flushed: namespace version %d\n", version)
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// createMigration writes an empty migration named after name to dir,
+// versioned by the time it was created like the existing ones.
+func createMigration(dir, name string, now time.Time) (string, error) {
+	slug := strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", errors.New("migration name must contain letters or digits")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+slug+".sql")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(migrationTemplate); err != nil {
+		return "", err
+	}
+	return path, nil
+}
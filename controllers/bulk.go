@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"blogklert/models"
+	"blogklert/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// maxBulkOperations caps the number of operations in a single bulk request.
+const maxBulkOperations = 100
+
+// Bulk execution modes.
+const (
+	// bulkAtomic commits all operations or none of them.
+	bulkAtomic = "atomic"
+	// bulkBestEffort commits every operation that succeeds.
+	bulkBestEffort = "best_effort"
+)
+
+// errBulkFailed rolls back the operations of a failed bulk request.
+var errBulkFailed = errors.New("bulk operation failed")
+
+type bulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+type bulkOperation struct {
+	Op      string      `json:"op"`
+	ID      string      `json:"id,omitempty"`
+	IfMatch string      `json:"if_match,omitempty"`
+	Post    models.Post `json:"post"`
+}
+
+type bulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	ETag   string `json:"etag,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Mode      string       `json:"mode"`
+	Committed bool         `json:"committed"`
+	Results   []bulkResult `json:"results"`
+}
+
+// BulkPosts executes a list of create, update and delete operations in a single
+// database transaction and reports a result for each operation.
+func (h *Handlers) BulkPosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = bulkAtomic
+	}
+	if req.Mode != bulkAtomic && req.Mode != bulkBestEffort {
+		http.Error(w, "mode must be atomic or best_effort", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+		http.Error(w, fmt.Sprintf("operations must contain between 1 and %d items", maxBulkOperations), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]bulkResult, len(req.Operations))
+	failed := -1
+	err := h.Posts.Store.WithTx(ctx, func(tx store.PostStore) error {
+		for i, op := range req.Operations {
+			if req.Mode == bulkAtomic && failed >= 0 {
+				results[i] = bulkResult{Index: i, Op: op.Op, ID: op.ID, Status: http.StatusFailedDependency,
+					Error: fmt.Sprintf("not attempted because operation %d failed", failed)}
+				continue
+			}
+			results[i] = h.runBulkOperation(ctx, tx, req.Mode, op)
+			results[i].Index = i
+			if results[i].Status >= http.StatusBadRequest && failed < 0 {
+				failed = i
+			}
+		}
+		if req.Mode == bulkAtomic && failed >= 0 {
+			return errBulkFailed
+		}
+		return nil
+	})
+
+	resp := bulkResponse{Mode: req.Mode, Results: results}
+	if req.Mode == bulkAtomic && failed >= 0 {
+		for i := 0; i < failed; i++ {
+			results[i] = bulkResult{Index: i, Op: results[i].Op, ID: results[i].ID, Status: http.StatusFailedDependency,
+				Error: fmt.Sprintf("rolled back because operation %d failed", failed)}
+		}
+		status := http.StatusUnprocessableEntity
+		if results[failed].Status >= http.StatusInternalServerError {
+			status = http.StatusInternalServerError
+		}
+		respondData(w, r, resp, status)
+		return
+	}
+
+	if err != nil {
+		h.httpError(w, "Failed to commit bulk operations", http.StatusInternalServerError, err)
+		return
+	}
+	resp.Committed = true
+
+	var touched []string
+	for _, result := range results {
+		if result.Status < http.StatusBadRequest && result.ID != "" {
+			touched = append(touched, result.ID)
+		}
+	}
+	h.invalidatePostCache(ctx, touched...)
+
+	respondData(w, r, resp, http.StatusOK)
+}
+
+// runBulkOperation applies op inside tx. In best-effort mode each operation
+// runs in a nested transaction so a failure does not abort the whole one.
+func (h *Handlers) runBulkOperation(ctx context.Context, tx store.PostStore, mode string, op bulkOperation) bulkResult {
+	if mode == bulkAtomic {
+		return h.applyBulkOperation(ctx, tx, op)
+	}
+
+	var result bulkResult
+	err := tx.WithTx(ctx, func(tx store.PostStore) error {
+		result = h.applyBulkOperation(ctx, tx, op)
+		if result.Status >= http.StatusBadRequest {
+			return errBulkFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkFailed) {
+		return h.bulkFailure(op, http.StatusInternalServerError, err)
+	}
+	return result
+}
+
+// applyBulkOperation validates and executes a single bulk operation.
+func (h *Handlers) applyBulkOperation(ctx context.Context, tx store.PostStore, op bulkOperation) bulkResult {
+	if op.Op == "create" {
+		post := op.Post
+		h.sanitizePost(&post)
+		if err := validatePost(post); err != nil {
+			return h.bulkFailure(op, http.StatusBadRequest, err)
+		}
+		created, err := insertPost(ctx, tx, post)
+		if err != nil {
+			return h.bulkFailure(op, http.StatusInternalServerError, err)
+		}
+		return bulkResult{Op: op.Op, ID: created.ID.String(), Status: http.StatusCreated, ETag: postETag(created.Version)}
+	}
+
+	if op.Op != "update" && op.Op != "delete" {
+		return h.bulkFailure(op, http.StatusBadRequest, fmt.Errorf("unsupported op %q", op.Op))
+	}
+
+	id, err := uuid.Parse(op.ID)
+	if err != nil {
+		return h.bulkFailure(op, http.StatusBadRequest, errors.New("invalid id"))
+	}
+
+	if op.Op == "delete" {
+		expected, err := h.ifMatchVersion(ctx, tx, op.IfMatch, id)
+		if err == nil {
+			err = tx.Delete(ctx, id, expected)
+		}
+		if err != nil {
+			return h.bulkFailure(op, writeErrorStatus(err), err)
+		}
+		return bulkResult{Op: op.Op, ID: id.String(), Status: http.StatusNoContent}
+	}
+
+	post := op.Post
+	h.sanitizePost(&post)
+	if err := validatePost(post); err != nil {
+		return h.bulkFailure(op, http.StatusBadRequest, err)
+	}
+	expected, err := h.ifMatchVersion(ctx, tx, op.IfMatch, id)
+	if err != nil {
+		return h.bulkFailure(op, writeErrorStatus(err), err)
+	}
+	post.ID = id
+	version, err := tx.Update(ctx, post, expected)
+	if err != nil {
+		return h.bulkFailure(op, writeErrorStatus(err), err)
+	}
+	return bulkResult{Op: op.Op, ID: id.String(), Status: http.StatusOK, ETag: postETag(version)}
+}
+
+func (h *Handlers) bulkFailure(op bulkOperation, status int, err error) bulkResult {
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		h.Logger.Printf("bulk %s failed: %v", op.Op, err)
+		message = "internal error"
+	}
+	return bulkResult{Op: op.Op, ID: op.ID, Status: status, Error: message}
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBulkPosts(t *testing.T) {
+	const (
+		create  = `{"op":"create","post":{"title":"New","excerpt":"An excerpt","body":"A body"}}`
+		invalid = `{"op":"create","post":{"title":"No body","excerpt":"An excerpt"}}`
+		missing = `{"op":"delete","id":"00000000-0000-0000-0000-000000000000","if_match":"\"v1\""}`
+	)
+	// Operations on the existing post refer to it as {id}.
+	update := func(ifMatch string) string {
+		return `{"op":"update","id":"{id}","if_match":"\"` + ifMatch + `\"","post":{"title":"Updated","excerpt":"An excerpt","body":"A body"}}`
+	}
+	remove := `{"op":"delete","id":"{id}"}`
+
+	tests := []struct {
+		name          string
+		mode          string
+		operations    []string
+		wantStatus    int
+		wantResults   []int
+		wantPosts     int
+		wantTitle     string
+		wantCommitted bool
+	}{
+		{
+			name:          "Atomic success",
+			operations:    []string{create, update("v1")},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusCreated, http.StatusOK},
+			wantPosts:     2,
+			wantTitle:     "Updated",
+			wantCommitted: true,
+		},
+		{
+			name:        "Atomic failure rolls back earlier operations",
+			operations:  []string{create, update("v1"), update("v1"), create},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantResults: []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusPreconditionFailed, http.StatusFailedDependency},
+			wantPosts:   1,
+			wantTitle:   "Original",
+		},
+		{
+			name:        "Atomic validation failure",
+			mode:        bulkAtomic,
+			operations:  []string{invalid, create},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantResults: []int{http.StatusBadRequest, http.StatusFailedDependency},
+			wantPosts:   1,
+			wantTitle:   "Original",
+		},
+		{
+			name:          "Best effort keeps successful operations",
+			mode:          bulkBestEffort,
+			operations:    []string{create, update("v7"), missing, invalid, update("v1")},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusCreated, http.StatusPreconditionFailed, http.StatusNotFound, http.StatusBadRequest, http.StatusOK},
+			wantPosts:     2,
+			wantTitle:     "Updated",
+			wantCommitted: true,
+		},
+		{
+			name:          "Best effort after a failed operation on the same post",
+			mode:          bulkBestEffort,
+			operations:    []string{update("v1"), update("v1"), remove},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusOK, http.StatusPreconditionFailed, http.StatusNoContent},
+			wantPosts:     0,
+			wantCommitted: true,
+		},
+		{
+			name:       "Unknown mode",
+			mode:       "eventual",
+			operations: []string{create},
+			wantStatus: http.StatusBadRequest,
+			wantPosts:  1,
+			wantTitle:  "Original",
+		},
+		{
+			name:       "No operations",
+			wantStatus: http.StatusBadRequest,
+			wantPosts:  1,
+			wantTitle:  "Original",
+		},
+		{
+			name:       "Too many operations",
+			operations: repeat(create, maxBulkOperations+1),
+			wantStatus: http.StatusBadRequest,
+			wantPosts:  1,
+			wantTitle:  "Original",
+		},
+		{
+			name:          "As many operations as allowed",
+			operations:    repeat(create, maxBulkOperations),
+			wantStatus:    http.StatusOK,
+			wantResults:   repeatStatus(http.StatusCreated, maxBulkOperations),
+			wantPosts:     maxBulkOperations + 1,
+			wantTitle:     "Original",
+			wantCommitted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, router := newTestHandlers(t, PostConfig{})
+			post := createTestPost(t, h.Posts.Store, "Original")
+
+			operations := strings.ReplaceAll(strings.Join(tt.operations, ","), "{id}", post.ID.String())
+			body := `{"mode":"` + tt.mode + `","operations":[` + operations + `]}`
+			rec := serve(router, "POST", "/v1/posts/bulk", body, map[string]string{"Content-Type": "application/json"})
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantResults != nil {
+				var resp bulkResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				if resp.Committed != tt.wantCommitted {
+					t.Errorf("committed = %v, want %v", resp.Committed, tt.wantCommitted)
+				}
+				if len(resp.Results) != len(tt.wantResults) {
+					t.Fatalf("got %d results, want %d", len(resp.Results), len(tt.wantResults))
+				}
+				for i, result := range resp.Results {
+					if result.Index != i || result.Status != tt.wantResults[i] {
+						t.Errorf("result %d = %+v, want status %d", i, result, tt.wantResults[i])
+					}
+				}
+			}
+
+			posts, err := h.Posts.Store.List(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(posts) != tt.wantPosts {
+				t.Errorf("got %d posts, want %d", len(posts), tt.wantPosts)
+			}
+			if tt.wantTitle == "" {
+				return
+			}
+			stored, err := h.Posts.Store.Get(context.Background(), post.ID, nil)
+			if err != nil || stored.Title != tt.wantTitle {
+				t.Errorf("existing post = %q, %v; want title %q", stored.Title, err, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func repeat(operation string, n int) []string {
+	operations := make([]string, n)
+	for i := range operations {
+		operations[i] = operation
+	}
+	return operations
+}
+
+func repeatStatus(status, n int) []int {
+	statuses := make([]int, n)
+	for i := range statuses {
+		statuses[i] = status
+	}
+	return statuses
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// cacheFlusher is implemented by caches namespaced by a version.
+type cacheFlusher interface {
+	Flush(ctx context.Context) (int64, error)
+}
+
+// cacheInvalidation is the request body for purging cache tags.
+type cacheInvalidation struct {
+	Tags []string `json:"tags"`
+}
+
+// SetupCacheRoutes mounts the cache admin API at /admin/cache.
+func (h *Handlers) SetupCacheRoutes(r *mux.Router) {
+	adminRouter := r.PathPrefix("/admin/cache").Subrouter()
+	adminRouter.HandleFunc("/invalidate", h.InvalidateCache).Methods("POST")
+	adminRouter.HandleFunc("/flush", h.FlushCache).Methods("POST")
+}
+
+// InvalidateCache purges every cache entry tagged with one of the given tags:
+// "posts" for the listing, "post:<id>" for a post.
+func (h *Handlers) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	var input cacheInvalidation
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if len(input.Tags) == 0 {
+		err := errors.New("tags is required")
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	keys, err := h.Posts.Cache.Invalidate(r.Context(), 0, input.Tags...)
+	if err != nil {
+		h.httpError(w, "Failed to invalidate cache", http.StatusServiceUnavailable, err)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	respondJSON(w, map[string][]string{"keys": keys}, http.StatusOK)
+}
+
+// FlushCache bumps the cache namespace version, discarding every entry at
+// once. Deploys and migrations that change what is cached call it.
+func (h *Handlers) FlushCache(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := h.Posts.Cache.(cacheFlusher)
+	if !ok {
+		http.Error(w, "Caching is disabled", http.StatusNotImplemented)
+		return
+	}
+	version, err := flusher.Flush(r.Context())
+	if err != nil {
+		h.httpError(w, "Failed to flush cache", http.StatusServiceUnavailable, err)
+		return
+	}
+	respondJSON(w, map[string]int64{"version": version}, http.StatusOK)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"blogklert/store"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// errPreconditionRequired is returned when If-Match is required but missing.
+var errPreconditionRequired = errors.New("If-Match header is required")
+
+// postETag returns the strong entity tag for a post version.
+func postETag(version int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// ifMatch holds the parsed entity tags of an If-Match header.
+type ifMatch struct {
+	any   bool
+	etags []string
+}
+
+// parseIfMatch parses an If-Match header value. Weak tags never match, as
+// If-Match uses the strong comparison function.
+func parseIfMatch(header string) ifMatch {
+	var cond ifMatch
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "*":
+			cond.any = true
+		case strings.HasPrefix(tag, "W/"):
+		case tag != "":
+			cond.etags = append(cond.etags, tag)
+		}
+	}
+	return cond
+}
+
+func (c ifMatch) matches(etag string) bool {
+	if c.any {
+		return true
+	}
+	for _, tag := range c.etags {
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match precondition for a write to the post.
+// It returns the version the write must be conditioned on, or nil when the
+// request is unconditional.
+func (h *Handlers) checkIfMatch(ctx context.Context, r *http.Request, id uuid.UUID) (*int, error) {
+	return h.ifMatchVersion(ctx, h.Posts.Store, r.Header.Get("If-Match"), id)
+}
+
+// ifMatchVersion evaluates an If-Match header value against the stored post.
+func (h *Handlers) ifMatchVersion(ctx context.Context, s store.PostStore, header string, id uuid.UUID) (*int, error) {
+	if header == "" {
+		if h.Posts.RequireIfMatch {
+			return nil, errPreconditionRequired
+		}
+		return nil, nil
+	}
+
+	version, err := s.Version(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !parseIfMatch(header).matches(postETag(version)) {
+		return nil, store.ErrVersionMismatch
+	}
+	return &version, nil
+}
+
+// writeErrorStatus returns the HTTP status for an error from a post write.
+func writeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, errPreconditionRequired):
+		return http.StatusPreconditionRequired
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError maps storage and precondition errors from a post write to an HTTP response.
+func (h *Handlers) writeError(w http.ResponseWriter, message string, err error) {
+	switch status := writeErrorStatus(err); status {
+	case http.StatusNotFound:
+		h.httpError(w, "Post not found", status, err)
+	case http.StatusPreconditionFailed:
+		h.httpError(w, "Post has been modified", status, err)
+	case http.StatusPreconditionRequired:
+		h.httpError(w, "If-Match header is required", status, err)
+	default:
+		h.httpError(w, message, status, err)
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"blogklert/store"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		want   bool
+	}{
+		{header: `"v1"`, etag: `"v1"`, want: true},
+		{header: `"v1"`, etag: `"v2"`, want: false},
+		{header: `"v1", "v2"`, etag: `"v2"`, want: true},
+		{header: ` "v1" ,"v2" `, etag: `"v1"`, want: true},
+		{header: `*`, etag: `"v9"`, want: true},
+		{header: `W/"v1"`, etag: `"v1"`, want: false},
+		{header: `W/"v1", "v1"`, etag: `"v1"`, want: true},
+		{header: `v1`, etag: `"v1"`, want: false},
+		{header: `,`, etag: `"v1"`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := parseIfMatch(tt.header).matches(tt.etag); got != tt.want {
+				t.Errorf("parseIfMatch(%q).matches(%q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: fmt.Errorf("post x: %w", store.ErrNotFound), want: http.StatusNotFound},
+		{err: store.ErrVersionMismatch, want: http.StatusPreconditionFailed},
+		{err: errPreconditionRequired, want: http.StatusPreconditionRequired},
+		{err: errors.New("connection reset"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := writeErrorStatus(tt.err); got != tt.want {
+				t.Errorf("writeErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	requests := []struct {
+		method      string
+		contentType string
+		body        string
+	}{
+		{method: "PUT", contentType: "application/json", body: `{"title":"New","excerpt":"New excerpt","body":"New body"}`},
+		{method: "PATCH", contentType: mergePatchMediaType, body: `{"title":"New"}`},
+		{method: "DELETE"},
+	}
+	tests := []struct {
+		name           string
+		ifMatch        string
+		requireIfMatch bool
+		// missing targets a post that does not exist.
+		missing    bool
+		wantStatus int
+	}{
+		{name: "Unconditional", wantStatus: http.StatusNoContent},
+		{name: "Current version", ifMatch: `"v1"`, wantStatus: http.StatusNoContent},
+		{name: "One of several tags", ifMatch: `"v0", "v1"`, wantStatus: http.StatusNoContent},
+		{name: "Any version", ifMatch: `*`, wantStatus: http.StatusNoContent},
+		{name: "Stale version", ifMatch: `"v0"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Weak tag", ifMatch: `W/"v1"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Required and missing", requireIfMatch: true, wantStatus: http.StatusPreconditionRequired},
+		{name: "Required and present", requireIfMatch: true, ifMatch: `"v1"`, wantStatus: http.StatusNoContent},
+		{name: "Missing post", ifMatch: `"v1"`, missing: true, wantStatus: http.StatusNotFound},
+	}
+	for _, req := range requests {
+		for _, tt := range tests {
+			t.Run(req.method+"/"+tt.name, func(t *testing.T) {
+				h, router := newTestHandlers(t, PostConfig{RequireIfMatch: tt.requireIfMatch})
+				post := createTestPost(t, h.Posts.Store, "Original")
+				target := "/v1/posts?id=" + post.ID.String()
+				if tt.missing {
+					target = "/v1/posts?id=00000000-0000-0000-0000-000000000000"
+				}
+
+				header := map[string]string{}
+				if req.contentType != "" {
+					header["Content-Type"] = req.contentType
+				}
+				if tt.ifMatch != "" {
+					header["If-Match"] = tt.ifMatch
+				}
+				rec := serve(router, req.method, target, req.body, header)
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+				if req.method != "DELETE" && rec.Code == http.StatusNoContent {
+					if got := rec.Header().Get("ETag"); got != `"v2"` {
+						t.Errorf("ETag = %s, want \"v2\"", got)
+					}
+				}
+
+				// Rejected writes leave the post unchanged.
+				version, err := h.Posts.Store.Version(context.Background(), post.ID)
+				switch {
+				case rec.Code == http.StatusNoContent && req.method == "DELETE":
+					if !errors.Is(err, store.ErrNotFound) {
+						t.Errorf("Version() after delete error = %v, want ErrNotFound", err)
+					}
+				case rec.Code == http.StatusNoContent:
+					if version != 2 {
+						t.Errorf("version = %d, want 2", version)
+					}
+				case err != nil || version != 1:
+					t.Errorf("Version() = %d, %v; want 1", version, err)
+				}
+			})
+		}
+	}
+}
+
+func TestGetPostETag(t *testing.T) {
+	h, router := newTestHandlers(t, PostConfig{})
+	post := createTestPost(t, h.Posts.Store, "Original")
+	target := "/v1/posts?id=" + post.ID.String()
+
+	rec := serve(router, "GET", target, "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("GET = %d with ETag %s, want 200 with \"v1\"", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// The ETag of a read is accepted by If-Match on the next write.
+	rec = serve(router, "PATCH", target, `{"title":"New"}`, map[string]string{"Content-Type": mergePatchMediaType, "If-Match": rec.Header().Get("ETag")})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(router, "GET", target, "", nil)
+	if got := rec.Header().Get("ETag"); got != `"v2"` {
+		t.Errorf("ETag after update = %s, want \"v2\"", got)
+	}
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"blogklert/breaker"
+	"blogklert/middlewares"
+	"blogklert/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// Post change event types. Posts have no draft state, so a post is published
+// as it is created and postPublished is emitted right after postCreated.
+const (
+	postCreated   = store.Created
+	postPublished = "post.published"
+	postUpdated   = store.Updated
+	postDeleted   = store.Deleted
+)
+
+const (
+	// postEventsStream is the Redis stream holding post change events.
+	postEventsStream = "posts:events"
+	// postEventsMaxLen bounds the stream; older events can no longer be resumed from.
+	postEventsMaxLen = 10000
+	// heartbeatInterval is how often idle event streams receive a comment line.
+	heartbeatInterval = 15 * time.Second
+	// subscriberBuffer is how many events a slow client may lag behind before
+	// it is disconnected and has to resume with Last-Event-ID.
+	subscriberBuffer = 64
+)
+
+// EventsConfig holds the limits applied to event stream connections.
+type EventsConfig struct {
+	// MaxConnections caps the number of open streams.
+	MaxConnections int
+	// MaxConnectionsPerClient caps the number of open streams per client IP.
+	MaxConnectionsPerClient int
+	// MaxDuration closes streams after this long; clients reconnect with Last-Event-ID.
+	MaxDuration time.Duration
+}
+
+// postEvent is the data of a post change event.
+type postEvent struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id"`
+	Version int       `json:"version,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// publishPostEvent appends a change event to the Redis stream. It runs as an
+// outbox handler, so a failure is retried. Without Redis there is no stream
+// and events are dropped.
+func (h *Handlers) publishPostEvent(ctx context.Context, event postEvent) error {
+	if h.Redis == nil {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event for post %s: %w", event.Type, event.ID, err)
+	}
+	err = h.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: postEventsStream,
+		MaxLen: postEventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": event.Type, "data": data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("error publishing %s event for post %s: %w", event.Type, event.ID, err)
+	}
+	return nil
+}
+
+// SetupEventRoutes mounts the post change event stream at /events.
+func (h *Handlers) SetupEventRoutes(router *mux.Router) {
+	limiter := middlewares.NewConnLimiter(h.Events.MaxConnections, h.Events.MaxConnectionsPerClient)
+	router.Handle("/events", limiter.Limit(h.streamPostEvents(h.Events.MaxDuration))).Methods("GET")
+}
+
+// streamPostEvents serves post change events as Server-Sent Events. Clients
+// resume after a disconnect by sending the last event ID they received in the
+// Last-Event-ID header (or the lastEventId query parameter). The stream lives
+// in Redis, so it is unavailable while Redis is.
+func (h *Handlers) streamPostEvents(maxDuration time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Redis == nil {
+			http.Error(w, "Event stream is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx := r.Context()
+		if maxDuration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, maxDuration)
+			defer cancel()
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+		if lastID != "" {
+			if _, ok := parseStreamID(lastID); !ok {
+				http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Subscribe before catching up so no event falls between the two.
+		events, unsubscribe := h.hub.subscribe()
+		defer unsubscribe()
+
+		var backlog []redis.XMessage
+		var err error
+		if lastID == "" {
+			lastID, err = latestStreamID(ctx, h.Redis)
+		} else {
+			backlog, err = h.Redis.XRange(ctx, postEventsStream, "("+lastID, "+").Result()
+		}
+		if errors.Is(err, breaker.ErrOpen) {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Event stream is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			h.httpError(w, "Failed to read events", http.StatusServiceUnavailable, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		stream := &eventWriter{w: w, rc: http.NewResponseController(w)}
+		stream.write(fmt.Sprintf("retry: %d\n\n", 3*time.Second/time.Millisecond))
+		if len(backlog) > 0 && eventsTrimmedAfter(ctx, h.Redis, lastID) {
+			stream.write("event: reset\ndata: {}\n\n")
+		}
+		for _, message := range backlog {
+			stream.event(message)
+			lastID = message.ID
+		}
+		if stream.flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-events:
+				if !ok {
+					// Dropped for lagging behind; the client resumes from lastID.
+					return
+				}
+				if !streamIDAfter(message.ID, lastID) {
+					continue
+				}
+				stream.event(message)
+				lastID = message.ID
+			case <-heartbeat.C:
+				stream.write(": heartbeat\n\n")
+			}
+			if stream.flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventWriter writes SSE frames, extending the server's write deadline for
+// each one so long-lived streams outlive http.Server.WriteTimeout.
+type eventWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	err error
+}
+
+func (e *eventWriter) write(frame string) {
+	if e.err != nil {
+		return
+	}
+	if err := e.rc.SetWriteDeadline(time.Now().Add(heartbeatInterval * 2)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		e.err = err
+		return
+	}
+	_, e.err = e.w.Write([]byte(frame))
+}
+
+func (e *eventWriter) event(message redis.XMessage) {
+	eventType, _ := message.Values["type"].(string)
+	data, _ := message.Values["data"].(string)
+	e.write("id: " + message.ID + "\nevent: " + eventType + "\ndata: " + data + "\n\n")
+}
+
+func (e *eventWriter) flush() error {
+	if e.err == nil {
+		e.err = e.rc.Flush()
+	}
+	return e.err
+}
+
+// latestStreamID returns the ID of the newest event, or "0-0" when there is none.
+func latestStreamID(ctx context.Context, client *redis.Client) (string, error) {
+	messages, err := client.XRevRangeN(ctx, postEventsStream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// eventsTrimmedAfter reports whether events following lastID may have been
+// trimmed from the stream, in which case the client must refetch its state.
+func eventsTrimmedAfter(ctx context.Context, client *redis.Client, lastID string) bool {
+	first, err := client.XRangeN(ctx, postEventsStream, "-", "+", 1).Result()
+	if err != nil || len(first) == 0 {
+		return false
+	}
+	length, err := client.XLen(ctx, postEventsStream).Result()
+	return err == nil && length >= postEventsMaxLen && streamIDAfter(first[0].ID, lastID)
+}
+
+// parseStreamID splits a Redis stream ID into its millisecond and sequence parts.
+func parseStreamID(id string) ([2]uint64, bool) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return [2]uint64{}, false
+	}
+	a, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return [2]uint64{}, false
+	}
+	b, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return [2]uint64{}, false
+	}
+	return [2]uint64{a, b}, true
+}
+
+// streamIDAfter reports whether stream ID a comes after b.
+func streamIDAfter(a, b string) bool {
+	x, _ := parseStreamID(a)
+	y, _ := parseStreamID(b)
+	return x[0] > y[0] || (x[0] == y[0] && x[1] > y[1])
+}
+
+// eventHub tails the Redis stream once per Handlers and fans events out to
+// every open event stream, so clients do not each hold a Redis connection.
+// It stops when ctx is done, ending the open streams.
+type eventHub struct {
+	ctx    context.Context
+	redis  *redis.Client
+	logger *log.Logger
+	start  sync.Once
+	mu     sync.Mutex
+	subs   map[chan redis.XMessage]struct{}
+	// stopped is set once run has returned; later subscribers get a closed channel.
+	stopped bool
+}
+
+func newEventHub(ctx context.Context, client *redis.Client, logger *log.Logger) *eventHub {
+	return &eventHub{ctx: ctx, redis: client, logger: logger, subs: make(map[chan redis.XMessage]struct{})}
+}
+
+func (h *eventHub) subscribe() (<-chan redis.XMessage, func()) {
+	// Resolve the starting point before the first subscriber resolves its own,
+	// so the hub never starts after an event that subscriber expects.
+	h.start.Do(func() {
+		lastID, err := latestStreamID(h.ctx, h.redis)
+		if err != nil {
+			lastID = "$"
+		}
+		go h.run(h.ctx, lastID)
+	})
+
+	ch := make(chan redis.XMessage, subscriberBuffer)
+	h.mu.Lock()
+	if h.stopped {
+		close(ch)
+	} else {
+		h.subs[ch] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// broadcast delivers message to every subscriber, dropping the ones whose
+// buffer is full.
+func (h *eventHub) broadcast(message redis.XMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- message:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *eventHub) run(ctx context.Context, lastID string) {
+	defer h.stop()
+	for {
+		if lastID == "$" {
+			if id, err := latestStreamID(ctx, h.redis); err == nil {
+				lastID = id
+			}
+		}
+
+		streams, err := h.redis.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{postEventsStream, lastID},
+			Count:   100,
+			Block:   heartbeatInterval,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, breaker.ErrOpen) {
+				h.logger.Printf("error reading post events: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				h.broadcast(message)
+				lastID = message.ID
+			}
+		}
+	}
+}
+
+// stop ends every open stream and turns away later subscribers.
+func (h *eventHub) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
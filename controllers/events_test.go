@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestEventHubStops(t *testing.T) {
+	// Nothing listens on the port, so every read fails and is retried.
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := newEventHub(ctx, client, log.New(io.Discard, "", 0))
+
+	events, unsubscribe := hub.subscribe()
+	defer unsubscribe()
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("received an event, want the stream closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hub kept running after its context was cancelled")
+	}
+
+	// Later subscribers are turned away at once.
+	late, unsubscribeLate := hub.subscribe()
+	defer unsubscribeLate()
+	if _, ok := <-late; ok {
+		t.Error("received an event after the hub stopped")
+	}
+}
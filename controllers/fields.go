@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"blogklert/models"
+	"blogklert/store"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// postFields lists every selectable post field in column order.
+var postFields = projection{"id", "slug", "title", "excerpt", "body", "created_at", "updated_at", "version"}
+
+// summaryFields is the default projection for post listings; it leaves out the body.
+var summaryFields = projection{"id", "slug", "title", "excerpt", "created_at", "updated_at", "version"}
+
+// projection is an ordered subset of postFields.
+type projection []string
+
+// parseFields reads the fields= query parameter, falling back to defaults when
+// it is absent. The id is always included.
+func parseFields(r *http.Request, defaults projection) (projection, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return defaults, nil
+	}
+
+	requested := map[string]bool{"id": true}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !postFields.has(name) {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		requested[name] = true
+	}
+
+	var fields projection
+	for _, name := range postFields {
+		if requested[name] {
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func (p projection) has(name string) bool {
+	for _, field := range p {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// key identifies the projection in cache keys.
+func (p projection) key() string {
+	return strings.Join(p, ",")
+}
+
+// columns returns the columns to select: the projection plus the fields
+// needed to compute cache validators.
+func (p projection) columns() projection {
+	var columns projection
+	for _, name := range postFields {
+		if p.has(name) || name == "updated_at" || name == "version" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// projectedPost encodes only the projected fields of a post, in column order.
+type projectedPost struct {
+	post   models.Post
+	fields projection
+}
+
+func (p projectedPost) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range p.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(store.Field(&p.post, name))
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`"` + name + `":`)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// project wraps posts so they encode with only the projected fields. An empty
+// listing encodes as an empty array.
+func project(posts []models.Post, fields projection) []projectedPost {
+	projected := make([]projectedPost, len(posts))
+	for i, post := range posts {
+		projected[i] = projectedPost{post: post, fields: fields}
+	}
+	return projected
+}
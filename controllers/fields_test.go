@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"blogklert/cache"
+	"blogklert/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    projection
+		wantErr bool
+	}{
+		{name: "Absent", query: "", want: summaryFields},
+		{name: "ID is always included", query: "fields=title", want: projection{"id", "title"}},
+		{name: "Column order", query: "fields=body,title,id", want: projection{"id", "title", "body"}},
+		{name: "Spaces and empty names", query: "fields=title,%20excerpt,,", want: projection{"id", "title", "excerpt"}},
+		{name: "Duplicates", query: "fields=title,title", want: projection{"id", "title"}},
+		{name: "Every field", query: "fields=id,slug,title,excerpt,body,created_at,updated_at,version", want: postFields},
+		{name: "Unknown field", query: "fields=title,author", wantErr: true},
+		{name: "Wrong case", query: "fields=Title", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/posts?"+tt.query, nil)
+			got, err := parseFields(req, summaryFields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectionColumns(t *testing.T) {
+	tests := []struct {
+		fields projection
+		want   projection
+	}{
+		{fields: projection{"id", "title"}, want: projection{"id", "title", "updated_at", "version"}},
+		{fields: summaryFields, want: summaryFields},
+		{fields: postFields, want: postFields},
+	}
+	for _, tt := range tests {
+		if got := tt.fields.columns(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v.columns() = %v, want %v", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestProjectedPost(t *testing.T) {
+	post := models.Post{ID: uuid.MustParse("0f8e2a1c-5b7d-4c3e-9a6f-1d2b3c4d5e6f"), Title: `"Quoted"`, Body: "Body", Version: 2, UpdatedAt: time.Now()}
+	tests := []struct {
+		fields projection
+		want   string
+	}{
+		{fields: projection{"id", "title"}, want: `{"id":"0f8e2a1c-5b7d-4c3e-9a6f-1d2b3c4d5e6f","title":"\"Quoted\""}`},
+		{fields: projection{"id", "version"}, want: `{"id":"0f8e2a1c-5b7d-4c3e-9a6f-1d2b3c4d5e6f","version":2}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(projectedPost{post: post, fields: tt.fields})
+		if err != nil || string(got) != tt.want {
+			t.Errorf("Marshal(%v) = %s, %v; want %s", tt.fields, got, err, tt.want)
+		}
+	}
+	if got, _ := json.Marshal(project(nil, summaryFields)); string(got) != "[]" {
+		t.Errorf("empty listing = %s, want []", got)
+	}
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		// wantKeys are the members of each returned post.
+		wantKeys []string
+	}{
+		{name: "Listing summary", target: "/v1/posts", wantStatus: http.StatusOK, wantKeys: summaryFields},
+		{name: "Listing with fields", target: "/v1/posts?fields=title,body", wantStatus: http.StatusOK, wantKeys: []string{"id", "title", "body"}},
+		{name: "Post", target: "/v1/posts?id={id}", wantStatus: http.StatusOK, wantKeys: postFields},
+		{name: "Post with fields", target: "/v1/posts?id={id}&fields=excerpt", wantStatus: http.StatusOK, wantKeys: []string{"id", "excerpt"}},
+		{name: "Unknown field", target: "/v1/posts?fields=author", wantStatus: http.StatusBadRequest},
+		{name: "Unknown field of a post", target: "/v1/posts?id={id}&fields=author", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, router := newTestHandlers(t, PostConfig{})
+			post := createTestPost(t, h.Posts.Store, "Title")
+
+			rec := serve(router, "GET", replaceID(tt.target, post.ID), "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantKeys == nil {
+				return
+			}
+
+			var posts []map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &posts); err != nil {
+				var single map[string]json.RawMessage
+				if err := json.Unmarshal(rec.Body.Bytes(), &single); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				posts = append(posts, single)
+			}
+			if len(posts) != 1 {
+				t.Fatalf("got %d posts, want 1", len(posts))
+			}
+			var keys []string
+			for _, name := range postFields {
+				if _, ok := posts[0][name]; ok {
+					keys = append(keys, name)
+				}
+			}
+			if len(keys) != len(posts[0]) || !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("members = %v, want %v", posts[0], tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestProjectionsAreCachedSeparately(t *testing.T) {
+	c := cache.NewLRU(10, 0)
+	h, router := newTestHandlers(t, PostConfig{Cache: c})
+	post := createTestPost(t, h.Posts.Store, "Title")
+	target := "/v1/posts?id=" + post.ID.String()
+
+	serve(router, "GET", target+"&fields=title", "", nil)
+	rec := serve(router, "GET", target, "", nil)
+
+	var full map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &full); err != nil || full["body"] == nil {
+		t.Fatalf("full read after a projected one = %s, %v; want the body", rec.Body, err)
+	}
+	for _, fields := range []projection{{"id", "title"}, postFields} {
+		if _, ok, _ := c.Get(context.Background(), postCacheKey(post.ID.String()), fields.key()); !ok {
+			t.Errorf("projection %v is not cached", fields)
+		}
+	}
+}
+
+// replaceID fills the {id} placeholder of target.
+func replaceID(target string, id uuid.UUID) string {
+	return strings.ReplaceAll(target, "{id}", id.String())
+}
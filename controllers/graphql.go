@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"blogklert/cache"
+	"blogklert/graph"
+	"blogklert/models"
+	"blogklert/store"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+)
+
+// Page sizes of the GraphQL posts connection.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// SetupGraphQLRoute mounts the GraphQL endpoint at /graphql.
+func (h *Handlers) SetupGraphQLRoute(router *mux.Router, limits graph.Limits) error {
+	schema, err := h.PostGraphQLSchema()
+	if err != nil {
+		return fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	router.Handle("/graphql", h.withPostLoaders(graph.Handler(&schema, limits))).Methods("GET", "POST")
+	return nil
+}
+
+// PostGraphQLSchema builds the GraphQL schema over posts.
+func (h *Handlers) PostGraphQLSchema() (graphql.Schema, error) {
+	var postType *graphql.Object
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.ID), Resolve: postResolver(func(p *models.Post) interface{} { return p.ID.String() })},
+				"slug":      {Type: graphql.NewNonNull(graphql.String), Resolve: postResolver(func(p *models.Post) interface{} { return p.Slug })},
+				"title":     {Type: graphql.NewNonNull(graphql.String), Resolve: postResolver(func(p *models.Post) interface{} { return p.Title })},
+				"excerpt":   {Type: graphql.NewNonNull(graphql.String), Resolve: postResolver(func(p *models.Post) interface{} { return p.Excerpt })},
+				"body":      {Type: graphql.NewNonNull(graphql.String), Resolve: postResolver(func(p *models.Post) interface{} { return p.Body })},
+				"createdAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: postResolver(func(p *models.Post) interface{} { return p.CreatedAt })},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: postResolver(func(p *models.Post) interface{} { return p.UpdatedAt })},
+				"version":   {Type: graphql.NewNonNull(graphql.Int), Resolve: postResolver(func(p *models.Post) interface{} { return p.Version })},
+				"previous": {
+					Type:        postType,
+					Description: "The post published just before this one.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						post := p.Source.(*models.Post)
+						return postLoadersFrom(p.Context).previous.Load(p.Context, post.ID), nil
+					},
+				},
+				"next": {
+					Type:        postType,
+					Description: "The post published just after this one.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						post := p.Source.(*models.Post)
+						return postLoadersFrom(p.Context).next.Load(p.Context, post.ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostEdge",
+		Fields: graphql.Fields{
+			"cursor": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return postCursor(p.Source.(*models.Post)), nil
+			}},
+			"node": {Type: graphql.NewNonNull(postType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source, nil
+			}},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": {Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   {Type: graphql.String},
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostConnection",
+		Fields: graphql.Fields{
+			"edges": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(postConnection).posts, nil
+			}},
+			"nodes": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(postConnection).posts, nil
+			}},
+			"pageInfo": {Type: graphql.NewNonNull(pageInfoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(postConnection).pageInfo(), nil
+			}},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"post": {
+				Type:        postType,
+				Description: "Fetch one post by id or slug.",
+				Args: graphql.FieldConfigArgument{
+					"id":   {Type: graphql.ID},
+					"slug": {Type: graphql.String},
+				},
+				Resolve: resolvePost,
+			},
+			"posts": {
+				Type:        graphql.NewNonNull(connectionType),
+				Description: "List posts, newest first.",
+				Args: graphql.FieldConfigArgument{
+					graph.PageSizeArg: {Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":           {Type: graphql.String, Description: "Cursor of the last post of the previous page."},
+					"search":          {Type: graphql.String, Description: "Only posts whose title, excerpt or body contains this text."},
+					"createdAfter":    {Type: graphql.DateTime},
+					"createdBefore":   {Type: graphql.DateTime},
+				},
+				Resolve: h.resolvePosts,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// postResolver adapts a getter on the source post into a field resolver.
+func postResolver(get func(*models.Post) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*models.Post)), nil
+	}
+}
+
+func resolvePost(p graphql.ResolveParams) (interface{}, error) {
+	loaders := postLoadersFrom(p.Context)
+	if rawID, ok := p.Args["id"].(string); ok {
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			return nil, nil
+		}
+		return loaders.byID.Load(p.Context, id), nil
+	}
+	if slug, ok := p.Args["slug"].(string); ok {
+		return loaders.bySlug.Load(p.Context, slug), nil
+	}
+	return nil, errors.New("post requires an id or a slug")
+}
+
+// postConnection is one page of posts.
+type postConnection struct {
+	posts   []*models.Post
+	hasNext bool
+}
+
+func (c postConnection) pageInfo() map[string]interface{} {
+	info := map[string]interface{}{"hasNextPage": c.hasNext, "endCursor": nil}
+	if len(c.posts) > 0 {
+		info["endCursor"] = postCursor(c.posts[len(c.posts)-1])
+	}
+	return info
+}
+
+func (h *Handlers) resolvePosts(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args[graph.PageSizeArg].(int)
+	if first < 1 || first > maxPageSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxPageSize)
+	}
+
+	query := store.PageQuery{Limit: first + 1}
+	if after, ok := p.Args["after"].(string); ok {
+		createdAt, id, err := parsePostCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		query.After = &store.Cursor{CreatedAt: createdAt, ID: id}
+	}
+	if search, ok := p.Args["search"].(string); ok {
+		query.Search = search
+	}
+	if createdAfter, ok := p.Args["createdAfter"].(time.Time); ok {
+		query.CreatedAfter = &createdAfter
+	}
+	if createdBefore, ok := p.Args["createdBefore"].(time.Time); ok {
+		query.CreatedBefore = &createdBefore
+	}
+
+	posts, err := h.Posts.Store.Page(p.Context, query)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := postConnection{posts: postPointers(posts)}
+	if len(conn.posts) > first {
+		conn.posts = conn.posts[:first]
+		conn.hasNext = true
+	}
+	return conn, nil
+}
+
+// postCursor encodes the keyset position of a post in the newest-first listing.
+func postCursor(post *models.Post) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(post.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + post.ID.String()))
+}
+
+func parsePostCursor(cursor string) (time.Time, uuid.UUID, error) {
+	errInvalid := errors.New("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalid
+	}
+	createdAt, rawID, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errInvalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalid
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalid
+	}
+	return t, id, nil
+}
+
+// postLoaders batch the post lookups of one GraphQL request.
+type postLoaders struct {
+	byID     *graph.Loader[uuid.UUID, *models.Post]
+	bySlug   *graph.Loader[string, *models.Post]
+	previous *graph.Loader[uuid.UUID, *models.Post]
+	next     *graph.Loader[uuid.UUID, *models.Post]
+}
+
+type postLoadersKey struct{}
+
+// withPostLoaders gives each request its own set of loaders.
+func (h *Handlers) withPostLoaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loaders := &postLoaders{
+			byID:     graph.NewLoader(h.loadPostsByID),
+			bySlug:   graph.NewLoader(h.loadPostsBySlug),
+			previous: graph.NewLoader(h.adjacentPostsLoader(true)),
+			next:     graph.NewLoader(h.adjacentPostsLoader(false)),
+		}
+		ctx := context.WithValue(r.Context(), postLoadersKey{}, loaders)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func postLoadersFrom(ctx context.Context) *postLoaders {
+	return ctx.Value(postLoadersKey{}).(*postLoaders)
+}
+
+// loadPostsByID reads posts from the detail cache shared with GetPost, then
+// fetches the misses from the store in one batch and caches them. When the
+// cache cannot be read every post is treated as a miss.
+func (h *Handlers) loadPostsByID(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Post, error) {
+	posts := make(map[uuid.UUID]*models.Post, len(ids))
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = postCacheKey(id.String())
+	}
+	cached, err := cache.GetMultiJSON[models.Post](ctx, h.Posts.Cache, keys, postFields.key())
+	if err != nil {
+		if logCacheError(err) {
+			h.Logger.Printf("error fetching posts from the cache: %v", err)
+		}
+		cached = make([]*models.Post, len(ids))
+	}
+
+	var missing []uuid.UUID
+	for i, post := range cached {
+		if post == nil {
+			missing = append(missing, ids[i])
+			continue
+		}
+		posts[ids[i]] = post
+	}
+	if len(missing) == 0 {
+		return posts, nil
+	}
+
+	fetched, err := h.Posts.Store.GetByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range postPointers(fetched) {
+		posts[post.ID] = post
+		h.cacheProjection(ctx, postCacheKey(post.ID.String()), postFields, post)
+	}
+	return posts, nil
+}
+
+func (h *Handlers) loadPostsBySlug(ctx context.Context, slugs []string) (map[string]*models.Post, error) {
+	fetched, err := h.Posts.Store.GetBySlugs(ctx, slugs)
+	if err != nil {
+		return nil, err
+	}
+	posts := make(map[string]*models.Post, len(fetched))
+	for _, post := range postPointers(fetched) {
+		posts[post.Slug] = post
+	}
+	return posts, nil
+}
+
+// adjacentPostsLoader returns a batch function finding, for each post id, the
+// closest older post, or the closest newer one unless older is set.
+func (h *Handlers) adjacentPostsLoader(older bool) graph.BatchFunc[uuid.UUID, *models.Post] {
+	return func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Post, error) {
+		adjacent, err := h.Posts.Store.Adjacent(ctx, ids, older)
+		if err != nil {
+			return nil, err
+		}
+		posts := make(map[uuid.UUID]*models.Post, len(adjacent))
+		for id, post := range adjacent {
+			post := post
+			posts[id] = &post
+		}
+		return posts, nil
+	}
+}
+
+// postPointers returns pointers to each of posts, as GraphQL resolvers expect.
+func postPointers(posts []models.Post) []*models.Post {
+	pointers := make([]*models.Post, len(posts))
+	for i := range posts {
+		pointers[i] = &posts[i]
+	}
+	return pointers
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"blogklert/models"
+	postsv1 "blogklert/proto/posts/v1"
+	"blogklert/store"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// listPageSize is how many posts ListPosts reads from the store at a time.
+const listPageSize = 100
+
+// errInvalidVersion is returned for an expected_version no post can have.
+var errInvalidVersion = errors.New("expected_version must be positive")
+
+// PostService implements the gRPC PostService on top of the same storage,
+// sanitization and cache used by the HTTP handlers.
+type PostService struct {
+	postsv1.UnimplementedPostServiceServer
+	h *Handlers
+}
+
+// PostService returns the gRPC PostService served by h.
+func (h *Handlers) PostService() *PostService {
+	return &PostService{h: h}
+}
+
+// GetPost returns a single post, served from the Redis cache when possible.
+func (s *PostService) GetPost(ctx context.Context, req *postsv1.GetPostRequest) (*postsv1.Post, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid post id")
+	}
+
+	post, err := s.h.fetchPost(ctx, id.String(), postFields)
+	if err != nil {
+		return nil, s.h.grpcError("Failed to fetch post", err)
+	}
+	return s.h.postMessage(post)
+}
+
+// ListPosts streams every post, newest first. Posts are read from the store a
+// page at a time using keyset cursors, and each page is sent before the next
+// is read. Bodies are only sent when requested.
+func (s *PostService) ListPosts(req *postsv1.ListPostsRequest, stream postsv1.PostService_ListPostsServer) error {
+	query := store.PageQuery{Limit: listPageSize}
+	for {
+		posts, err := s.h.Posts.Store.Page(stream.Context(), query)
+		if err != nil {
+			return s.h.grpcError("Failed to fetch posts", err)
+		}
+		for _, post := range posts {
+			if !req.GetIncludeBody() {
+				post.Body = ""
+			}
+			message, err := s.h.postMessage(post)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+		if len(posts) < listPageSize {
+			return nil
+		}
+		last := posts[len(posts)-1]
+		query.After = &store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// CreatePost sanitizes, validates and stores a new post.
+func (s *PostService) CreatePost(ctx context.Context, req *postsv1.CreatePostRequest) (*postsv1.Post, error) {
+	post := models.Post{Title: req.GetTitle(), Excerpt: req.GetExcerpt(), Body: req.GetBody()}
+	s.h.sanitizePost(&post)
+	if err := validatePost(post); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	created, err := insertPost(ctx, s.h.Posts.Store, post)
+	if err != nil {
+		return nil, s.h.grpcError("Failed to create post", err)
+	}
+
+	s.h.invalidatePostCache(ctx)
+	return s.h.postMessage(created)
+}
+
+// UpdatePost replaces a post's content, conditionally on expected_version when set.
+func (s *PostService) UpdatePost(ctx context.Context, req *postsv1.UpdatePostRequest) (*postsv1.Post, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid post id")
+	}
+
+	post := models.Post{ID: id, Title: req.GetTitle(), Excerpt: req.GetExcerpt(), Body: req.GetBody()}
+	s.h.sanitizePost(&post)
+	if err := validatePost(post); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	expected, err := s.h.expectedVersion(req.ExpectedVersion)
+	if err != nil {
+		return nil, s.h.grpcError("Failed to update post", err)
+	}
+	if _, err := s.h.Posts.Store.Update(ctx, post, expected); err != nil {
+		return nil, s.h.grpcError("Failed to update post", err)
+	}
+
+	s.h.invalidatePostCache(ctx, id.String())
+	updated, err := s.h.fetchPost(ctx, id.String(), postFields)
+	if err != nil {
+		return nil, s.h.grpcError("Failed to fetch post", err)
+	}
+	return s.h.postMessage(updated)
+}
+
+// DeletePost removes a post, conditionally on expected_version when set.
+func (s *PostService) DeletePost(ctx context.Context, req *postsv1.DeletePostRequest) (*emptypb.Empty, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid post id")
+	}
+
+	expected, err := s.h.expectedVersion(req.ExpectedVersion)
+	if err != nil {
+		return nil, s.h.grpcError("Failed to delete post", err)
+	}
+	if err := s.h.Posts.Store.Delete(ctx, id, expected); err != nil {
+		return nil, s.h.grpcError("Failed to delete post", err)
+	}
+
+	s.h.invalidatePostCache(ctx, id.String())
+	return &emptypb.Empty{}, nil
+}
+
+// expectedVersion is the gRPC counterpart of checkIfMatch: it enforces
+// RequireIfMatch and converts the optional expected version, rejecting
+// versions below the first.
+func (h *Handlers) expectedVersion(version *int32) (*int, error) {
+	if version == nil {
+		if h.Posts.RequireIfMatch {
+			return nil, errPreconditionRequired
+		}
+		return nil, nil
+	}
+	if *version < 1 {
+		return nil, errInvalidVersion
+	}
+	expected := int(*version)
+	return &expected, nil
+}
+
+// grpcError maps storage and precondition errors to gRPC status errors,
+// logging the ones the caller cannot act on.
+func (h *Handlers) grpcError(message string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, "Post not found")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return status.Error(codes.FailedPrecondition, "Post has been modified")
+	case errors.Is(err, errPreconditionRequired):
+		return status.Error(codes.FailedPrecondition, "expected_version is required")
+	case errors.Is(err, errInvalidVersion):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		h.Logger.Printf("%s: %v", message, err)
+		return status.Error(codes.Internal, message)
+	}
+}
+
+// postMessage converts a post to its protobuf representation. A version too
+// large for the message is an internal error rather than a wrapped number.
+func (h *Handlers) postMessage(post models.Post) (*postsv1.Post, error) {
+	if post.Version > math.MaxInt32 {
+		return nil, h.grpcError("Failed to encode post", fmt.Errorf("post %s has version %d, out of the int32 range", post.ID, post.Version))
+	}
+	return &postsv1.Post{
+		Id:        post.ID.String(),
+		Slug:      post.Slug,
+		Title:     post.Title,
+		Excerpt:   post.Excerpt,
+		Body:      post.Body,
+		CreatedAt: timestamppb.New(post.CreatedAt),
+		UpdatedAt: timestamppb.New(post.UpdatedAt),
+		Version:   int32(post.Version),
+	}, nil
+}
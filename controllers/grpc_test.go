@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"blogklert/models"
+	postsv1 "blogklert/proto/posts/v1"
+	"blogklert/store"
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// postStream collects the posts sent on a ListPosts stream.
+type postStream struct {
+	grpc.ServerStream
+	posts []*postsv1.Post
+}
+
+func (s *postStream) Context() context.Context { return context.Background() }
+
+func (s *postStream) Send(post *postsv1.Post) error {
+	s.posts = append(s.posts, post)
+	return nil
+}
+
+// pagingStore counts the pages read from the store.
+type pagingStore struct {
+	store.PostStore
+	pages atomic.Int64
+}
+
+func (s *pagingStore) Page(ctx context.Context, query store.PageQuery) ([]models.Post, error) {
+	s.pages.Add(1)
+	return s.PostStore.Page(ctx, query)
+}
+
+func TestListPosts(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		includeBody bool
+		wantPages   int64
+	}{
+		{name: "Empty", count: 0, wantPages: 1},
+		{name: "One page", count: 3, includeBody: true, wantPages: 1},
+		{name: "Full page", count: listPageSize, wantPages: 2},
+		{name: "Several pages", count: 2*listPageSize + 1, wantPages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &pagingStore{PostStore: store.NewMemory()}
+			h, _ := newTestHandlers(t, PostConfig{Store: s})
+			for i := 0; i < tt.count; i++ {
+				createTestPost(t, s.PostStore, "Title")
+			}
+
+			stream := &postStream{}
+			if err := h.PostService().ListPosts(&postsv1.ListPostsRequest{IncludeBody: tt.includeBody}, stream); err != nil {
+				t.Fatalf("ListPosts() error = %v", err)
+			}
+			if len(stream.posts) != tt.count {
+				t.Fatalf("sent %d posts, want %d", len(stream.posts), tt.count)
+			}
+			if got := s.pages.Load(); got != tt.wantPages {
+				t.Errorf("read %d pages, want %d", got, tt.wantPages)
+			}
+			seen := make(map[string]bool)
+			for _, post := range stream.posts {
+				if seen[post.Id] {
+					t.Errorf("post %s sent twice", post.Id)
+				}
+				seen[post.Id] = true
+				if (post.Body != "") != tt.includeBody {
+					t.Errorf("post body = %q, want it only when requested", post.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestExpectedVersion(t *testing.T) {
+	version := func(v int32) *int32 { return &v }
+	tests := []struct {
+		name           string
+		version        *int32
+		requireIfMatch bool
+		want           *int
+		wantErr        error
+	}{
+		{name: "Unconditional"},
+		{name: "Required", requireIfMatch: true, wantErr: errPreconditionRequired},
+		{name: "Version", version: version(3), want: func() *int { v := 3; return &v }()},
+		{name: "Largest version", version: version(math.MaxInt32), want: func() *int { v := math.MaxInt32; return &v }()},
+		{name: "Zero", version: version(0), wantErr: errInvalidVersion},
+		{name: "Negative", version: version(-1), wantErr: errInvalidVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, PostConfig{RequireIfMatch: tt.requireIfMatch})
+			got, err := h.expectedVersion(tt.version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expectedVersion() error = %v, want %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("expectedVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	h, _ := newTestHandlers(t, PostConfig{})
+	if code := status.Code(h.grpcError("Failed to update post", errInvalidVersion)); code != codes.InvalidArgument {
+		t.Errorf("grpcError(errInvalidVersion) code = %v, want InvalidArgument", code)
+	}
+}
+
+func TestPostMessageVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  int
+		wantCode codes.Code
+	}{
+		{name: "First version", version: 1, wantCode: codes.OK},
+		{name: "Largest version", version: math.MaxInt32, wantCode: codes.OK},
+		{name: "Too large", version: math.MaxInt32 + 1, wantCode: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandlers(t, PostConfig{})
+			message, err := h.postMessage(models.Post{ID: uuid.New(), Version: tt.version})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("postMessage() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err == nil && int(message.Version) != tt.version {
+				t.Errorf("postMessage() Version = %d, want %d", message.Version, tt.version)
+			}
+		})
+	}
+}
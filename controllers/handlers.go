@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"blogklert/breaker"
+	"blogklert/db"
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Deps are the services and settings the handlers depend on.
+type Deps struct {
+	Posts  PostConfig
+	Events EventsConfig
+	// DB holds the posts and, on Postgres, the webhooks and the outbox.
+	DB *sql.DB
+	// Driver is the database driver of DB, db.Postgres unless set. Other
+	// databases hold no webhooks or outbox, so post changes are neither
+	// delivered to webhooks nor streamed as events.
+	Driver string
+	// Redis is nil when Redis is not configured. Commands sent while
+	// RedisBreaker is open fail at once with breaker.ErrOpen.
+	Redis        *redis.Client
+	RedisBreaker *breaker.Breaker
+	Logger       *log.Logger
+	// AllowPrivateWebhooks accepts webhook URLs on loopback and private addresses.
+	AllowPrivateWebhooks bool
+	// Clock returns the current time.
+	Clock func() time.Time
+	// Background bounds the work the handlers run in the background, such as
+	// tailing the event stream. Nil runs it for the life of the process.
+	Background context.Context
+}
+
+// Handlers serve the blog over HTTP and gRPC. They read no package state, so
+// several instances may share a process.
+type Handlers struct {
+	Deps
+
+	hub *eventHub
+	// idempotencyWarning logs the missing Redis once across mounted API versions.
+	idempotencyWarning sync.Once
+}
+
+// New returns handlers using deps. A nil Logger logs to the standard logger
+// and a nil Clock reads the system clock.
+func New(deps Deps) *Handlers {
+	if deps.Logger == nil {
+		deps.Logger = log.Default()
+	}
+	if deps.Clock == nil {
+		deps.Clock = time.Now
+	}
+	if deps.Driver == "" {
+		deps.Driver = db.Postgres
+	}
+	if deps.Background == nil {
+		deps.Background = context.Background()
+	}
+	h := &Handlers{Deps: deps}
+	h.hub = newEventHub(deps.Background, deps.Redis, deps.Logger)
+	return h
+}
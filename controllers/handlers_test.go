@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"blogklert/cache"
+	"blogklert/models"
+	"blogklert/store"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestHandlers returns handlers over posts, filled in with an in-memory
+// store and no cache unless set, and a router serving them under /v1.
+func newTestHandlers(t *testing.T, posts PostConfig) (*Handlers, http.Handler) {
+	t.Helper()
+	if posts.Store == nil {
+		posts.Store = store.NewMemory()
+	}
+	if posts.Cache == nil {
+		posts.Cache = cache.Noop{}
+	}
+	if posts.CacheLoader == nil {
+		posts.CacheLoader = &cache.Loader{Cache: posts.Cache}
+	}
+	posts.Policies = DefaultPostPolicies
+
+	h := New(Deps{Posts: posts, Logger: log.New(io.Discard, "", 0)})
+	router := mux.NewRouter()
+	h.SetupPostRoutes(router.PathPrefix(V1.Prefix).Subrouter(), V1)
+	return h, router
+}
+
+// serve sends a request with header to handler and records the response.
+func serve(handler http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTestPost stores a post titled title in s.
+func createTestPost(t *testing.T, s store.PostStore, title string) models.Post {
+	t.Helper()
+	post, err := insertPost(context.Background(), s, models.Post{Title: title, Excerpt: "An excerpt", Body: "A body"})
+	if err != nil {
+		t.Fatalf("insertPost() error = %v", err)
+	}
+	return post
+}
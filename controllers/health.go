@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"blogklert/breaker"
+	"blogklert/store"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Health statuses. The service is degraded when an optional dependency such
+// as Redis is down: posts are still served, straight from the database.
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+	healthDisabled    = "disabled"
+)
+
+// healthTimeout bounds the database check.
+const healthTimeout = 2 * time.Second
+
+// healthCheck is the state of one dependency.
+type healthCheck struct {
+	Status string     `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// healthReport is the body of a health check response.
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// HealthHandler reports the state of the database, named after its driver,
+// Redis and the read replicas. It answers 503 only when the database is down,
+// since the service keeps working without the others.
+func (h *Handlers) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		database := h.databaseHealth(r.Context())
+		report := healthReport{Status: healthOK, Checks: map[string]healthCheck{
+			h.Driver: database,
+			"redis":  h.redisHealth(),
+		}}
+		if replicated, ok := h.Posts.Store.(*store.Replicated); ok {
+			report.Checks["replicas"] = replicasHealth(replicated.Status())
+		}
+		status := http.StatusOK
+		switch {
+		case database.Status != healthOK:
+			report.Status = healthUnavailable
+			status = http.StatusServiceUnavailable
+		case report.Checks["redis"].Status == healthUnavailable, report.Checks["replicas"].Status == healthUnavailable:
+			report.Status = healthDegraded
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		respondJSON(w, report, status)
+	})
+}
+
+func (h *Handlers) databaseHealth(ctx context.Context) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	if err := h.DB.PingContext(ctx); err != nil {
+		return healthCheck{Status: healthUnavailable, Error: err.Error()}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+// replicasHealth reports the read replicas as unavailable when any is out of
+// rotation, since reads then weigh more on the others or the primary.
+func replicasHealth(statuses []store.ReplicaStatus) healthCheck {
+	var problems []string
+	for _, status := range statuses {
+		if !status.InRotation {
+			problems = append(problems, status.Name+": "+status.Err.Error())
+		}
+	}
+	if len(problems) == 0 {
+		return healthCheck{Status: healthOK}
+	}
+	return healthCheck{Status: healthUnavailable, Error: strings.Join(problems, "; ")}
+}
+
+func (h *Handlers) redisHealth() healthCheck {
+	if h.RedisBreaker == nil {
+		return healthCheck{Status: healthDisabled}
+	}
+	state := h.RedisBreaker.Status()
+	if state.State == breaker.Closed {
+		return healthCheck{Status: healthOK}
+	}
+	check := healthCheck{Status: healthUnavailable, Since: &state.Since}
+	if state.LastError != nil {
+		check.Error = state.LastError.Error()
+	}
+	return check
+}
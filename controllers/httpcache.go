@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"blogklert/breaker"
+	"blogklert/cache"
+	"blogklert/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPCacheConfig controls the caching headers sent with post reads.
+type HTTPCacheConfig struct {
+	// CacheControl is sent verbatim as the Cache-Control header when set.
+	CacheControl string
+	// SurrogateKeys enables Surrogate-Key headers for CDN purging.
+	SurrogateKeys bool
+}
+
+// CacheTTLConfig sets how long each family of cached post data is kept.
+type CacheTTLConfig struct {
+	// List applies to the post listing and its validators.
+	List time.Duration
+	// Detail applies to single posts and their validators.
+	Detail time.Duration
+	// Stale is how long a listing invalidated by a write is still served
+	// while it is rebuilt.
+	Stale time.Duration
+}
+
+// cacheMeta describes the cached representation of a resource.
+type cacheMeta struct {
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	// SurrogateKeys of a listing name every post it holds, so a 304 answered
+	// from the cache carries the same keys as the full response.
+	SurrogateKeys []string `json:"surrogate_keys,omitempty"`
+}
+
+// Cache keys for post data. Each key is a hash with one field per projection.
+const postsCacheKey = "posts:list"
+
+// postCacheKey returns the hash holding the cached projections of a post.
+func postCacheKey(postID string) string {
+	return "post:" + postID + ":detail"
+}
+
+// metaKey returns the key holding validators for a cached resource.
+func metaKey(cacheKey string) string {
+	return cacheKey + ":meta"
+}
+
+// Cache tags name the entities held by cached entries, so a write invalidates
+// every entry holding a post without knowing their keys. The listing holds
+// every post, so it carries its own tag rather than one per post.
+const postListTag = "posts"
+
+// postTag returns the tag of the entries holding a post.
+func postTag(postID string) string {
+	return "post:" + postID
+}
+
+// cacheTags returns the tags of cacheKey, which apply to its validators too.
+func cacheTags(cacheKey string) []string {
+	if strings.HasPrefix(cacheKey, postsCacheKey) {
+		return []string{postListTag}
+	}
+	postID, _, _ := strings.Cut(strings.TrimPrefix(cacheKey, "post:"), ":")
+	return []string{postTag(postID)}
+}
+
+// cacheTTL returns the TTL of the family cacheKey belongs to.
+func (h *Handlers) cacheTTL(cacheKey string) time.Duration {
+	if strings.HasPrefix(cacheKey, postsCacheKey) {
+		return h.Posts.CacheTTL.List
+	}
+	return h.Posts.CacheTTL.Detail
+}
+
+// cacheProjection stores a projection of a resource. Failures are logged: the
+// response does not depend on them.
+func (h *Handlers) cacheProjection(ctx context.Context, cacheKey string, fields projection, value interface{}) {
+	if err := cache.SetJSON(ctx, h.Posts.Cache, cacheKey, fields.key(), value, h.cacheTTL(cacheKey), cacheTags(cacheKey)...); logCacheError(err) {
+		h.Logger.Printf("error caching %s: %v", cacheKey, err)
+	}
+}
+
+// cacheVariant identifies one representation of a resource: a projection
+// rendered as a media type.
+func cacheVariant(fields projection, mediaType string) string {
+	return fields.key() + ";" + mediaType
+}
+
+// loadCacheMeta reads the stored validators for a variant of cacheKey.
+func (h *Handlers) loadCacheMeta(ctx context.Context, cacheKey, variant string) (cacheMeta, bool) {
+	meta, ok, err := cache.GetJSON[cacheMeta](ctx, h.Posts.Cache, metaKey(cacheKey), variant)
+	if err != nil || !ok || meta.ETag == "" {
+		return cacheMeta{}, false
+	}
+	return meta, true
+}
+
+// storeCacheMeta saves the validators for a variant of cacheKey so later
+// conditional requests can skip the store.
+func (h *Handlers) storeCacheMeta(ctx context.Context, cacheKey, variant string, meta cacheMeta) {
+	key := metaKey(cacheKey)
+	if err := cache.SetJSON(ctx, h.Posts.Cache, key, variant, meta, h.cacheTTL(cacheKey), cacheTags(cacheKey)...); logCacheError(err) {
+		h.Logger.Printf("error caching %s: %v", key, err)
+	}
+}
+
+// postMeta returns the validators for a representation of a single post. The
+// full JSON representation uses the version ETag accepted by If-Match.
+func postMeta(post models.Post, fields projection, mediaType string) cacheMeta {
+	etag := postETag(post.Version)
+	if variant := cacheVariant(fields, mediaType); variant != cacheVariant(postFields, mediaJSON) {
+		sum := sha256.Sum256([]byte(variant))
+		etag = fmt.Sprintf(`"v%d-%s"`, post.Version, hex.EncodeToString(sum[:4]))
+	}
+	return cacheMeta{ETag: etag, LastModified: post.UpdatedAt}
+}
+
+// postsMeta returns the validators for a post listing: a hash of its JSON
+// encoding. A listing has no Last-Modified, so If-Modified-Since is ignored:
+// the latest update among its posts does not move when one is deleted.
+func postsMeta(posts []models.Post, fields projection, mediaType string) cacheMeta {
+	meta := cacheMeta{SurrogateKeys: []string{"posts"}}
+	for _, post := range posts {
+		meta.SurrogateKeys = append(meta.SurrogateKeys, postSurrogateKey(post.ID.String()))
+	}
+	data, _ := json.Marshal(project(posts, fields))
+	sum := sha256.Sum256(append(data, mediaType...))
+	meta.ETag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	return meta
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since against meta.
+// If-None-Match takes precedence when both are present, and If-Modified-Since
+// is ignored when meta has no modification time.
+func notModified(r *http.Request, meta cacheMeta) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(meta.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !meta.LastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		return !meta.LastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// setCacheHeaders writes the validators and configured caching headers.
+func (h *Handlers) setCacheHeaders(w http.ResponseWriter, meta cacheMeta, surrogateKeys ...string) {
+	w.Header().Set("ETag", meta.ETag)
+	if !meta.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", meta.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if h.Posts.HTTPCache.CacheControl != "" {
+		w.Header().Set("Cache-Control", h.Posts.HTTPCache.CacheControl)
+	}
+	if h.Posts.HTTPCache.SurrogateKeys && len(surrogateKeys) > 0 {
+		w.Header().Set("Surrogate-Key", strings.Join(surrogateKeys, " "))
+	}
+}
+
+// respondNotModified answers a conditional GET whose validators still match.
+func (h *Handlers) respondNotModified(w http.ResponseWriter, meta cacheMeta, surrogateKeys ...string) {
+	h.setCacheHeaders(w, meta, surrogateKeys...)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// postSurrogateKey returns the CDN surrogate key for a single post.
+func postSurrogateKey(postID string) string {
+	return "post-" + postID
+}
+
+// deletePostCache invalidates the cached data and validators of the given
+// posts and of the post listing, which stays readable as a stale value while
+// it is rebuilt. Single posts are never served stale, so writers read their
+// own changes.
+func (h *Handlers) deletePostCache(ctx context.Context, postIDs ...string) error {
+	tags := []string{postListTag}
+	for _, postID := range postIDs {
+		tags = append(tags, postTag(postID))
+	}
+	_, err := h.Posts.Cache.Invalidate(ctx, h.Posts.CacheTTL.Stale, tags...)
+	return err
+}
+
+// invalidatePostCache clears the cache right after a write so the writer reads
+// its own change. It is best effort: the outbox relay repeats the deletion
+// reliably, so failures are only logged.
+func (h *Handlers) invalidatePostCache(ctx context.Context, postIDs ...string) {
+	if err := h.deletePostCache(ctx, postIDs...); logCacheError(err) {
+		h.Logger.Printf("error invalidating post cache: %v", err)
+	}
+}
+
+// logCacheError reports whether err is worth logging. Writes skipped because
+// the Redis circuit is open are expected while running degraded.
+func logCacheError(err error) bool {
+	return err != nil && !errors.Is(err, breaker.ErrOpen)
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"blogklert/cache"
+	"blogklert/models"
+	"blogklert/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// countingStore counts the reads that reach the store.
+type countingStore struct {
+	store.PostStore
+	reads atomic.Int64
+}
+
+func (s *countingStore) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	s.reads.Add(1)
+	return s.PostStore.List(ctx, columns)
+}
+
+func (s *countingStore) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	s.reads.Add(1)
+	return s.PostStore.Get(ctx, id, columns)
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2026, 10, 18, 12, 0, 0, 500_000_000, time.UTC)
+	meta := cacheMeta{ETag: `"v1"`, LastModified: modified}
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		want            bool
+	}{
+		{name: "Unconditional", want: false},
+		{name: "Matching tag", ifNoneMatch: `"v1"`, want: true},
+		{name: "Weak comparison", ifNoneMatch: `W/"v1"`, want: true},
+		{name: "One of several tags", ifNoneMatch: `"v0", "v1"`, want: true},
+		{name: "Any tag", ifNoneMatch: `*`, want: true},
+		{name: "Other tag", ifNoneMatch: `"v2"`, want: false},
+		{name: "Not modified since", ifModifiedSince: modified.Add(time.Hour).Format(http.TimeFormat), want: true},
+		{name: "Same second", ifModifiedSince: modified.Format(http.TimeFormat), want: true},
+		{name: "Modified since", ifModifiedSince: modified.Add(-time.Second).Format(http.TimeFormat), want: false},
+		{name: "Invalid date", ifModifiedSince: "yesterday", want: false},
+		{name: "If-None-Match wins over a later date", ifNoneMatch: `"v2"`, ifModifiedSince: modified.Add(time.Hour).Format(http.TimeFormat), want: false},
+		{name: "If-None-Match wins over an earlier date", ifNoneMatch: `"v1"`, ifModifiedSince: modified.Add(-time.Hour).Format(http.TimeFormat), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/posts", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			if got := notModified(req, meta); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostMeta(t *testing.T) {
+	post := models.Post{ID: uuid.New(), Title: "Title", Version: 3, UpdatedAt: time.Now()}
+	full := postMeta(post, postFields, mediaJSON)
+	if full.ETag != `"v3"` || !full.LastModified.Equal(post.UpdatedAt) {
+		t.Errorf("postMeta() = %+v, want the version ETag and update time", full)
+	}
+
+	// Every other representation has its own tag for the same version.
+	seen := map[string]bool{full.ETag: true}
+	for _, variant := range []struct {
+		fields    projection
+		mediaType string
+	}{
+		{summaryFields, mediaJSON},
+		{postFields, mediaHTML},
+		{postFields, mediaText},
+		{projection{"id", "title"}, mediaJSON},
+	} {
+		etag := postMeta(post, variant.fields, variant.mediaType).ETag
+		if seen[etag] {
+			t.Errorf("postMeta(%v, %s) ETag %s is not unique", variant.fields, variant.mediaType, etag)
+		}
+		seen[etag] = true
+	}
+
+	older := post
+	older.UpdatedAt = post.UpdatedAt.Add(-time.Hour)
+	listing := postsMeta([]models.Post{older, post}, summaryFields, mediaJSON)
+	if !listing.LastModified.IsZero() {
+		t.Errorf("postsMeta() LastModified = %v, want none", listing.LastModified)
+	}
+	if other := postsMeta([]models.Post{older, post}, summaryFields, mediaText); other.ETag == listing.ETag {
+		t.Error("postsMeta() ETag does not depend on the media type")
+	}
+	if changed := postsMeta([]models.Post{older}, summaryFields, mediaJSON); changed.ETag == listing.ETag {
+		t.Error("postsMeta() ETag does not depend on the posts")
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	tests := []struct {
+		name string
+		// list reads the listing instead of the post.
+		list bool
+		// deleteBetween deletes another post between the reads.
+		deleteBetween bool
+		header        func(etag, lastModified string) map[string]string
+		// wantStatus is the status of the second read.
+		wantStatus int
+	}{
+		{name: "Post with matching If-None-Match", header: func(etag, _ string) map[string]string {
+			return map[string]string{"If-None-Match": etag}
+		}, wantStatus: http.StatusNotModified},
+		{name: "Post with If-Modified-Since", header: func(_, lastModified string) map[string]string {
+			return map[string]string{"If-Modified-Since": lastModified}
+		}, wantStatus: http.StatusNotModified},
+		{name: "Post with stale If-None-Match and If-Modified-Since", header: func(_, lastModified string) map[string]string {
+			return map[string]string{"If-None-Match": `"v0"`, "If-Modified-Since": lastModified}
+		}, wantStatus: http.StatusOK},
+		{name: "Listing with matching If-None-Match", list: true, header: func(etag, _ string) map[string]string {
+			return map[string]string{"If-None-Match": etag}
+		}, wantStatus: http.StatusNotModified},
+		{name: "Listing with other If-None-Match", list: true, header: func(_, _ string) map[string]string {
+			return map[string]string{"If-None-Match": `"other"`}
+		}, wantStatus: http.StatusOK},
+		{name: "Listing with If-Modified-Since after a delete", list: true, deleteBetween: true, header: func(_, _ string) map[string]string {
+			return map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}
+		}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &countingStore{PostStore: store.NewMemory()}
+			_, router := newTestHandlers(t, PostConfig{
+				Store:     s,
+				Cache:     cache.NewLRU(10, 0),
+				HTTPCache: HTTPCacheConfig{CacheControl: "public, max-age=60", SurrogateKeys: true},
+			})
+			post := createTestPost(t, s, "Title")
+			target, surrogateKey := "/v1/posts?id="+post.ID.String(), postSurrogateKey(post.ID.String())
+			if tt.list {
+				target, surrogateKey = "/v1/posts", "posts "+postSurrogateKey(post.ID.String())
+			}
+			var deleted models.Post
+			if tt.deleteBetween {
+				deleted = createTestPost(t, s, "Deleted")
+			}
+
+			first := serve(router, "GET", target, "", nil)
+			if first.Code != http.StatusOK {
+				t.Fatalf("first GET status = %d", first.Code)
+			}
+			for name, want := range map[string]string{"Cache-Control": "public, max-age=60", "Surrogate-Key": surrogateKey} {
+				if tt.deleteBetween && name == "Surrogate-Key" {
+					// Names both posts, in an order set by their IDs
+					continue
+				}
+				if got := first.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.list && first.Header().Get("Last-Modified") != "" {
+				t.Errorf("listing Last-Modified = %q, want none", first.Header().Get("Last-Modified"))
+			}
+			if tt.deleteBetween {
+				if rec := serve(router, "DELETE", "/v1/posts?id="+deleted.ID.String(), "", nil); rec.Code != http.StatusNoContent {
+					t.Fatalf("DELETE status = %d: %s", rec.Code, rec.Body)
+				}
+			}
+			reads := s.reads.Load()
+
+			header := tt.header(first.Header().Get("ETag"), first.Header().Get("Last-Modified"))
+			second := serve(router, "GET", target, "", header)
+			if second.Code != tt.wantStatus {
+				t.Fatalf("second GET status = %d, want %d", second.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusNotModified {
+				return
+			}
+			if second.Body.Len() != 0 {
+				t.Errorf("304 body = %q, want none", second.Body)
+			}
+			if second.Header().Get("ETag") != first.Header().Get("ETag") || second.Header().Get("Surrogate-Key") != surrogateKey {
+				t.Errorf("304 headers = %v, want the validators and surrogate keys of the first read", second.Header())
+			}
+			// The cached validators answer without reading the store.
+			if got := s.reads.Load(); got != reads {
+				t.Errorf("store reads = %d, want %d", got, reads)
+			}
+		})
+	}
+}
+
+func TestCacheHeadersDisabled(t *testing.T) {
+	h, router := newTestHandlers(t, PostConfig{})
+	post := createTestPost(t, h.Posts.Store, "Title")
+
+	rec := serve(router, "GET", "/v1/posts?id="+post.ID.String(), "", nil)
+	if rec.Header().Get("ETag") == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Errorf("validators missing from %v", rec.Header())
+	}
+	for _, name := range []string{"Cache-Control", "Surrogate-Key"} {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("%s = %q, want none when not configured", name, got)
+		}
+	}
+}
+
+// laggingReplica is a replica in rotation that has not applied the latest writes.
+type laggingReplica struct {
+	store.PostStore
+}
+
+func (laggingReplica) ReplicationLag(context.Context) (time.Duration, error) {
+	return time.Second, nil
+}
+
+func TestCacheRefilledAfterReplicaLag(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(t *testing.T, h *Handlers, router http.Handler, id uuid.UUID) string
+	}{
+		{name: "Post", read: func(t *testing.T, h *Handlers, router http.Handler, id uuid.UUID) string {
+			return serve(router, "GET", "/v1/posts?id="+id.String(), "", nil).Body.String()
+		}},
+		{name: "Listing", read: func(t *testing.T, h *Handlers, router http.Handler, id uuid.UUID) string {
+			return serve(router, "GET", "/v1/posts", "", nil).Body.String()
+		}},
+		{name: "GraphQL batch", read: func(t *testing.T, h *Handlers, router http.Handler, id uuid.UUID) string {
+			posts, err := h.loadPostsByID(context.Background(), []uuid.UUID{id})
+			if err != nil || posts[id] == nil {
+				t.Fatalf("loadPostsByID() = %v, %v", posts, err)
+			}
+			return posts[id].Title
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			primary, replica := store.NewMemory(), store.NewMemory()
+			post := createTestPost(t, primary, "Original")
+			if _, err := replica.Create(ctx, post); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if _, err := primary.Patch(ctx, post.ID, map[string]string{"title": "Updated"}, nil); err != nil {
+				t.Fatalf("Patch() error = %v", err)
+			}
+			replicated := store.NewReplicated(primary, []store.ReplicaStore{laggingReplica{replica}}, 5*time.Second)
+			replicated.Check(ctx)
+			h, router := newTestHandlers(t, PostConfig{Store: replicated, Cache: cache.NewLRU(10, 0)})
+
+			// The cache is filled from the replica in rotation, stale by up to its lag.
+			if got := tt.read(t, h, router, post.ID); !strings.Contains(got, "Original") {
+				t.Errorf("read before catching up = %s, want title %q", got, "Original")
+			}
+			if _, err := replica.Patch(ctx, post.ID, map[string]string{"title": "Updated"}, nil); err != nil {
+				t.Fatalf("Patch() error = %v", err)
+			}
+			if got := tt.read(t, h, router, post.ID); !strings.Contains(got, "Original") {
+				t.Errorf("cached read = %s, want title %q", got, "Original")
+			}
+
+			// What the delayed "cache-replicas" outbox handler runs once the lag has passed
+			if err := h.deletePostCache(ctx, post.ID.String()); err != nil {
+				t.Fatalf("deletePostCache() error = %v", err)
+			}
+			if got := tt.read(t, h, router, post.ID); !strings.Contains(got, "Updated") {
+				t.Errorf("read after invalidation = %s, want title %q", got, "Updated")
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"blogklert/openapi"
+	"strings"
+)
+
+// PostSchemas returns the component schemas referenced by PostPaths.
+func PostSchemas() map[string]*openapi.Schema {
+	str := &openapi.Schema{Type: "string"}
+	return map[string]*openapi.Schema{
+		"Post": {
+			Type:        "object",
+			Description: "A blog post. Listings and sparse fieldsets omit fields that were not requested.",
+			Properties: map[string]*openapi.Schema{
+				"id":         {Type: "string", Format: "uuid"},
+				"slug":       str,
+				"title":      str,
+				"excerpt":    str,
+				"body":       str,
+				"created_at": {Type: "string", Format: "date-time"},
+				"updated_at": {Type: "string", Format: "date-time"},
+				"version":    {Type: "integer", Minimum: openapi.Float(1)},
+			},
+			Required: []string{"id"},
+		},
+		"PostInput": {
+			Type:     "object",
+			Required: []string{"title", "excerpt", "body"},
+			Properties: map[string]*openapi.Schema{
+				"title":   {Type: "string", MinLength: openapi.Int(1)},
+				"excerpt": {Type: "string", MinLength: openapi.Int(1)},
+				"body":    {Type: "string", MinLength: openapi.Int(1)},
+			},
+		},
+		"PostMergePatch": {
+			Type:                 "object",
+			AdditionalProperties: openapi.Bool(false),
+			Properties: map[string]*openapi.Schema{
+				"title":   str,
+				"excerpt": str,
+				"body":    str,
+			},
+		},
+		"JSONPatch": {
+			Type: "array",
+			Items: &openapi.Schema{
+				Type:     "object",
+				Required: []string{"op", "path"},
+				Properties: map[string]*openapi.Schema{
+					"op":    {Type: "string", Enum: []interface{}{"add", "replace", "remove", "test", "copy", "move"}},
+					"path":  str,
+					"from":  str,
+					"value": {},
+				},
+			},
+		},
+		"BulkRequest": {
+			Type:     "object",
+			Required: []string{"operations"},
+			Properties: map[string]*openapi.Schema{
+				"mode": {Type: "string", Enum: []interface{}{bulkAtomic, bulkBestEffort}},
+				"operations": {
+					Type:     "array",
+					MinItems: openapi.Int(1),
+					MaxItems: openapi.Int(maxBulkOperations),
+					Items: &openapi.Schema{
+						Type:     "object",
+						Required: []string{"op"},
+						Properties: map[string]*openapi.Schema{
+							"op":       {Type: "string", Enum: []interface{}{"create", "update", "delete"}},
+							"id":       {Type: "string", Format: "uuid"},
+							"if_match": str,
+							"post":     openapi.Ref("PostInput"),
+						},
+					},
+				},
+			},
+		},
+		"BulkResponse": {
+			Type:     "object",
+			Required: []string{"mode", "committed", "results"},
+			Properties: map[string]*openapi.Schema{
+				"mode":      str,
+				"committed": {Type: "boolean"},
+				"results": {
+					Type: "array",
+					Items: &openapi.Schema{
+						Type:     "object",
+						Required: []string{"index", "op", "status"},
+						Properties: map[string]*openapi.Schema{
+							"index":  {Type: "integer"},
+							"op":     str,
+							"id":     str,
+							"status": {Type: "integer"},
+							"etag":   str,
+							"error":  str,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// PostPaths returns the OpenAPI path items for the posts routes mounted under prefix.
+func PostPaths(prefix string, deprecated bool) map[string]openapi.PathItem {
+	name := strings.Trim(strings.ReplaceAll(prefix, "/", "_"), "_")
+	opID := func(id string) string {
+		if name == "" {
+			return id + "Unversioned"
+		}
+		return id + strings.ToUpper(name[:1]) + name[1:]
+	}
+	op := func(id, summary string) *openapi.Operation {
+		return &openapi.Operation{
+			OperationID: opID(id),
+			Summary:     summary,
+			Tags:        []string{"posts"},
+			Deprecated:  deprecated,
+			Responses:   map[string]*openapi.Response{"default": textResponse("Error")},
+		}
+	}
+
+	list := op("getPosts", "List posts, or fetch one post when id is given")
+	list.Parameters = []*openapi.Parameter{
+		{Name: "id", In: "query", Description: "Return a single post", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "fields", In: "query", Description: "Comma-separated list of fields to return", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "If-None-Match", In: "header", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "If-Modified-Since", In: "header", Description: "Honoured for a single post; listings are validated by ETag only", Schema: &openapi.Schema{Type: "string"}},
+	}
+	list.Responses["200"] = &openapi.Response{
+		Description: "A post listing, or a single post when id is given",
+		Content: map[string]openapi.MediaType{
+			mediaJSON: {Schema: &openapi.Schema{OneOf: []*openapi.Schema{
+				{Type: "array", Items: openapi.Ref("Post")},
+				openapi.Ref("Post"),
+			}}},
+			mediaHTML:     {},
+			mediaMarkdown: {},
+			mediaText:     {},
+		},
+	}
+	list.Responses["304"] = &openapi.Response{Description: "Not modified"}
+
+	create := op("createPost", "Create a post")
+	create.Parameters = []*openapi.Parameter{
+		{Name: "Idempotency-Key", In: "header", Schema: &openapi.Schema{Type: "string", MaxLength: openapi.Int(255)}},
+	}
+	create.RequestBody = jsonBody(openapi.Ref("PostInput"))
+	create.Responses["201"] = jsonResponse("The created post", openapi.Ref("Post"))
+
+	idParam := &openapi.Parameter{Name: "id", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}}
+	ifMatch := &openapi.Parameter{Name: "If-Match", In: "header", Schema: &openapi.Schema{Type: "string"}}
+	prefer := &openapi.Parameter{Name: "Prefer", In: "header", Schema: &openapi.Schema{Type: "string"}}
+
+	update := op("updatePost", "Replace a post")
+	update.Parameters = []*openapi.Parameter{idParam, ifMatch, prefer}
+	update.RequestBody = jsonBody(openapi.Ref("PostInput"))
+	update.Responses["200"] = jsonResponse("The updated post", openapi.Ref("Post"))
+	update.Responses["204"] = &openapi.Response{Description: "Updated"}
+
+	patch := op("patchPost", "Update some fields of a post")
+	patch.Parameters = []*openapi.Parameter{idParam, ifMatch, prefer}
+	patch.RequestBody = &openapi.RequestBody{
+		Required: true,
+		Content: map[string]openapi.MediaType{
+			mergePatchMediaType: {Schema: openapi.Ref("PostMergePatch")},
+			mediaJSON:           {Schema: openapi.Ref("PostMergePatch")},
+			jsonPatchMediaType:  {Schema: openapi.Ref("JSONPatch")},
+		},
+	}
+	patch.Responses["200"] = jsonResponse("The updated post", openapi.Ref("Post"))
+	patch.Responses["204"] = &openapi.Response{Description: "Updated"}
+
+	remove := op("deletePost", "Delete a post")
+	remove.Parameters = []*openapi.Parameter{idParam, ifMatch}
+	remove.Responses["204"] = &openapi.Response{Description: "Deleted"}
+
+	bulk := op("bulkPosts", "Run several post operations in one transaction")
+	bulk.RequestBody = jsonBody(openapi.Ref("BulkRequest"))
+	bulk.Responses["200"] = jsonResponse("Per-operation results", openapi.Ref("BulkResponse"))
+	bulk.Responses["422"] = jsonResponse("An atomic batch was rolled back", openapi.Ref("BulkResponse"))
+
+	return map[string]openapi.PathItem{
+		prefix + "/posts": {
+			"get":    list,
+			"post":   create,
+			"put":    update,
+			"patch":  patch,
+			"delete": remove,
+		},
+		prefix + "/posts/bulk": {
+			"post": bulk,
+		},
+	}
+}
+
+// RootPaths returns the OpenAPI path item for the root route.
+func RootPaths() map[string]openapi.PathItem {
+	return map[string]openapi.PathItem{
+		"/": {
+			"get": {
+				OperationID: "root",
+				Summary:     "Welcome message",
+				Responses:   map[string]*openapi.Response{"200": textResponse("Welcome message")},
+			},
+		},
+	}
+}
+
+// HealthPaths returns the OpenAPI path item for the health check.
+func HealthPaths() map[string]openapi.PathItem {
+	check := &openapi.Schema{
+		Type:     "object",
+		Required: []string{"status"},
+		Properties: map[string]*openapi.Schema{
+			"status": {Type: "string", Enum: []interface{}{healthOK, healthUnavailable, healthDisabled}},
+			"error":  {Type: "string"},
+			"since":  {Type: "string", Format: "date-time"},
+		},
+	}
+	report := &openapi.Schema{
+		Type:     "object",
+		Required: []string{"status", "checks"},
+		Properties: map[string]*openapi.Schema{
+			"status": {Type: "string", Enum: []interface{}{healthOK, healthDegraded, healthUnavailable}},
+			"checks": {
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"postgres": check, "sqlite": check, "redis": check, "replicas": check},
+			},
+		},
+	}
+	return map[string]openapi.PathItem{
+		"/healthz": {
+			"get": {
+				OperationID: "getHealth",
+				Summary:     "Health of the service and its dependencies",
+				Security:    []map[string][]string{{}},
+				Responses: map[string]*openapi.Response{
+					"200": jsonResponse("The service is up, possibly degraded without Redis", report),
+					"503": jsonResponse("The database is unavailable", report),
+				},
+			},
+		},
+	}
+}
+
+// ServicePaths returns the OpenAPI path items of the routes describing the
+// service itself: the OpenAPI document and the runtime metrics.
+func ServicePaths() map[string]openapi.PathItem {
+	return map[string]openapi.PathItem{
+		"/openapi.json": {
+			"get": {
+				OperationID: "getOpenAPIDocument",
+				Summary:     "This OpenAPI document",
+				Responses:   map[string]*openapi.Response{"200": jsonResponse("OpenAPI 3.1 document", nil)},
+			},
+		},
+		"/debug/vars": {
+			"get": {
+				OperationID: "getMetrics",
+				Summary:     "Runtime and cache metrics",
+				Responses: map[string]*openapi.Response{
+					"200": jsonResponse("expvar variables, including per-tier cache hits and misses", nil),
+				},
+			},
+		},
+	}
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{mediaJSON: {Schema: schema}}}
+}
+
+func jsonResponse(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: map[string]openapi.MediaType{mediaJSON: {Schema: schema}}}
+}
+
+func textResponse(description string) *openapi.Response {
+	return &openapi.Response{Description: description, Content: map[string]openapi.MediaType{mediaText: {}}}
+}
+
+// GraphQLPaths returns the OpenAPI path item for the GraphQL endpoint.
+func GraphQLPaths() map[string]openapi.PathItem {
+	result := jsonResponse("GraphQL result", &openapi.Schema{Type: "object"})
+	return map[string]openapi.PathItem{
+		"/graphql": {
+			"get": {
+				OperationID: "graphqlQuery",
+				Summary:     "Run a GraphQL query",
+				Tags:        []string{"graphql"},
+				Parameters: []*openapi.Parameter{
+					{Name: "query", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+					{Name: "operationName", In: "query", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "variables", In: "query", Description: "JSON-encoded variables", Schema: &openapi.Schema{Type: "string"}},
+				},
+				Responses: map[string]*openapi.Response{"200": result, "default": result},
+			},
+			"post": {
+				OperationID: "graphqlExecute",
+				Summary:     "Run a GraphQL operation",
+				Tags:        []string{"graphql"},
+				RequestBody: jsonBody(&openapi.Schema{
+					Type:     "object",
+					Required: []string{"query"},
+					Properties: map[string]*openapi.Schema{
+						"query":         {Type: "string"},
+						"operationName": {OneOf: []*openapi.Schema{{Type: "string"}, {Type: "null"}}},
+						"variables":     {OneOf: []*openapi.Schema{{Type: "object"}, {Type: "null"}}},
+					},
+				}),
+				Responses: map[string]*openapi.Response{"200": result, "default": result},
+			},
+		},
+	}
+}
+
+// EventPaths returns the OpenAPI path item for the post change event stream.
+func EventPaths() map[string]openapi.PathItem {
+	return map[string]openapi.PathItem{
+		"/events": {
+			"get": {
+				OperationID: "streamPostEvents",
+				Summary:     "Stream post changes as Server-Sent Events",
+				Tags:        []string{"events"},
+				Parameters: []*openapi.Parameter{
+					{Name: "Last-Event-ID", In: "header", Description: "Resume after this event", Schema: &openapi.Schema{Type: "string"}},
+					{Name: "lastEventId", In: "query", Description: "Resume after this event, for clients that cannot set headers", Schema: &openapi.Schema{Type: "string"}},
+				},
+				Responses: map[string]*openapi.Response{
+					"200": {
+						Description: "post.created, post.published, post.updated and post.deleted events. A post is published as it is created, so post.published follows its post.created event.",
+						Content:     map[string]openapi.MediaType{"text/event-stream": {}},
+					},
+					"503":     textResponse("Redis, which holds the stream, is unavailable"),
+					"default": textResponse("Error"),
+				},
+			},
+		},
+	}
+}
+
+// WebhookSchemas returns the component schemas referenced by WebhookPaths.
+func WebhookSchemas() map[string]*openapi.Schema {
+	str := &openapi.Schema{Type: "string"}
+	timestamp := &openapi.Schema{Type: "string", Format: "date-time"}
+	events := &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "string", Enum: []interface{}{postCreated, postPublished, postUpdated, postDeleted}}}
+	return map[string]*openapi.Schema{
+		"Webhook": {
+			Type:        "object",
+			Description: "A webhook subscription. The secret is only returned when the webhook is created.",
+			Required:    []string{"id", "url", "events", "active"},
+			Properties: map[string]*openapi.Schema{
+				"id":         {Type: "string", Format: "uuid"},
+				"url":        {Type: "string", Format: "uri"},
+				"secret":     str,
+				"events":     events,
+				"active":     {Type: "boolean"},
+				"created_at": timestamp,
+				"updated_at": timestamp,
+			},
+		},
+		"WebhookInput": {
+			Type:     "object",
+			Required: []string{"url"},
+			Properties: map[string]*openapi.Schema{
+				"url":    {Type: "string", Format: "uri"},
+				"secret": {Type: "string", Description: "Signing secret; generated when omitted on create, kept when omitted on update"},
+				"events": events,
+				"active": {Type: "boolean"},
+			},
+		},
+		"WebhookDelivery": {
+			Type:     "object",
+			Required: []string{"id", "webhook_id", "event_type", "status", "attempts"},
+			Properties: map[string]*openapi.Schema{
+				"id":              {Type: "string", Format: "uuid"},
+				"webhook_id":      {Type: "string", Format: "uuid"},
+				"event_type":      str,
+				"payload":         {Type: "object"},
+				"status":          {Type: "string", Enum: []interface{}{"pending", "succeeded", "failed"}},
+				"attempts":        {Type: "integer"},
+				"next_attempt_at": timestamp,
+				"created_at":      timestamp,
+				"delivered_at":    timestamp,
+				"attempt_log": {
+					Type: "array",
+					Items: &openapi.Schema{
+						Type: "object",
+						Properties: map[string]*openapi.Schema{
+							"attempted_at": timestamp,
+							"status_code":  {Type: "integer"},
+							"error":        str,
+							"duration_ms":  {Type: "integer"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// WebhookPaths returns the OpenAPI path items for the webhook admin routes mounted under prefix.
+func WebhookPaths(prefix string) map[string]openapi.PathItem {
+	op := func(id, summary string) *openapi.Operation {
+		return &openapi.Operation{
+			OperationID: id,
+			Summary:     summary,
+			Tags:        []string{"webhooks"},
+			Responses:   map[string]*openapi.Response{"default": textResponse("Error")},
+		}
+	}
+	idParam := &openapi.Parameter{Name: "id", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}}
+
+	list := op("getWebhooks", "List webhooks, or fetch one webhook when id is given")
+	list.Parameters = []*openapi.Parameter{
+		{Name: "id", In: "query", Description: "Return a single webhook", Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+	}
+	list.Responses["200"] = jsonResponse("Webhooks, or a single webhook when id is given", &openapi.Schema{OneOf: []*openapi.Schema{
+		{Type: "array", Items: openapi.Ref("Webhook")},
+		openapi.Ref("Webhook"),
+	}})
+
+	create := op("createWebhook", "Create a webhook")
+	create.RequestBody = jsonBody(openapi.Ref("WebhookInput"))
+	create.Responses["201"] = jsonResponse("The created webhook, including its secret", openapi.Ref("Webhook"))
+
+	update := op("updateWebhook", "Replace a webhook")
+	update.Parameters = []*openapi.Parameter{idParam}
+	update.RequestBody = jsonBody(openapi.Ref("WebhookInput"))
+	update.Responses["200"] = jsonResponse("The updated webhook", openapi.Ref("Webhook"))
+
+	remove := op("deleteWebhook", "Delete a webhook and its deliveries")
+	remove.Parameters = []*openapi.Parameter{idParam}
+	remove.Responses["204"] = &openapi.Response{Description: "Deleted"}
+
+	deliveries := op("getWebhookDeliveries", "List recent deliveries, or fetch one delivery with its attempts when id is given")
+	deliveries.Parameters = []*openapi.Parameter{
+		{Name: "id", In: "query", Description: "Return a single delivery with its attempt log", Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+		{Name: "webhook_id", In: "query", Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+		{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"pending", "succeeded", "failed"}}},
+	}
+	deliveries.Responses["200"] = jsonResponse("Deliveries, or a single delivery when id is given", &openapi.Schema{OneOf: []*openapi.Schema{
+		{Type: "array", Items: openapi.Ref("WebhookDelivery")},
+		openapi.Ref("WebhookDelivery"),
+	}})
+
+	redeliver := op("redeliverWebhook", "Queue a delivery for an immediate retry")
+	redeliver.Parameters = []*openapi.Parameter{idParam}
+	redeliver.Responses["202"] = &openapi.Response{Description: "Queued"}
+
+	return map[string]openapi.PathItem{
+		prefix + "/admin/webhooks": {
+			"get":    list,
+			"post":   create,
+			"put":    update,
+			"delete": remove,
+		},
+		prefix + "/admin/webhooks/deliveries": {
+			"get": deliveries,
+		},
+		prefix + "/admin/webhooks/deliveries/redeliver": {
+			"post": redeliver,
+		},
+	}
+}
+
+// CachePaths returns the OpenAPI path items of the cache admin API under prefix.
+func CachePaths(prefix string) map[string]openapi.PathItem {
+	op := func(id, summary string) *openapi.Operation {
+		return &openapi.Operation{
+			OperationID: id,
+			Summary:     summary,
+			Tags:        []string{"cache"},
+			Responses:   map[string]*openapi.Response{"default": textResponse("Error")},
+		}
+	}
+
+	invalidate := op("invalidateCache", "Purge every cache entry tagged with one of the given tags")
+	invalidate.RequestBody = jsonBody(&openapi.Schema{
+		Type:     "object",
+		Required: []string{"tags"},
+		Properties: map[string]*openapi.Schema{
+			"tags": {Type: "array", Items: &openapi.Schema{Type: "string"}, Description: `"posts" for the listing, "post:<id>" for a post`},
+		},
+	})
+	invalidate.Responses["200"] = jsonResponse("The purged cache keys", &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"keys": {Type: "array", Items: &openapi.Schema{Type: "string"}}},
+	})
+
+	flush := op("flushCache", "Discard every cache entry by bumping the cache namespace version")
+	flush.Responses["200"] = jsonResponse("The new namespace version", &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"version": {Type: "integer"}},
+	})
+
+	return map[string]openapi.PathItem{
+		prefix + "/admin/cache/invalidate": {"post": invalidate},
+		prefix + "/admin/cache/flush":      {"post": flush},
+	}
+}
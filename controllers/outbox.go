@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"blogklert/outbox"
+	"blogklert/queue"
+	"blogklert/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PostChangeRecorder returns a store.Postgres Record hook writing the events
+// of each post change to the outbox, stamped by clock. The events commit with
+// the change.
+func PostChangeRecorder(clock func() time.Time) func(ctx context.Context, q queue.Execer, change store.Change) error {
+	return func(ctx context.Context, q queue.Execer, change store.Change) error {
+		at := clock().UTC()
+		for _, eventType := range postEventTypes(change.Type) {
+			event := postEvent{Type: eventType, ID: change.PostID.String(), Version: change.Version, At: at}
+			if err := outbox.Write(ctx, q, eventType, event.ID, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// postEventTypes returns the types of the events emitted for a change: its
+// own, followed by postPublished for a created post.
+func postEventTypes(change string) []string {
+	if change == store.Created {
+		return []string{postCreated, postPublished}
+	}
+	return []string{change}
+}
+
+// RegisterOutboxHandlers registers the side effects of post changes with
+// relay: cache invalidation, the event stream and webhook delivery. When
+// reads are spread over replicas at most replicaLag behind, the cache is
+// invalidated again once that has passed, dropping anything filled from a
+// replica that had not applied the change yet.
+func (h *Handlers) RegisterOutboxHandlers(relay *outbox.Relay, replicaLag time.Duration) {
+	invalidate := postEventHandler(func(ctx context.Context, event postEvent) error {
+		return h.deletePostCache(ctx, event.ID)
+	})
+	relay.Register("cache", invalidate)
+	if replicaLag > 0 {
+		relay.RegisterDelayed("cache-replicas", replicaLag, invalidate)
+	}
+	relay.Register("events", postEventHandler(h.publishPostEvent))
+	relay.Register("webhooks", postEventHandler(h.enqueuePostWebhooks))
+}
+
+// postEventHandler adapts fn to an outbox handler decoding post events.
+func postEventHandler(fn func(ctx context.Context, event postEvent) error) outbox.Handler {
+	return func(ctx context.Context, event outbox.Event) error {
+		var data postEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return fmt.Errorf("error decoding post event %d: %w", event.ID, err)
+		}
+		return fn(ctx, data)
+	}
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"blogklert/store"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// outboxRecorder collects the events written to the outbox.
+type outboxRecorder struct {
+	events []postEvent
+}
+
+func (r *outboxRecorder) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	var event postEvent
+	if err := json.Unmarshal([]byte(args[2].(string)), &event); err != nil {
+		return nil, err
+	}
+	r.events = append(r.events, event)
+	return nil, nil
+}
+
+func TestPostChangeRecorder(t *testing.T) {
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	record := PostChangeRecorder(func() time.Time { return at })
+	tests := []struct {
+		change    string
+		wantTypes []string
+	}{
+		{change: store.Created, wantTypes: []string{postCreated, postPublished}},
+		{change: store.Updated, wantTypes: []string{postUpdated}},
+		{change: store.Deleted, wantTypes: []string{postDeleted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.change, func(t *testing.T) {
+			q := &outboxRecorder{}
+			change := store.Change{Type: tt.change, PostID: uuid.New(), Version: 2}
+			if err := record(context.Background(), q, change); err != nil {
+				t.Fatalf("record() error = %v", err)
+			}
+			var types []string
+			for _, event := range q.events {
+				types = append(types, event.Type)
+				if event.ID != change.PostID.String() || event.Version != change.Version || !event.At.Equal(at) {
+					t.Errorf("event = %+v, want post %s version %d at %v", event, change.PostID, change.Version, at)
+				}
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("event types = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
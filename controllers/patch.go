@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"blogklert/models"
+	"blogklert/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not match the stored post.
+var errPatchTestFailed = errors.New("patch test operation failed")
+
+// postChanges maps a patchable field name to its new value.
+type postChanges map[string]string
+
+// decodeMergePatch reads an RFC 7396 JSON Merge Patch document.
+func decodeMergePatch(r io.Reader) (postChanges, error) {
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid merge patch document: %w", err)
+	}
+
+	changes := postChanges{}
+	for name, raw := range doc {
+		if !isPatchableField(name) {
+			return nil, fmt.Errorf("field %q cannot be patched", name)
+		}
+		if string(raw) == "null" {
+			return nil, fmt.Errorf("%s is required and cannot be removed", name)
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("%s must be a string", name)
+		}
+		changes[name] = value
+	}
+	return changes, nil
+}
+
+// jsonPatchOperation is a single RFC 6902 JSON Patch operation.
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// decodeJSONPatch reads an RFC 6902 JSON Patch document and applies it to current.
+func decodeJSONPatch(r io.Reader, current models.Post) (postChanges, error) {
+	var ops []jsonPatchOperation
+	if err := json.NewDecoder(r).Decode(&ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch document: %w", err)
+	}
+
+	fields := map[string]string{
+		"title":   current.Title,
+		"excerpt": current.Excerpt,
+		"body":    current.Body,
+	}
+	changes := postChanges{}
+	for i, op := range ops {
+		name, err := patchPointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			var value string
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d: %s must be a string", i, name)
+			}
+			if op.Op == "test" {
+				if fields[name] != value {
+					return nil, fmt.Errorf("operation %d: %s does not match: %w", i, name, errPatchTestFailed)
+				}
+				continue
+			}
+			fields[name] = value
+			changes[name] = value
+		case "copy":
+			from, err := patchPointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			fields[name] = fields[from]
+			changes[name] = fields[from]
+		case "remove", "move":
+			return nil, fmt.Errorf("operation %d: %s would remove a required field", i, op.Op)
+		default:
+			return nil, fmt.Errorf("operation %d: unsupported op %q", i, op.Op)
+		}
+	}
+	return changes, nil
+}
+
+// patchPointer resolves a JSON Pointer to a patchable field name.
+func patchPointer(pointer string) (string, error) {
+	name := strings.TrimPrefix(pointer, "/")
+	if name == pointer || !isPatchableField(name) {
+		return "", fmt.Errorf("path %q cannot be patched", pointer)
+	}
+	return name, nil
+}
+
+func isPatchableField(name string) bool {
+	for _, field := range store.Patchable {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"blogklert/cache"
+	"blogklert/models"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    postChanges
+		wantErr bool
+	}{
+		{name: "Replace members", doc: `{"title":"New","body":"Text"}`, want: postChanges{"title": "New", "body": "Text"}},
+		{name: "Empty document", doc: `{}`, want: postChanges{}},
+		{name: "Null removes a required member", doc: `{"excerpt":null}`, wantErr: true},
+		{name: "Unknown member", doc: `{"author":"Ann"}`, wantErr: true},
+		{name: "Read-only member", doc: `{"id":"x"}`, wantErr: true},
+		{name: "Non-string value", doc: `{"title":1}`, wantErr: true},
+		{name: "Not an object", doc: `["title"]`, wantErr: true},
+		{name: "Invalid JSON", doc: `{"title":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMergePatch(strings.NewReader(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeMergePatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeMergePatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	current := models.Post{Title: "Old", Excerpt: "Short", Body: "Text"}
+	tests := []struct {
+		name       string
+		doc        string
+		want       postChanges
+		wantErr    bool
+		testFailed bool
+	}{
+		{name: "Replace", doc: `[{"op":"replace","path":"/title","value":"New"}]`, want: postChanges{"title": "New"}},
+		{name: "Add replaces an existing member", doc: `[{"op":"add","path":"/excerpt","value":"Longer"}]`, want: postChanges{"excerpt": "Longer"}},
+		{name: "Test then replace", doc: `[{"op":"test","path":"/title","value":"Old"},{"op":"replace","path":"/title","value":"New"}]`, want: postChanges{"title": "New"}},
+		{name: "Test sees earlier operations", doc: `[{"op":"replace","path":"/title","value":"New"},{"op":"test","path":"/title","value":"New"}]`, want: postChanges{"title": "New"}},
+		{name: "Copy", doc: `[{"op":"copy","from":"/title","path":"/excerpt"}]`, want: postChanges{"excerpt": "Old"}},
+		{name: "Copy after replace", doc: `[{"op":"replace","path":"/title","value":"New"},{"op":"copy","from":"/title","path":"/body"}]`, want: postChanges{"title": "New", "body": "New"}},
+		{name: "Empty patch", doc: `[]`, want: postChanges{}},
+		{name: "Test failure", doc: `[{"op":"test","path":"/title","value":"Other"}]`, wantErr: true, testFailed: true},
+		{name: "Remove", doc: `[{"op":"remove","path":"/excerpt"}]`, wantErr: true},
+		{name: "Move", doc: `[{"op":"move","from":"/title","path":"/excerpt"}]`, wantErr: true},
+		{name: "Unsupported op", doc: `[{"op":"merge","path":"/title","value":"New"}]`, wantErr: true},
+		{name: "Missing value", doc: `[{"op":"replace","path":"/title"}]`, wantErr: true},
+		{name: "Non-string value", doc: `[{"op":"replace","path":"/title","value":null}]`, wantErr: true},
+		{name: "Bad pointer", doc: `[{"op":"replace","path":"title","value":"New"}]`, wantErr: true},
+		{name: "Unknown member", doc: `[{"op":"add","path":"/author","value":"Ann"}]`, wantErr: true},
+		{name: "Bad copy source", doc: `[{"op":"copy","from":"/id","path":"/title"}]`, wantErr: true},
+		{name: "Not an array", doc: `{"op":"replace"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeJSONPatch(strings.NewReader(tt.doc), current)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSONPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, errPatchTestFailed); got != tt.testFailed {
+				t.Errorf("decodeJSONPatch() test failed = %v, want %v (error %v)", got, tt.testFailed, err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeJSONPatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchPointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    string
+		wantErr bool
+	}{
+		{pointer: "/title", want: "title"},
+		{pointer: "/body", want: "body"},
+		{pointer: "title", wantErr: true},
+		{pointer: "", wantErr: true},
+		{pointer: "/", wantErr: true},
+		{pointer: "/id", wantErr: true},
+		{pointer: "/title/0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			got, err := patchPointer(tt.pointer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("patchPointer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("patchPointer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchPost(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		header      map[string]string
+		// missing patches a post that does not exist.
+		missing bool
+		// changed updates the post behind the cache after it was read.
+		changed    bool
+		wantStatus int
+		wantTitle  string
+	}{
+		{name: "Merge patch", contentType: mergePatchMediaType, body: `{"title":"New"}`, wantStatus: http.StatusNoContent, wantTitle: "New"},
+		{name: "Plain JSON is a merge patch", contentType: "application/json", body: `{"title":"New"}`, wantStatus: http.StatusNoContent, wantTitle: "New"},
+		{name: "Merge patch removing a member", contentType: mergePatchMediaType, body: `{"title":null}`, wantStatus: http.StatusBadRequest, wantTitle: "Original"},
+		{name: "JSON Patch", contentType: jsonPatchMediaType, body: `[{"op":"test","path":"/title","value":"Original"},{"op":"replace","path":"/title","value":"New"}]`, wantStatus: http.StatusNoContent, wantTitle: "New"},
+		{name: "JSON Patch test failure", contentType: jsonPatchMediaType, body: `[{"op":"test","path":"/title","value":"Other"}]`, wantStatus: http.StatusConflict, wantTitle: "Original"},
+		{name: "JSON Patch with a bad pointer", contentType: jsonPatchMediaType, body: `[{"op":"replace","path":"/slug","value":"x"}]`, wantStatus: http.StatusBadRequest, wantTitle: "Original"},
+		{name: "JSON Patch of a missing post", contentType: jsonPatchMediaType, body: `[]`, missing: true, wantStatus: http.StatusNotFound},
+		{name: "JSON Patch of a post changed since it was read", contentType: jsonPatchMediaType, body: `[{"op":"test","path":"/title","value":"Original"},{"op":"replace","path":"/body","value":"New body"}]`, changed: true, wantStatus: http.StatusPreconditionFailed, wantTitle: "Changed"},
+		{name: "JSON Patch with a mismatched If-Match", contentType: jsonPatchMediaType, body: `[]`, header: map[string]string{"If-Match": `"v7"`}, wantStatus: http.StatusPreconditionFailed, wantTitle: "Original"},
+		{name: "Unsupported media type", contentType: "text/plain", body: `title=New`, wantStatus: http.StatusUnsupportedMediaType, wantTitle: "Original"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, router := newTestHandlers(t, PostConfig{Cache: cache.NewLRU(10, 0)})
+			post := createTestPost(t, h.Posts.Store, "Original")
+			target := "/v1/posts?id=" + post.ID.String()
+			if tt.missing {
+				target = "/v1/posts?id=00000000-0000-0000-0000-000000000000"
+			}
+
+			// Read the post so the cache holds it.
+			if rec := serve(router, "GET", target, "", nil); rec.Code != http.StatusOK && !tt.missing {
+				t.Fatalf("GET status = %d", rec.Code)
+			}
+			if tt.changed {
+				if _, err := h.Posts.Store.Patch(context.Background(), post.ID, map[string]string{"title": "Changed"}, nil); err != nil {
+					t.Fatalf("Patch() error = %v", err)
+				}
+			}
+
+			header := map[string]string{"Content-Type": tt.contentType}
+			for name, value := range tt.header {
+				header[name] = value
+			}
+			rec := serve(router, "PATCH", target, tt.body, header)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("PATCH status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType && rec.Header().Get("Accept-Patch") == "" {
+				t.Error("Accept-Patch header is missing")
+			}
+			if tt.missing {
+				return
+			}
+
+			stored, err := h.Posts.Store.Get(context.Background(), post.ID, nil)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if stored.Title != tt.wantTitle {
+				t.Errorf("stored title = %q, want %q", stored.Title, tt.wantTitle)
+			}
+		})
+	}
+}
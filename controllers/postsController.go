@@ -1,178 +1,237 @@
 package controllers
 
 import (
-	"blogklert/db"
+	"blogklert/cache"
 	"blogklert/middlewares"
 	"blogklert/models"
+	"blogklert/store"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func SetupPostRoutes(r *mux.Router) {
+// PostPolicies selects the sanitization policy applied to each post field.
+type PostPolicies struct {
+	Title   middlewares.SanitizePolicy
+	Excerpt middlewares.SanitizePolicy
+	Body    middlewares.SanitizePolicy
+}
+
+// DefaultPostPolicies are used when no policies are configured.
+var DefaultPostPolicies = PostPolicies{
+	Title:   middlewares.PlainTextPolicy,
+	Excerpt: middlewares.PlainTextPolicy,
+	Body:    middlewares.RichBodyPolicy,
+}
+
+// PostConfig holds the settings used by the post handlers.
+type PostConfig struct {
+	// Store reads and writes posts.
+	Store    store.PostStore
+	Policies PostPolicies
+	// RequireIfMatch rejects PUT, PATCH and DELETE requests without an If-Match header.
+	RequireIfMatch bool
+	HTTPCache      HTTPCacheConfig
+	// IdempotencyTTL is how long Idempotency-Key responses for CreatePost are kept.
+	IdempotencyTTL time.Duration
+	// Cache holds post projections and their validators.
+	Cache cache.Cache
+	// CacheLoader fills Cache on misses without stampeding the store.
+	CacheLoader *cache.Loader
+	CacheTTL    CacheTTLConfig
+}
+
+// Word limits applied to each post field during sanitization.
+const (
+	maxTitleWords   = 15
+	maxExcerptWords = 60
+	maxBodyWords    = 10000
+)
+
+// SetupPostRoutes mounts the posts API on r, serving responses shaped for version.
+// It may be called once per mounted API version.
+func (h *Handlers) SetupPostRoutes(r *mux.Router, version APIVersion) {
 	postsRouter := r.PathPrefix("/posts").Subrouter()
-	postsRouter.HandleFunc("", GetPosts).Methods("GET")
-	postsRouter.HandleFunc("", GetPost).Methods("GET").Queries("id", "{id}")
-	postsRouter.HandleFunc("", CreatePost).Methods("POST")
-	postsRouter.HandleFunc("", UpdatePost).Methods("PUT").Queries("id", "{id}")
-	postsRouter.HandleFunc("", DeletePost).Methods("DELETE").Queries("id", "{id}")
+	postsRouter.Use(withAPIVersion(version))
+	postsRouter.HandleFunc("", h.GetPosts).Methods("GET")
+	postsRouter.HandleFunc("", h.GetPost).Methods("GET").Queries("id", "{id}")
+	postsRouter.Handle("", h.idempotent(http.HandlerFunc(h.CreatePost), "POST /posts", h.Posts.IdempotencyTTL)).Methods("POST")
+	postsRouter.HandleFunc("", h.UpdatePost).Methods("PUT").Queries("id", "{id}")
+	postsRouter.HandleFunc("", h.PatchPost).Methods("PATCH").Queries("id", "{id}")
+	postsRouter.HandleFunc("/bulk", h.BulkPosts).Methods("POST")
+	postsRouter.HandleFunc("", h.DeletePost).Methods("DELETE").Queries("id", "{id}")
+}
+
+// idempotent replays Idempotency-Key responses from Redis. Keys are ignored,
+// with a log, when Redis is not configured or while its circuit is open: the
+// write goes ahead without idempotency rather than failing.
+func (h *Handlers) idempotent(next http.Handler, route string, ttl time.Duration) http.Handler {
+	if h.Redis == nil {
+		h.idempotencyWarning.Do(func() {
+			h.Logger.Println("Redis is not configured: Idempotency-Key headers are ignored.")
+		})
+		return next
+	}
+	return middlewares.Idempotency(middlewares.NewRedisIdempotencyStore(h.Redis), ttl, route)(next)
 }
 
-func GetPosts(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) GetPosts(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
 	if id != "" {
-		GetPost(w, r)
+		h.GetPost(w, r)
 		return
 	}
 
-	ctx := r.Context()
-	posts, err := fetchPosts(ctx)
+	fields, err := parseFields(r, summaryFields)
 	if err != nil {
-		httpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, posts, http.StatusOK)
-}
+	mediaType, ok := negotiatePostType(w, r)
+	if !ok {
+		return
+	}
 
-func fetchPosts(ctx context.Context) ([]models.Post, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "posts").Result()
-	if err == nil {
-		var posts []models.Post
-		if err := json.Unmarshal([]byte(cachedData), &posts); err != nil {
-			return nil, fmt.Errorf("error unmarshalling cached posts data: %w", err)
-		}
-		return posts, nil
-	} else if !errors.Is(err, redis.Nil) {
-		return nil, fmt.Errorf("error fetching posts from Redis cache: %w", err)
+	ctx := r.Context()
+	variant := cacheVariant(fields, mediaType)
+	if meta, ok := h.loadCacheMeta(ctx, postsCacheKey, variant); ok && notModified(r, meta) {
+		h.respondNotModified(w, meta, meta.SurrogateKeys...)
+		return
 	}
 
-	rows, err := db.DB.QueryContext(ctx, "SELECT id, title, excerpt, body, created_at FROM posts")
+	posts, stale, err := h.fetchPosts(ctx, fields)
 	if err != nil {
-		return nil, fmt.Errorf("error querying database: %w", err)
+		h.httpError(w, "Failed to fetch posts", http.StatusInternalServerError, err)
+		return
 	}
-	defer func() {
-		if closeErr := rows.Close(); closeErr != nil {
-			err = fmt.Errorf("error closing rows: %w", closeErr)
-		}
-	}()
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Excerpt, &post.Body, &post.CreatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
-		}
-		posts = append(posts, post)
+	meta := postsMeta(posts, fields, mediaType)
+	if !stale {
+		h.storeCacheMeta(ctx, postsCacheKey, variant, meta)
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	if notModified(r, meta) {
+		h.respondNotModified(w, meta, meta.SurrogateKeys...)
+		return
 	}
 
-	jsonData, err := json.Marshal(posts)
-	if err == nil {
-		const CacheTime = 7 * 24 * time.Hour
-		db.RedisClient.Set(ctx, "posts", jsonData, CacheTime)
-	}
+	h.setCacheHeaders(w, meta, meta.SurrogateKeys...)
+	h.respondPosts(w, r, mediaType, posts, fields)
+}
 
-	return posts, nil
+// fetchPosts returns every post with the projected columns populated, and
+// whether the listing is stale. Each projection is cached as a separate field
+// of the listing's cache hash. After a write the previous listing keeps being
+// served for CacheTTL.Stale while a single reader rebuilds it.
+func (h *Handlers) fetchPosts(ctx context.Context, fields projection) ([]models.Post, bool, error) {
+	return cache.FetchStale(ctx, h.Posts.CacheLoader, postsCacheKey, fields.key(), h.cacheTTL(postsCacheKey), cacheTags(postsCacheKey),
+		func(ctx context.Context) ([]models.Post, error) {
+			return h.Posts.Store.List(ctx, fields.columns())
+		})
 }
 
-func GetPost(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) GetPost(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
 		http.Error(w, "ID parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	ctx := r.Context()
-	post, err := fetchPost(ctx, idStr)
+	fields, err := parseFields(r, postFields)
 	if err != nil {
-		httpError(w, "Post not found", http.StatusNotFound, err)
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
 		return
 	}
 
-	respondJSON(w, post, http.StatusOK)
-}
+	mediaType, ok := negotiatePostType(w, r)
+	if !ok {
+		return
+	}
 
-func fetchPost(ctx context.Context, postID string) (models.Post, error) {
-	cachedData, err := db.RedisClient.Get(ctx, "post:"+postID).Result()
-	if err == nil {
-		var post models.Post
-		if err := json.Unmarshal([]byte(cachedData), &post); err != nil {
-			return models.Post{}, fmt.Errorf("error unmarshalling cached post data: %w", err)
-		}
-		return post, nil
-	} else if !errors.Is(err, redis.Nil) {
-		return models.Post{}, fmt.Errorf("error fetching post %s from Redis cache: %w", postID, err)
+	ctx := r.Context()
+	cacheKey := postCacheKey(idStr)
+	variant := cacheVariant(fields, mediaType)
+	if meta, ok := h.loadCacheMeta(ctx, cacheKey, variant); ok && notModified(r, meta) {
+		h.respondNotModified(w, meta, postSurrogateKey(idStr))
+		return
 	}
 
-	var post models.Post
-	err = db.DB.QueryRowContext(ctx, "SELECT id, title, excerpt, body, created_at FROM posts WHERE id = $1", postID).
-		Scan(&post.ID, &post.Title, &post.Excerpt, &post.Body, &post.CreatedAt)
+	post, err := h.fetchPost(ctx, idStr, fields)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Post{}, fmt.Errorf("post %s not found: %w", postID, sql.ErrNoRows)
-		}
-		return models.Post{}, fmt.Errorf("error querying database: %w", err)
+		h.httpError(w, "Post not found", http.StatusNotFound, err)
+		return
 	}
 
-	jsonData, err := json.Marshal(post)
-	if err == nil {
-		const CacheTime = 7 * 24 * time.Hour
-		db.RedisClient.Set(ctx, "post:"+postID, jsonData, CacheTime)
+	meta := postMeta(post, fields, mediaType)
+	h.storeCacheMeta(ctx, cacheKey, variant, meta)
+	if notModified(r, meta) {
+		h.respondNotModified(w, meta, postSurrogateKey(idStr))
+		return
 	}
 
-	return post, nil
+	h.setCacheHeaders(w, meta, postSurrogateKey(idStr))
+	h.respondPost(w, r, mediaType, post, fields)
+}
+
+// fetchPost returns a single post with the projected columns populated. It
+// never serves stale data, so writers can read their own changes.
+func (h *Handlers) fetchPost(ctx context.Context, postID string, fields projection) (models.Post, error) {
+	cacheKey := postCacheKey(postID)
+	return cache.Fetch(ctx, h.Posts.CacheLoader, cacheKey, fields.key(), h.cacheTTL(cacheKey), cacheTags(cacheKey),
+		func(ctx context.Context) (models.Post, error) {
+			id, err := uuid.Parse(postID)
+			if err != nil {
+				return models.Post{}, fmt.Errorf("post %s: %w", postID, store.ErrNotFound)
+			}
+			return h.Posts.Store.Get(ctx, id, fields.columns())
+		})
 }
 
-func CreatePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var post models.Post
 	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
-		httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
 		return
 	}
 
-	post.Title = middlewares.SanitizeInput(post.Title, 15)
-	post.Excerpt = middlewares.SanitizeInput(post.Excerpt, 60)
-	post.Body = middlewares.SanitizeInput(post.Body, 10000)
+	h.sanitizePost(&post)
 
 	if err := validatePost(post); err != nil {
-		httpError(w, err.Error(), http.StatusBadRequest, err)
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
 		return
 	}
 
-	if err := insertPost(ctx, post); err != nil {
-		httpError(w, "Failed to create post", http.StatusInternalServerError, err)
+	created, err := insertPost(ctx, h.Posts.Store, post)
+	if err != nil {
+		h.httpError(w, "Failed to create post", http.StatusInternalServerError, err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "posts")
-	respondJSON(w, nil, http.StatusCreated)
+	h.invalidatePostCache(ctx)
+	w.Header().Set("Location", postLocation(r, created.ID))
+	w.Header().Set("ETag", postETag(created.Version))
+	respondData(w, r, created, http.StatusCreated)
 }
 
-func insertPost(ctx context.Context, post models.Post) error {
-	// Ensure ID and CreatedAt are set
+// insertPost stores a new post with a generated ID and slug and returns it
+// with its timestamps and version set.
+func insertPost(ctx context.Context, s store.PostStore, post models.Post) (models.Post, error) {
 	post.ID = uuid.New()
-	post.CreatedAt = time.Now()
-	_, err := db.DB.ExecContext(ctx, "INSERT INTO posts (id, title, excerpt, body, created_at) VALUES ($1, $2, $3, $4, $5)",
-		post.ID, post.Title, post.Excerpt, post.Body, post.CreatedAt)
-	return err
+	post.Slug = models.PostSlug(post.Title, post.ID)
+	return s.Create(ctx, post)
 }
 
-func UpdatePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
@@ -182,43 +241,124 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
 		return
 	}
 
 	var post models.Post
 	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
-		httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
 		return
 	}
 
-	post.Title = middlewares.SanitizeInput(post.Title, 15)
-	post.Excerpt = middlewares.SanitizeInput(post.Excerpt, 60)
-	post.Body = middlewares.SanitizeInput(post.Body, 10000)
+	h.sanitizePost(&post)
 
 	if err := validatePost(post); err != nil {
-		httpError(w, err.Error(), http.StatusBadRequest, err)
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	expected, err := h.checkIfMatch(ctx, r, id)
+	if err != nil {
+		h.writeError(w, "Failed to update post", err)
 		return
 	}
 
 	post.ID = id
-	if err := updatePost(ctx, post); err != nil {
-		httpError(w, "Failed to update post", http.StatusInternalServerError, err)
+	version, err := h.Posts.Store.Update(ctx, post, expected)
+	if err != nil {
+		h.writeError(w, "Failed to update post", err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "post:"+idStr)
-	db.RedisClient.Del(ctx, "posts")
-	respondJSON(w, nil, http.StatusNoContent)
+	h.invalidatePostCache(ctx, idStr)
+	h.respondUpdated(w, r, idStr, version)
 }
 
-func updatePost(ctx context.Context, post models.Post) error {
-	_, err := db.DB.ExecContext(ctx, "UPDATE posts SET title = $1, excerpt = $2, body = $3, created_at = $4 WHERE id = $5",
-		post.Title, post.Excerpt, post.Body, post.CreatedAt, post.ID)
-	return err
+// PatchPost applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) document to a post.
+func (h *Handlers) PatchPost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "Post ID is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	mediaType := mergePatchMediaType
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			h.httpError(w, "Invalid Content-Type header", http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var (
+		changes postChanges
+		// base is the version a JSON Patch was evaluated against.
+		base *int
+	)
+	switch mediaType {
+	case mergePatchMediaType, "application/json":
+		changes, err = decodeMergePatch(r.Body)
+	case jsonPatchMediaType:
+		current, fetchErr := h.fetchPost(ctx, idStr, postFields)
+		if fetchErr != nil {
+			h.writeError(w, "Failed to fetch post", fetchErr)
+			return
+		}
+		base = &current.Version
+		changes, err = decodeJSONPatch(r.Body, current)
+	default:
+		w.Header().Set("Accept-Patch", mergePatchMediaType+", "+jsonPatchMediaType)
+		h.httpError(w, "Unsupported patch media type", http.StatusUnsupportedMediaType, errors.New(mediaType))
+		return
+	}
+	if err != nil {
+		if errors.Is(err, errPatchTestFailed) {
+			h.httpError(w, err.Error(), http.StatusConflict, err)
+			return
+		}
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.sanitizeChanges(changes); err != nil {
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	expected, err := h.checkIfMatch(ctx, r, id)
+	if err != nil {
+		h.writeError(w, "Failed to update post", err)
+		return
+	}
+	// The test and copy operations of a JSON Patch read the post, so the
+	// patch only applies to the version they read.
+	if base != nil {
+		if expected != nil && *expected != *base {
+			h.writeError(w, "Failed to update post", store.ErrVersionMismatch)
+			return
+		}
+		expected = base
+	}
+
+	version, err := h.Posts.Store.Patch(ctx, id, changes, expected)
+	if err != nil {
+		h.writeError(w, "Failed to update post", err)
+		return
+	}
+
+	h.invalidatePostCache(ctx, idStr)
+	h.respondUpdated(w, r, idStr, version)
 }
 
-func DeletePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) DeletePost(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
@@ -228,23 +368,48 @@ func DeletePost(w http.ResponseWriter, r *http.Request) {
 
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
 		return
 	}
 
-	if err := deletePost(ctx, id); err != nil {
-		httpError(w, "Failed to delete post", http.StatusInternalServerError, err)
+	expected, err := h.checkIfMatch(ctx, r, id)
+	if err != nil {
+		h.writeError(w, "Failed to delete post", err)
 		return
 	}
 
-	db.RedisClient.Del(ctx, "post:"+idStr)
-	db.RedisClient.Del(ctx, "posts")
+	if err := h.Posts.Store.Delete(ctx, id, expected); err != nil {
+		h.writeError(w, "Failed to delete post", err)
+		return
+	}
+
+	h.invalidatePostCache(ctx, idStr)
 	respondJSON(w, nil, http.StatusNoContent)
 }
 
-func deletePost(ctx context.Context, id uuid.UUID) error {
-	_, err := db.DB.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
-	return err
+func (h *Handlers) sanitizePost(post *models.Post) {
+	post.Title = h.Posts.Policies.Title.Sanitize(post.Title, maxTitleWords)
+	post.Excerpt = h.Posts.Policies.Excerpt.Sanitize(post.Excerpt, maxExcerptWords)
+	post.Body = h.Posts.Policies.Body.Sanitize(post.Body, maxBodyWords)
+}
+
+// sanitizeChanges sanitizes and validates only the fields present in a patch.
+func (h *Handlers) sanitizeChanges(changes postChanges) error {
+	for name, value := range changes {
+		switch name {
+		case "title":
+			value = h.Posts.Policies.Title.Sanitize(value, maxTitleWords)
+		case "excerpt":
+			value = h.Posts.Policies.Excerpt.Sanitize(value, maxExcerptWords)
+		case "body":
+			value = h.Posts.Policies.Body.Sanitize(value, maxBodyWords)
+		}
+		if value == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+		changes[name] = value
+	}
+	return nil
 }
 
 func validatePost(post models.Post) error {
@@ -260,6 +425,38 @@ func validatePost(post models.Post) error {
 	return nil
 }
 
+// prefersRepresentation reports whether the client sent Prefer: return=representation.
+func prefersRepresentation(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(token), " ", ""), "return=representation") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// respondUpdated answers a successful PUT or PATCH, returning the updated post
+// when the client asked for it with Prefer: return=representation.
+func (h *Handlers) respondUpdated(w http.ResponseWriter, r *http.Request, postID string, version int) {
+	w.Header().Set("ETag", postETag(version))
+	if !prefersRepresentation(r) {
+		respondJSON(w, nil, http.StatusNoContent)
+		return
+	}
+
+	post, err := h.fetchPost(r.Context(), postID, postFields)
+	if err != nil {
+		h.httpError(w, "Failed to fetch updated post", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", postETag(post.Version))
+	w.Header().Set("Preference-Applied", "return=representation")
+	respondData(w, r, post, http.StatusOK)
+}
+
 func respondJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -271,7 +468,7 @@ func respondJSON(w http.ResponseWriter, data interface{}, status int) {
 	}
 }
 
-func httpError(w http.ResponseWriter, message string, status int, err error) {
-	log.Printf("HTTP %d - %s: %v", status, message, err)
+func (h *Handlers) httpError(w http.ResponseWriter, message string, status int, err error) {
+	h.Logger.Printf("HTTP %d - %s: %v", status, message, err)
 	http.Error(w, message, status)
 }
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"blogklert/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreatePost(t *testing.T) {
+	_, router := newTestHandlers(t, PostConfig{})
+	rec := serve(router, "POST", "/v1/posts", `{"title":"Hello, World!","excerpt":"An excerpt","body":"A body"}`, map[string]string{"Content-Type": "application/json"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var created models.Post
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if want := models.PostSlug("Hello, World!", created.ID); created.Slug != want {
+		t.Errorf("slug = %q, want %q", created.Slug, want)
+	}
+	if created.Version != 1 || created.CreatedAt.IsZero() || created.Body != "A body" {
+		t.Errorf("created post = %+v, want the stored post", created)
+	}
+	if got := rec.Header().Get("ETag"); got != `"v1"` {
+		t.Errorf("ETag = %s, want \"v1\"", got)
+	}
+
+	location := rec.Header().Get("Location")
+	if location != "/v1/posts?id="+created.ID.String() {
+		t.Fatalf("Location = %q, want the post under /v1", location)
+	}
+	if rec := serve(router, "GET", location, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET Location status = %d", rec.Code)
+	}
+}
+
+func TestPreferRepresentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		prefer string
+		want   bool
+	}{
+		{name: "PUT without preference", method: "PUT"},
+		{name: "PUT", method: "PUT", prefer: "return=representation", want: true},
+		{name: "PATCH", method: "PATCH", prefer: "return=representation", want: true},
+		{name: "Minimal", method: "PATCH", prefer: "return=minimal"},
+		{name: "Among other preferences", method: "PATCH", prefer: "respond-async, return=representation; foo=bar", want: true},
+		{name: "Case and spaces", method: "PUT", prefer: "Return = Representation", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, router := newTestHandlers(t, PostConfig{})
+			post := createTestPost(t, h.Posts.Store, "Original")
+
+			header := map[string]string{"Content-Type": "application/json"}
+			if tt.prefer != "" {
+				header["Prefer"] = tt.prefer
+			}
+			rec := serve(router, tt.method, "/v1/posts?id="+post.ID.String(), `{"title":"Updated","excerpt":"An excerpt","body":"A body"}`, header)
+
+			if got := rec.Header().Get("ETag"); got != `"v2"` {
+				t.Errorf("ETag = %s, want \"v2\"", got)
+			}
+			if !tt.want {
+				if rec.Code != http.StatusNoContent || rec.Header().Get("Preference-Applied") != "" {
+					t.Errorf("got %d with Preference-Applied %q, want 204 without it", rec.Code, rec.Header().Get("Preference-Applied"))
+				}
+				return
+			}
+			if rec.Code != http.StatusOK || rec.Header().Get("Preference-Applied") != "return=representation" {
+				t.Fatalf("got %d with Preference-Applied %q, want 200 with return=representation", rec.Code, rec.Header().Get("Preference-Applied"))
+			}
+			var updated models.Post
+			if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if updated.Title != "Updated" || updated.Version != 2 {
+				t.Errorf("returned post = %+v, want the updated post", updated)
+			}
+		})
+	}
+}
+
+func TestPrefersRepresentation(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    bool
+	}{
+		{headers: nil, want: false},
+		{headers: []string{"return=representation"}, want: true},
+		{headers: []string{"return=minimal"}, want: false},
+		{headers: []string{"handling=lenient", "return=representation"}, want: true},
+		{headers: []string{"return=representation-ish"}, want: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/v1/posts", nil)
+		for _, value := range tt.headers {
+			req.Header.Add("Prefer", value)
+		}
+		if got := prefersRepresentation(req); got != tt.want {
+			t.Errorf("prefersRepresentation(%q) = %v, want %v", tt.headers, got, tt.want)
+		}
+	}
+}
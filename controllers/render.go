@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"blogklert/middlewares"
+	"blogklert/models"
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// Representations served by GetPost and GetPosts, in server preference order.
+const (
+	mediaJSON     = "application/json"
+	mediaHTML     = "text/html"
+	mediaMarkdown = "text/markdown"
+	mediaText     = "text/plain"
+)
+
+var postMediaTypes = []string{mediaJSON, mediaHTML, mediaMarkdown, mediaText}
+
+// negotiatePostType selects the representation for a post read. It sets
+// Vary: Accept and answers 406 when no representation is acceptable.
+func negotiatePostType(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := middlewares.NegotiateContentType(r.Header.Get("Accept"), postMediaTypes)
+	if mediaType == "" {
+		http.Error(w, "Not Acceptable. Supported types: "+strings.Join(postMediaTypes, ", "), http.StatusNotAcceptable)
+		return "", false
+	}
+	return mediaType, true
+}
+
+var postTemplates = template.Must(template.New("post").Funcs(template.FuncMap{
+	"paragraphs": paragraphs,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{if .Title}}{{.Title}}{{else}}Post{{end}}</title></head>
+<body>
+<article>
+{{- if .Title}}
+<h1>{{.Title}}</h1>{{end}}
+{{- if not .CreatedAt.IsZero}}
+<time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "January 2, 2006"}}</time>{{end}}
+{{- if .Excerpt}}
+<p><em>{{.Excerpt}}</em></p>{{end}}
+{{- range paragraphs .Body}}
+<p>{{.}}</p>{{end}}
+</article>
+</body>
+</html>
+`))
+
+var _ = template.Must(postTemplates.New("posts").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Posts</title></head>
+<body>
+<ul>
+{{- range .Posts}}
+<li><a href="{{$.Prefix}}/posts?id={{.ID}}">{{if .Title}}{{.Title}}{{else}}{{.ID}}{{end}}</a>{{if .Excerpt}} <p>{{.Excerpt}}</p>{{end}}</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// paragraphs splits a body into its blank-line separated paragraphs.
+func paragraphs(body string) []string {
+	var out []string
+	for _, p := range strings.Split(body, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// respondPost writes a single post in the negotiated representation.
+func (h *Handlers) respondPost(w http.ResponseWriter, r *http.Request, mediaType string, post models.Post, fields projection) {
+	switch mediaType {
+	case mediaHTML:
+		h.respondTemplate(w, "post", post)
+	case mediaMarkdown:
+		h.respondText(w, mediaMarkdown, postMarkdown(post, ""))
+	case mediaText:
+		h.respondText(w, mediaText, postText(post))
+	default:
+		respondData(w, r, projectedPost{post: post, fields: fields}, http.StatusOK)
+	}
+}
+
+// respondPosts writes a post listing in the negotiated representation.
+func (h *Handlers) respondPosts(w http.ResponseWriter, r *http.Request, mediaType string, posts []models.Post, fields projection) {
+	switch mediaType {
+	case mediaHTML:
+		h.respondTemplate(w, "posts", struct {
+			Prefix string
+			Posts  []models.Post
+		}{apiVersionFrom(r.Context()).Prefix, posts})
+	case mediaMarkdown, mediaText:
+		var b strings.Builder
+		for i, post := range posts {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if mediaType == mediaMarkdown {
+				b.WriteString(postMarkdown(post, postLocation(r, post.ID)))
+			} else {
+				b.WriteString(postText(post))
+			}
+		}
+		h.respondText(w, mediaType, b.String())
+	default:
+		respondData(w, r, project(posts, fields), http.StatusOK)
+	}
+}
+
+// markdownEscaper backslash-escapes the characters that would turn plain
+// text into Markdown syntax, and folds line breaks that would end a heading.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"#", `\#`, "!", `\!`, "<", `\<`, ">", `\>`, "|", `\|`, "~", `\~`, "\r\n", " ", "\n", " ", "\r", " ",
+)
+
+// postMarkdown renders a post as Markdown; listings pass a link for each title.
+func postMarkdown(post models.Post, link string) string {
+	var b strings.Builder
+	title := markdownEscaper.Replace(post.Title)
+	switch {
+	case title != "" && link != "":
+		fmt.Fprintf(&b, "# [%s](%s)\n\n", title, link)
+	case title != "":
+		fmt.Fprintf(&b, "# %s\n\n", title)
+	}
+	if post.Excerpt != "" {
+		fmt.Fprintf(&b, "> %s\n\n", post.Excerpt)
+	}
+	if post.Body != "" {
+		b.WriteString(post.Body + "\n")
+	}
+	return b.String()
+}
+
+// postText renders a post as plain text with an underlined title.
+func postText(post models.Post) string {
+	var b strings.Builder
+	if post.Title != "" {
+		b.WriteString(post.Title + "\n" + strings.Repeat("=", len([]rune(post.Title))) + "\n\n")
+	}
+	if post.Excerpt != "" {
+		b.WriteString(post.Excerpt + "\n\n")
+	}
+	if post.Body != "" {
+		b.WriteString(post.Body + "\n")
+	}
+	return b.String()
+}
+
+func (h *Handlers) respondTemplate(w http.ResponseWriter, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := postTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		h.httpError(w, "Failed to render response", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", mediaHTML+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		h.Logger.Printf("Error writing response: %v", err)
+	}
+}
+
+func (h *Handlers) respondText(w http.ResponseWriter, mediaType, body string) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(body)); err != nil {
+		h.Logger.Printf("Error writing response: %v", err)
+	}
+}
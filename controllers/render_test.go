@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"blogklert/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPostMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		link  string
+		want  string
+	}{
+		{name: "Plain title", title: "Hello", want: "# Hello\n\n"},
+		{name: "Link metacharacters", title: "Arrays [0] (and slices)", link: "/v1/posts?id=1", want: `# [Arrays \[0\] \(and slices\)](/v1/posts?id=1)` + "\n\n"},
+		{name: "Emphasis and code", title: "*Not* _bold_ `code`", want: "# \\*Not\\* \\_bold\\_ \\`code\\`\n\n"},
+		{name: "Closing hashes", title: "C# ##", want: `# C\# \#\#` + "\n\n"},
+		{name: "HTML and backslashes", title: `<b>\o/</b>`, want: `# \<b\>\\o/\</b\>` + "\n\n"},
+		{name: "Line breaks", title: "One\nTwo", want: "# One Two\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postMarkdown(models.Post{Title: tt.title}, tt.link)
+			if got != tt.want {
+				t.Errorf("postMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostNegotiation(t *testing.T) {
+	const title = "Why [brackets] (and *stars*) break # links"
+	tests := []struct {
+		name        string
+		target      string
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantContain string
+	}{
+		{name: "Default JSON", target: "/v1/posts?id={id}", wantStatus: http.StatusOK, wantType: mediaJSON, wantContain: `"title":"Why [brackets]`},
+		{name: "Markdown post", target: "/v1/posts?id={id}", accept: mediaMarkdown, wantStatus: http.StatusOK, wantType: mediaMarkdown,
+			wantContain: `# Why \[brackets\] \(and \*stars\*\) break \# links` + "\n"},
+		{name: "Markdown listing", target: "/v1/posts", accept: mediaMarkdown, wantStatus: http.StatusOK, wantType: mediaMarkdown,
+			wantContain: `# [Why \[brackets\] \(and \*stars\*\) break \# links](/v1/posts?id={id})`},
+		{name: "Plain text is not escaped", target: "/v1/posts?id={id}", accept: mediaText, wantStatus: http.StatusOK, wantType: mediaText,
+			wantContain: title + "\n" + strings.Repeat("=", len(title)) + "\n"},
+		{name: "HTML is escaped", target: "/v1/posts?id={id}", accept: mediaHTML, wantStatus: http.StatusOK, wantType: mediaHTML, wantContain: "<h1>Why [brackets]"},
+		{name: "Preferred type", target: "/v1/posts?id={id}", accept: "text/plain;q=0.5, text/markdown", wantStatus: http.StatusOK, wantType: mediaMarkdown},
+		{name: "Not acceptable", target: "/v1/posts?id={id}", accept: "application/xml", wantStatus: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, router := newTestHandlers(t, PostConfig{})
+			post := createTestPost(t, h.Posts.Store, title)
+
+			var header map[string]string
+			if tt.accept != "" {
+				header = map[string]string{"Accept": tt.accept}
+			}
+			rec := serve(router, "GET", replaceID(tt.target, post.ID), "", header)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary = %q, want Accept", rec.Header().Get("Vary"))
+			}
+			if tt.wantType == "" {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.wantType)
+			}
+			if want := replaceID(tt.wantContain, post.ID); !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// APIVersion describes one mounted version of the posts API. Versions share
+// the same handlers and storage and differ only in how responses are shaped.
+type APIVersion struct {
+	// Name identifies the version, e.g. "v1".
+	Name string
+	// Prefix is the path the version is mounted under, e.g. "/v1".
+	Prefix string
+	// Envelope wraps successful JSON response bodies.
+	Envelope func(data interface{}) interface{}
+}
+
+// V1 returns resources as bare JSON documents.
+var V1 = APIVersion{
+	Name:     "v1",
+	Prefix:   "/v1",
+	Envelope: func(data interface{}) interface{} { return data },
+}
+
+type apiVersionKey struct{}
+
+// withAPIVersion stores the API version serving the request in its context.
+func withAPIVersion(version APIVersion) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), apiVersionKey{}, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiVersionFrom returns the API version serving the request, defaulting to V1.
+func apiVersionFrom(ctx context.Context) APIVersion {
+	if version, ok := ctx.Value(apiVersionKey{}).(APIVersion); ok {
+		return version
+	}
+	return V1
+}
+
+// respondData writes a JSON response wrapped in the envelope of the request's API version.
+func respondData(w http.ResponseWriter, r *http.Request, data interface{}, status int) {
+	respondJSON(w, apiVersionFrom(r.Context()).Envelope(data), status)
+}
+
+// postLocation returns the canonical URL of a single post under the request's API version.
+func postLocation(r *http.Request, id uuid.UUID) string {
+	return apiVersionFrom(r.Context()).Prefix + "/posts?id=" + id.String()
+}
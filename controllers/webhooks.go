@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"blogklert/db"
+	"blogklert/models"
+	"blogklert/webhooks"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// maxListedDeliveries caps the number of deliveries returned by a listing.
+const maxListedDeliveries = 100
+
+// webhookEvents are the event types a webhook may subscribe to.
+var webhookEvents = map[string]bool{postCreated: true, postPublished: true, postUpdated: true, postDeleted: true}
+
+// webhookInput is the request body for creating or replacing a webhook. An
+// empty Events list subscribes to every event.
+type webhookInput struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// webhookPayload is the body delivered to webhook endpoints.
+type webhookPayload struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      postEvent `json:"data"`
+}
+
+// SetupWebhookRoutes mounts the webhook admin API at /admin/webhooks. Off
+// Postgres it answers 501 Not Implemented.
+func (h *Handlers) SetupWebhookRoutes(r *mux.Router) {
+	adminRouter := r.PathPrefix("/admin/webhooks").Subrouter()
+	if h.Driver != db.Postgres {
+		adminRouter.PathPrefix("").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Webhooks require Postgres", http.StatusNotImplemented)
+		})
+		return
+	}
+	adminRouter.HandleFunc("/deliveries", h.GetWebhookDelivery).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("/deliveries", h.GetWebhookDeliveries).Methods("GET")
+	adminRouter.HandleFunc("/deliveries/redeliver", h.RedeliverWebhook).Methods("POST").Queries("id", "{id}")
+	adminRouter.HandleFunc("", h.GetWebhook).Methods("GET").Queries("id", "{id}")
+	adminRouter.HandleFunc("", h.GetWebhooks).Methods("GET")
+	adminRouter.HandleFunc("", h.CreateWebhook).Methods("POST")
+	adminRouter.HandleFunc("", h.UpdateWebhook).Methods("PUT").Queries("id", "{id}")
+	adminRouter.HandleFunc("", h.DeleteWebhook).Methods("DELETE").Queries("id", "{id}")
+}
+
+// enqueuePostWebhooks queues event for every webhook subscribed to it. It runs
+// as an outbox handler, so a failure is retried.
+func (h *Handlers) enqueuePostWebhooks(ctx context.Context, event postEvent) error {
+	payload, err := json.Marshal(webhookPayload{Type: event.Type, CreatedAt: event.At, Data: event})
+	if err != nil {
+		return fmt.Errorf("error encoding %s webhook payload for post %s: %w", event.Type, event.ID, err)
+	}
+	return webhooks.Enqueue(ctx, h.DB, event.Type, payload)
+}
+
+func (h *Handlers) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.QueryContext(r.Context(),
+		"SELECT id, url, events, active, created_at, updated_at FROM webhooks ORDER BY created_at")
+	if err != nil {
+		h.httpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		var hook models.Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, pq.Array(&hook.Events), &hook.Active, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+			h.httpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+			return
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		h.httpError(w, "Failed to fetch webhooks", http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, hooks, http.StatusOK)
+}
+
+func (h *Handlers) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	hook, err := h.fetchWebhook(r.Context(), id)
+	if err != nil {
+		h.respondWebhookError(w, "Failed to fetch webhook", err)
+		return
+	}
+	respondJSON(w, hook, http.StatusOK)
+}
+
+func (h *Handlers) fetchWebhook(ctx context.Context, id uuid.UUID) (models.Webhook, error) {
+	var hook models.Webhook
+	err := h.DB.QueryRowContext(ctx,
+		"SELECT id, url, events, active, created_at, updated_at FROM webhooks WHERE id = $1", id).
+		Scan(&hook.ID, &hook.URL, pq.Array(&hook.Events), &hook.Active, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("error fetching webhook %s: %w", id, err)
+	}
+	return hook, nil
+}
+
+func (h *Handlers) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var input webhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validateWebhook(input, h.AllowPrivateWebhooks); err != nil {
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+
+	hook := models.Webhook{
+		ID:     uuid.New(),
+		URL:    input.URL,
+		Secret: input.Secret,
+		Events: input.Events,
+		Active: input.Active == nil || *input.Active,
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	if hook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			h.httpError(w, "Failed to create webhook", http.StatusInternalServerError, err)
+			return
+		}
+		hook.Secret = secret
+	}
+
+	err := h.DB.QueryRowContext(r.Context(),
+		"INSERT INTO webhooks (id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at",
+		hook.ID, hook.URL, hook.Secret, pq.Array(hook.Events), hook.Active).Scan(&hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		h.httpError(w, "Failed to create webhook", http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, hook, http.StatusCreated)
+}
+
+// UpdateWebhook replaces a webhook's URL, events and active flag. The secret
+// is rotated only when a new one is given.
+func (h *Handlers) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	var input webhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.httpError(w, "Invalid JSON payload", http.StatusBadRequest, err)
+		return
+	}
+	if err := validateWebhook(input, h.AllowPrivateWebhooks); err != nil {
+		h.httpError(w, err.Error(), http.StatusBadRequest, err)
+		return
+	}
+	if input.Events == nil {
+		input.Events = []string{}
+	}
+
+	result, err := h.DB.ExecContext(ctx,
+		`UPDATE webhooks SET url = $1, events = $2, active = $3, secret = COALESCE(NULLIF($4, ''), secret),
+		updated_at = CURRENT_TIMESTAMP WHERE id = $5`,
+		input.URL, pq.Array(input.Events), input.Active == nil || *input.Active, input.Secret, id)
+	if err != nil {
+		h.httpError(w, "Failed to update webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	hook, err := h.fetchWebhook(ctx, id)
+	if err != nil {
+		h.respondWebhookError(w, "Failed to fetch webhook", err)
+		return
+	}
+	respondJSON(w, hook, http.StatusOK)
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (h *Handlers) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.DB.ExecContext(r.Context(), "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		h.httpError(w, "Failed to delete webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries lists the most recent deliveries, optionally filtered
+// by webhook_id and status.
+func (h *Handlers) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var webhookID interface{}
+	if value := query.Get("webhook_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			h.httpError(w, "Invalid webhook_id parameter", http.StatusBadRequest, err)
+			return
+		}
+		webhookID = id
+	}
+	var status interface{}
+	if value := query.Get("status"); value != "" {
+		if value != webhooks.StatusPending && value != webhooks.StatusSucceeded && value != webhooks.StatusFailed {
+			http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+			return
+		}
+		status = value
+	}
+
+	rows, err := h.DB.QueryContext(r.Context(),
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE ($1::uuid IS NULL OR webhook_id = $1) AND ($2::text IS NULL OR status = $2)
+		ORDER BY created_at DESC LIMIT $3`,
+		webhookID, status, maxListedDeliveries)
+	if err != nil {
+		h.httpError(w, "Failed to fetch deliveries", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			h.httpError(w, "Failed to fetch deliveries", http.StatusInternalServerError, err)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		h.httpError(w, "Failed to fetch deliveries", http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, deliveries, http.StatusOK)
+}
+
+// GetWebhookDelivery returns one delivery with its attempt log.
+func (h *Handlers) GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	delivery, err := scanDelivery(h.DB.QueryRowContext(ctx,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = $1", id))
+	if err != nil {
+		h.respondWebhookError(w, "Failed to fetch delivery", err)
+		return
+	}
+
+	rows, err := h.DB.QueryContext(ctx,
+		"SELECT attempted_at, status_code, error, duration_ms FROM webhook_attempts WHERE delivery_id = $1 ORDER BY attempted_at", id)
+	if err != nil {
+		h.httpError(w, "Failed to fetch delivery attempts", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = []models.WebhookAttempt{}
+	for rows.Next() {
+		var attempt models.WebhookAttempt
+		if err := rows.Scan(&attempt.AttemptedAt, &attempt.StatusCode, &attempt.Error, &attempt.DurationMS); err != nil {
+			h.httpError(w, "Failed to fetch delivery attempts", http.StatusInternalServerError, err)
+			return
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		h.httpError(w, "Failed to fetch delivery attempts", http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, delivery, http.StatusOK)
+}
+
+// RedeliverWebhook queues a delivery for an immediate retry, whatever its
+// current status.
+func (h *Handlers) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		h.httpError(w, "Invalid ID parameter", http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := h.DB.ExecContext(r.Context(),
+		"UPDATE webhook_deliveries SET status = $1, next_attempt_at = CURRENT_TIMESTAMP, delivered_at = NULL WHERE id = $2",
+		webhooks.StatusPending, id)
+	if err != nil {
+		h.httpError(w, "Failed to redeliver webhook", http.StatusInternalServerError, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+const deliveryColumns = "id, webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at, delivered_at"
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.DeliveredAt)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	delivery.Payload = payload
+	return delivery, nil
+}
+
+// validateWebhook checks the URL and event filter of a webhook. Unless
+// allowPrivate is set, the URL may not name a loopback or private address.
+func validateWebhook(input webhookInput, allowPrivate bool) error {
+	target, err := url.Parse(input.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if !allowPrivate {
+		if err := webhooks.CheckHost(target.Hostname()); err != nil {
+			return errors.New("url must not point at a private or loopback address")
+		}
+	}
+	for _, event := range input.Events {
+		if !webhookEvents[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// respondWebhookError maps a missing row to 404 and anything else to 500.
+func (h *Handlers) respondWebhookError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		h.httpError(w, "Not found", http.StatusNotFound, err)
+		return
+	}
+	h.httpError(w, message, http.StatusInternalServerError, err)
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"blogklert/db"
+	"blogklert/models"
+	"blogklert/webhooks"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        webhookInput
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{name: "Public URL", input: webhookInput{URL: "https://hooks.example.com/blog"}},
+		{name: "Known events", input: webhookInput{URL: "https://hooks.example.com", Events: []string{postCreated, postPublished, postDeleted}}},
+		{name: "Unknown event", input: webhookInput{URL: "https://hooks.example.com", Events: []string{"post.drafted"}}, wantErr: true},
+		{name: "Relative URL", input: webhookInput{URL: "/hooks"}, wantErr: true},
+		{name: "Other scheme", input: webhookInput{URL: "ftp://hooks.example.com"}, wantErr: true},
+		{name: "Port without host", input: webhookInput{URL: "http://:8080/hooks"}, wantErr: true},
+		{name: "Loopback", input: webhookInput{URL: "http://127.0.0.1:8080/hooks"}, wantErr: true},
+		{name: "Localhost", input: webhookInput{URL: "http://localhost/hooks"}, wantErr: true},
+		{name: "Metadata address", input: webhookInput{URL: "http://169.254.169.254/latest/meta-data"}, wantErr: true},
+		{name: "Private network", input: webhookInput{URL: "https://10.0.0.5/hooks"}, wantErr: true},
+		{name: "IPv6 loopback", input: webhookInput{URL: "http://[::1]/hooks"}, wantErr: true},
+		{name: "Private allowed", input: webhookInput{URL: "http://localhost:8080/hooks"}, allowPrivate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateWebhook(tt.input, tt.allowPrivate); (err != nil) != tt.wantErr {
+				t.Errorf("validateWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookRoutesRequirePostgres(t *testing.T) {
+	h := New(Deps{Driver: db.SQLite, Logger: log.New(io.Discard, "", 0)})
+	router := mux.NewRouter()
+	h.SetupWebhookRoutes(router)
+
+	for _, method := range []string{"GET", "POST"} {
+		if rec := serve(router, method, "/admin/webhooks", "{}", nil); rec.Code != http.StatusNotImplemented {
+			t.Errorf("%s status = %d, want 501", method, rec.Code)
+		}
+	}
+}
+
+// TestWebhookAdmin drives the admin API against the database at TEST_DB_URL,
+// which it migrates and empties of webhooks. It is skipped when unset.
+func TestWebhookAdmin(t *testing.T) {
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	ctx := context.Background()
+	conn, err := sql.Open(db.Postgres, url)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer conn.Close()
+	if _, err := db.Migrate(ctx, conn, db.Postgres); err != nil {
+		t.Fatalf("db.Migrate() error = %v", err)
+	}
+	if _, err := conn.Exec("TRUNCATE webhooks CASCADE"); err != nil {
+		t.Fatalf("error emptying webhooks: %v", err)
+	}
+
+	h := New(Deps{DB: conn, Logger: log.New(io.Discard, "", 0)})
+	router := mux.NewRouter()
+	h.SetupWebhookRoutes(router)
+	jsonHeader := map[string]string{"Content-Type": "application/json"}
+	const missing = "00000000-0000-0000-0000-000000000000"
+
+	if rec := serve(router, "POST", "/admin/webhooks", `{"url":"http://127.0.0.1/hooks"}`, jsonHeader); rec.Code != http.StatusBadRequest {
+		t.Errorf("creating a private webhook status = %d, want 400", rec.Code)
+	}
+
+	rec := serve(router, "POST", "/admin/webhooks", `{"url":"https://hooks.example.com/blog","events":["post.created"]}`, jsonHeader)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	var hook models.Webhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &hook); err != nil {
+		t.Fatalf("decoding webhook: %v", err)
+	}
+	if hook.Secret == "" || !hook.Active {
+		t.Errorf("created webhook = %+v, want an active webhook with a generated secret", hook)
+	}
+	id := hook.ID.String()
+
+	t.Run("Read", func(t *testing.T) {
+		rec := serve(router, "GET", "/admin/webhooks?id="+id, "", nil)
+		var got models.Webhook
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.ID != hook.ID || got.Secret != "" {
+			t.Errorf("GET = %d %s, want the webhook without its secret", rec.Code, rec.Body)
+		}
+		if rec := serve(router, "GET", "/admin/webhooks?id="+missing, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET missing status = %d, want 404", rec.Code)
+		}
+		var hooks []models.Webhook
+		if rec := serve(router, "GET", "/admin/webhooks", "", nil); json.Unmarshal(rec.Body.Bytes(), &hooks) != nil || len(hooks) != 1 {
+			t.Errorf("listing = %s, want the one webhook", rec.Body)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rec := serve(router, "PUT", "/admin/webhooks?id="+id, `{"url":"https://hooks.example.com/v2","active":false}`, jsonHeader)
+		var got models.Webhook
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.URL != "https://hooks.example.com/v2" || got.Active {
+			t.Errorf("PUT = %d %s, want the updated, inactive webhook", rec.Code, rec.Body)
+		}
+		var secret string
+		if err := conn.QueryRow("SELECT secret FROM webhooks WHERE id = $1", id).Scan(&secret); err != nil || secret != hook.Secret {
+			t.Errorf("secret after update = %q, %v; want it kept", secret, err)
+		}
+		if rec := serve(router, "PUT", "/admin/webhooks?id="+id, `{"url":"https://hooks.example.com","events":["post.read"]}`, jsonHeader); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT with an unknown event status = %d, want 400", rec.Code)
+		}
+		if rec := serve(router, "PUT", "/admin/webhooks?id="+missing, `{"url":"https://hooks.example.com"}`, jsonHeader); rec.Code != http.StatusNotFound {
+			t.Errorf("PUT missing status = %d, want 404", rec.Code)
+		}
+		if _, err := conn.Exec("UPDATE webhooks SET active = TRUE WHERE id = $1", id); err != nil {
+			t.Fatalf("error reactivating webhook: %v", err)
+		}
+	})
+
+	if err := webhooks.Enqueue(ctx, conn, postCreated, []byte(`{"type":"post.created"}`)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	var deliveryID string
+	if err := conn.QueryRow("SELECT id FROM webhook_deliveries").Scan(&deliveryID); err != nil {
+		t.Fatalf("error reading delivery: %v", err)
+	}
+
+	t.Run("Deliveries", func(t *testing.T) {
+		tests := []struct {
+			query      string
+			wantStatus int
+			wantCount  int
+		}{
+			{query: "", wantStatus: http.StatusOK, wantCount: 1},
+			{query: "?webhook_id=" + id + "&status=pending", wantStatus: http.StatusOK, wantCount: 1},
+			{query: "?status=failed", wantStatus: http.StatusOK, wantCount: 0},
+			{query: "?webhook_id=" + missing, wantStatus: http.StatusOK, wantCount: 0},
+			{query: "?status=lost", wantStatus: http.StatusBadRequest},
+			{query: "?webhook_id=x", wantStatus: http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			rec := serve(router, "GET", "/admin/webhooks/deliveries"+tt.query, "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET deliveries%s status = %d, want %d", tt.query, rec.Code, tt.wantStatus)
+				continue
+			}
+			var deliveries []models.WebhookDelivery
+			if tt.wantStatus == http.StatusOK && (json.Unmarshal(rec.Body.Bytes(), &deliveries) != nil || len(deliveries) != tt.wantCount) {
+				t.Errorf("GET deliveries%s = %s, want %d deliveries", tt.query, rec.Body, tt.wantCount)
+			}
+		}
+
+		rec := serve(router, "GET", "/admin/webhooks/deliveries?id="+deliveryID, "", nil)
+		var delivery models.WebhookDelivery
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &delivery) != nil || delivery.Status != webhooks.StatusPending {
+			t.Errorf("GET delivery = %d %s, want the pending delivery", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("Redeliver", func(t *testing.T) {
+		if _, err := conn.Exec("UPDATE webhook_deliveries SET status = $1, next_attempt_at = CURRENT_TIMESTAMP + interval '1 hour'", webhooks.StatusFailed); err != nil {
+			t.Fatalf("error failing delivery: %v", err)
+		}
+		if rec := serve(router, "POST", "/admin/webhooks/deliveries/redeliver?id="+deliveryID, "", nil); rec.Code != http.StatusAccepted {
+			t.Fatalf("redeliver status = %d, want 202", rec.Code)
+		}
+		var status string
+		var due bool
+		err := conn.QueryRow("SELECT status, next_attempt_at <= CURRENT_TIMESTAMP FROM webhook_deliveries WHERE id = $1", deliveryID).Scan(&status, &due)
+		if err != nil || status != webhooks.StatusPending || !due {
+			t.Errorf("redelivered delivery = %s (due %v), %v; want pending and due", status, due, err)
+		}
+		if rec := serve(router, "POST", "/admin/webhooks/deliveries/redeliver?id="+missing, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("redeliver missing status = %d, want 404", rec.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if rec := serve(router, "DELETE", "/admin/webhooks?id="+id, "", nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("DELETE status = %d, want 204", rec.Code)
+		}
+		if rec := serve(router, "DELETE", "/admin/webhooks?id="+id, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("second DELETE status = %d, want 404", rec.Code)
+		}
+		if rec := serve(router, "GET", "/admin/webhooks/deliveries?id="+deliveryID, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET delivery of a deleted webhook status = %d, want 404", rec.Code)
+		}
+	})
+}
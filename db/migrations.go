@@ -1,46 +1,148 @@
 package db
 
 import (
+	"blogklert/models"
 	"context"
+	"database/sql"
+	"embed"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log"
-	"path/filepath"
-	"time"
 
 	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
 )
 
-// MigrateConfig defines the configuration needed for database migrations
-type MigrateConfig struct {
-	DBURL string
+// migrationFiles holds the migrations of every driver, in a directory named
+// after it, so the binary runs them from any working directory.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// MigrationsDir is the source directory of the migrations written for
+// driver, relative to the repository root.
+func MigrationsDir(driver string) string {
+	return "db/migrations/" + driver
 }
 
-// Migrate runs the database migrations using the provided configuration
-func Migrate(cfg MigrateConfig) error {
-	// Create a context with a timeout for database initialization
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// goose names the SQL dialect of each driver.
+var gooseDialects = map[string]goose.Dialect{Postgres: goose.DialectPostgres, SQLite: goose.DialectSQLite3}
+
+// NewMigrator returns a goose provider for the embedded migrations written
+// for driver. On Postgres every run holds a session advisory lock, so
+// replicas booting together apply each migration once.
+func NewMigrator(db *sql.DB, driver string) (*goose.Provider, error) {
+	dialect, ok := gooseDialects[driver]
+	if !ok {
+		return nil, errors.New("no migrations for database driver " + driver)
+	}
+	files, err := fs.Sub(migrationFiles, "migrations/"+driver)
+	if err != nil {
+		return nil, errors.New("failed to read embedded migrations: " + err.Error())
+	}
 
-	// Initialize the database connection with the context
-	if err := InitDB(ctx, cfg.DBURL); err != nil {
-		return errors.New("failed to initialize database: " + err.Error())
+	var options []goose.ProviderOption
+	if driver == Postgres {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, errors.New("failed to create migration lock: " + err.Error())
+		}
+		options = append(options, goose.WithSessionLocker(locker), goose.WithGoMigrations(postgresGoMigrations()...))
 	}
 
-	// Get the absolute path to the migrations directory
-	migrationsDir, err := filepath.Abs("db/migrations")
+	provider, err := goose.NewProvider(dialect, db, files, options...)
 	if err != nil {
-		return errors.New("failed to get absolute path to migrations directory: " + err.Error())
+		return nil, errors.New("failed to load migrations: " + err.Error())
 	}
+	return provider, nil
+}
 
-	// Run database migrations
-	if err := goose.SetDialect("postgres"); err != nil {
-		return errors.New("failed to set dialect: " + err.Error())
+// Migrate runs the pending migrations written for driver on db and reports
+// whether any was applied, in which case cached data may be outdated.
+func Migrate(ctx context.Context, db *sql.DB, driver string) (bool, error) {
+	migrator, err := NewMigrator(db, driver)
+	if err != nil {
+		return false, err
 	}
 
-	if err := goose.Up(DB, migrationsDir); err != nil {
-		return errors.New("failed to run migrations: " + err.Error())
+	results, err := migrator.Up(ctx)
+	if err != nil {
+		return false, errors.New("failed to run migrations: " + err.Error())
+	}
+	for _, result := range results {
+		log.Printf("applied migration %s in %s", MigrationName(result.Source), result.Duration)
 	}
 
 	log.Println("database migration check complete. All migrations are up to date")
-	return nil
+	return len(results) > 0, nil
+}
+
+// goMigrationNames names the migrations written in Go, which have no file.
+var goMigrationNames = map[int64]string{
+	addPostsSlugVersion: "add_posts_slug",
+}
+
+// MigrationName names a migration in logs: its file, or for a migration
+// written in Go, its version and name.
+func MigrationName(source *goose.Source) string {
+	if source.Path != "" {
+		return source.Path
+	}
+	return fmt.Sprintf("%d_%s (Go)", source.Version, goMigrationNames[source.Version])
+}
+
+// postgresGoMigrations returns the Postgres migrations written in Go, which
+// run between the SQL files by version.
+func postgresGoMigrations() []*goose.Migration {
+	return []*goose.Migration{
+		goose.NewGoMigration(addPostsSlugVersion, &goose.GoFunc{RunTx: addPostsSlug}, &goose.GoFunc{RunTx: dropPostsSlug}),
+	}
+}
+
+const addPostsSlugVersion = 20261018100000
+
+// addPostsSlug adds the unique slug column, filled in with models.PostSlug
+// so existing posts get the slug the API gives new ones.
+func addPostsSlug(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE posts ADD COLUMN slug VARCHAR(255)"); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, title FROM posts")
+	if err != nil {
+		return err
+	}
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.ID, &post.Title); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET slug = $1 WHERE id = $2", models.PostSlug(post.Title, post.ID), post.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE posts ALTER COLUMN slug SET NOT NULL"); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "CREATE UNIQUE INDEX posts_slug_idx ON posts (slug)")
+	return err
+}
+
+func dropPostsSlug(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "DROP INDEX IF EXISTS posts_slug_idx"); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "ALTER TABLE posts DROP COLUMN IF EXISTS slug")
+	return err
 }
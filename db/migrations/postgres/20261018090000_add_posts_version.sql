@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE posts DROP COLUMN IF EXISTS version;
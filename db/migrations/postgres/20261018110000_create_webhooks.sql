@@ -0,0 +1,43 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE webhooks (
+                          id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                          url TEXT NOT NULL,
+                          secret VARCHAR(255) NOT NULL,
+                          events TEXT[] NOT NULL DEFAULT '{}',
+                          active BOOLEAN NOT NULL DEFAULT TRUE,
+                          created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                          updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+                                    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                    webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                                    event_type VARCHAR(64) NOT NULL,
+                                    payload JSONB NOT NULL,
+                                    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                    delivered_at TIMESTAMP
+);
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at);
+
+CREATE TABLE webhook_attempts (
+                                  id BIGSERIAL PRIMARY KEY,
+                                  delivery_id UUID NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+                                  attempted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  status_code INTEGER,
+                                  error TEXT,
+                                  duration_ms INTEGER NOT NULL
+);
+CREATE INDEX webhook_attempts_delivery_idx ON webhook_attempts (delivery_id, attempted_at);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS webhook_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
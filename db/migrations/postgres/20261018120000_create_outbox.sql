@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE outbox (
+                        id BIGSERIAL PRIMARY KEY,
+                        event_type VARCHAR(64) NOT NULL,
+                        aggregate_id VARCHAR(255) NOT NULL,
+                        payload JSONB NOT NULL,
+                        handled TEXT[] NOT NULL DEFAULT '{}',
+                        attempts INTEGER NOT NULL DEFAULT 0,
+                        last_error TEXT,
+                        next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        processed_at TIMESTAMP
+);
+CREATE INDEX outbox_unprocessed_idx ON outbox (next_attempt_at) WHERE processed_at IS NULL;
+CREATE INDEX outbox_processed_idx ON outbox (processed_at) WHERE processed_at IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS outbox;
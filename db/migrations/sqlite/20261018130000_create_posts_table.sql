@@ -0,0 +1,45 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Timestamps are UTC text in a fixed-width layout, so they sort by time.
+CREATE TABLE posts (
+                       id TEXT PRIMARY KEY,
+                       slug TEXT NOT NULL,
+                       title TEXT NOT NULL,
+                       excerpt TEXT NOT NULL DEFAULT '',
+                       body TEXT NOT NULL DEFAULT '',
+                       created_at TIMESTAMP NOT NULL,
+                       updated_at TIMESTAMP NOT NULL,
+                       version INTEGER NOT NULL DEFAULT 1
+);
+CREATE UNIQUE INDEX posts_slug_idx ON posts (slug);
+CREATE INDEX posts_created_at_idx ON posts (created_at, id);
+
+-- The trigram tokenizer matches any substring of three or more characters,
+-- ignoring case, like the ILIKE search on Postgres.
+CREATE VIRTUAL TABLE posts_fts USING fts5(title, excerpt, body, content = 'posts', content_rowid = 'rowid', tokenize = 'trigram');
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (rowid, title, excerpt, body) VALUES (new.rowid, new.title, new.excerpt, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, title, excerpt, body) VALUES ('delete', old.rowid, old.title, old.excerpt, old.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_update AFTER UPDATE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, title, excerpt, body) VALUES ('delete', old.rowid, old.title, old.excerpt, old.body);
+    INSERT INTO posts_fts (rowid, title, excerpt, body) VALUES (new.rowid, new.title, new.excerpt, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS posts_fts;
+DROP TABLE IF EXISTS posts;
@@ -6,43 +6,154 @@ import (
 	_ "github.com/lib/pq"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/pressly/goose/v3"
 )
 
-var DB *sql.DB
-
-// InitDB initializes the database connection and sets up Goose for migrations
-func InitDB(ctx context.Context, dataSourceName string) error {
-	var err error
-	DB, err = sql.Open("postgres", dataSourceName)
+// OpenDB opens and pings the database at dataSourceName, on the driver its
+// scheme selects.
+func OpenDB(ctx context.Context, dataSourceName string) (*sql.DB, error) {
+	driver, source := Driver(dataSourceName), dataSourceName
+	if driver == SQLite {
+		source = sqliteSource(dataSourceName)
+	}
+	db, err := sql.Open(driver, source)
 	if err != nil {
-		return errors.New("failed to open database connection: " + err.Error())
+		return nil, errors.New("failed to open database connection: " + err.Error())
 	}
 
 	// Check database connection
-	if err = DB.PingContext(ctx); err != nil {
-		return errors.New("failed to ping database: " + err.Error())
-	}
-
-	// Set up Goose to use the database connection
-	if err := goose.SetDialect("postgres"); err != nil {
-		return errors.New("failed to set Goose dialect: " + err.Error())
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.New("failed to ping database: " + err.Error())
 	}
 
 	// Configure database connection pool settings
-	DB.SetMaxOpenConns(20)
-	DB.SetMaxIdleConns(10)
+	if driver == SQLite {
+		// SQLite has a single writer, and every connection to :memory: would
+		// open a database of its own
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(20)
+		db.SetMaxIdleConns(10)
+	}
 
 	log.Println("Database connection initialized successfully.")
-	return nil
+	return db, nil
+}
+
+// OpenReplicas opens the Postgres read replicas at urls. Replicas are not
+// pinged: one that cannot be reached stays out of rotation until it answers.
+func OpenReplicas(urls []string) ([]*sql.DB, error) {
+	replicas := make([]*sql.DB, 0, len(urls))
+	for _, url := range urls {
+		if Driver(url) != Postgres {
+			closeAll(replicas)
+			return nil, errors.New("read replicas must be Postgres databases")
+		}
+		replica, err := sql.Open(Postgres, url)
+		if err != nil {
+			closeAll(replicas)
+			return nil, errors.New("failed to open read replica connection: " + err.Error())
+		}
+		replica.SetMaxOpenConns(20)
+		replica.SetMaxIdleConns(10)
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+func closeAll(dbs []*sql.DB) {
+	for _, db := range dbs {
+		db.Close()
+	}
 }
 
 // Config holds the application configuration.
 type Config struct {
 	DBURL       string
 	BearerToken string
+	Sanitize    SanitizeConfig
+	// RequireIfMatch makes If-Match mandatory on post writes.
+	RequireIfMatch bool
+	// AllowPrivateWebhooks lets webhooks target loopback and private
+	// addresses, for development against local receivers.
+	AllowPrivateWebhooks bool
+	HTTPCache            HTTPCacheConfig
+	// IdempotencyTTL is how long Idempotency-Key responses are replayed.
+	IdempotencyTTL time.Duration
+	// Unversioned describes the deprecation of the routes mounted without a version prefix.
+	Unversioned DeprecationConfig
+	// DevMode enables development-only checks such as OpenAPI response validation.
+	DevMode bool
+	GraphQL GraphQLConfig
+	// GRPCAddr is the address the gRPC server listens on.
+	GRPCAddr string
+	// APIKeys are accepted by the gRPC server in addition to the bearer token.
+	APIKeys []string
+	Events  EventsConfig
+	Cache   CacheConfig
+	// Redis is optional: without a URL posts are read straight from Postgres.
+	Redis    RedisConfig
+	Replicas ReplicaConfig
+}
+
+// ReplicaConfig lists the Postgres read replicas posts are read from.
+type ReplicaConfig struct {
+	URLs []string
+	// MaxLag takes replicas further behind the primary out of rotation.
+	MaxLag time.Duration
+}
+
+// CacheConfig holds the size of the in-process cache tier and the TTL of each
+// family of cached post data.
+type CacheConfig struct {
+	// LocalSize is the number of keys kept in process; zero disables the tier.
+	LocalSize int
+	// LocalTTL bounds how long a key is kept in process.
+	LocalTTL  time.Duration
+	ListTTL   time.Duration
+	DetailTTL time.Duration
+	// StaleTTL is how long an invalidated listing is served while it is rebuilt.
+	StaleTTL time.Duration
+	// LockTTL bounds how long replicas wait for another one to rebuild a value.
+	LockTTL time.Duration
+}
+
+// EventsConfig holds the connection limits of the event stream.
+type EventsConfig struct {
+	MaxConnections          int
+	MaxConnectionsPerClient int
+	MaxDuration             time.Duration
+}
+
+// GraphQLConfig holds the query cost limits of the GraphQL endpoint.
+type GraphQLConfig struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// DeprecationConfig holds the deprecation and sunset dates of a set of routes.
+// A zero date is not announced.
+type DeprecationConfig struct {
+	DeprecatedAt time.Time
+	Sunset       time.Time
+}
+
+// HTTPCacheConfig holds the caching headers sent with post reads.
+type HTTPCacheConfig struct {
+	CacheControl  string
+	SurrogateKeys bool
+}
+
+// SanitizeConfig names the sanitization policy applied to each post field.
+type SanitizeConfig struct {
+	TitlePolicy   string
+	ExcerptPolicy string
+	BodyPolicy    string
 }
 
 // GetBearerToken retrieves the bearer token from the configuration.
@@ -50,6 +161,26 @@ func (c *Config) GetBearerToken() string {
 	return c.BearerToken
 }
 
+// GetUnversionedDeprecation retrieves the deprecation dates of the unversioned routes.
+func (c *Config) GetUnversionedDeprecation() DeprecationConfig {
+	return c.Unversioned
+}
+
+// GetDevMode reports whether the application runs in development mode.
+func (c *Config) GetDevMode() bool {
+	return c.DevMode
+}
+
+// GetGraphQLConfig retrieves the GraphQL query limits.
+func (c *Config) GetGraphQLConfig() GraphQLConfig {
+	return c.GraphQL
+}
+
+// GetAPIKeys retrieves the API keys accepted by the gRPC server.
+func (c *Config) GetAPIKeys() []string {
+	return c.APIKeys
+}
+
 func LoadEnvConfig() (*Config, error) {
 	dbURL := os.Getenv("DB_URL")
 	if dbURL == "" {
@@ -61,8 +192,155 @@ func LoadEnvConfig() (*Config, error) {
 		return nil, errors.New("bearer token environment variable (BEARER_TOKEN) is not set")
 	}
 
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		return nil, errors.New("invalid IDEMPOTENCY_TTL: " + err.Error())
+	}
+
+	// The unversioned routes have no deprecation or sunset date unless one is
+	// configured, so no deployment announces a sunset nobody chose
+	deprecatedAt, err := getEnvTime("UNVERSIONED_DEPRECATED_AT")
+	if err != nil {
+		return nil, errors.New("invalid UNVERSIONED_DEPRECATED_AT: " + err.Error())
+	}
+
+	sunset, err := getEnvTime("UNVERSIONED_SUNSET")
+	if err != nil {
+		return nil, errors.New("invalid UNVERSIONED_SUNSET: " + err.Error())
+	}
+
+	graphQLMaxDepth, err := strconv.Atoi(getEnv("GRAPHQL_MAX_DEPTH", "10"))
+	if err != nil {
+		return nil, errors.New("invalid GRAPHQL_MAX_DEPTH: " + err.Error())
+	}
+
+	graphQLMaxComplexity, err := strconv.Atoi(getEnv("GRAPHQL_MAX_COMPLEXITY", "1000"))
+	if err != nil {
+		return nil, errors.New("invalid GRAPHQL_MAX_COMPLEXITY: " + err.Error())
+	}
+
+	eventsMaxConnections, err := strconv.Atoi(getEnv("EVENTS_MAX_CONNECTIONS", "100"))
+	if err != nil {
+		return nil, errors.New("invalid EVENTS_MAX_CONNECTIONS: " + err.Error())
+	}
+
+	eventsMaxPerClient, err := strconv.Atoi(getEnv("EVENTS_MAX_CONNECTIONS_PER_CLIENT", "3"))
+	if err != nil {
+		return nil, errors.New("invalid EVENTS_MAX_CONNECTIONS_PER_CLIENT: " + err.Error())
+	}
+
+	eventsMaxDuration, err := time.ParseDuration(getEnv("EVENTS_MAX_DURATION", "1h"))
+	if err != nil {
+		return nil, errors.New("invalid EVENTS_MAX_DURATION: " + err.Error())
+	}
+
+	cacheLocalSize, err := strconv.Atoi(getEnv("CACHE_LOCAL_SIZE", "1000"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_LOCAL_SIZE: " + err.Error())
+	}
+
+	cacheLocalTTL, err := time.ParseDuration(getEnv("CACHE_LOCAL_TTL", "30s"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_LOCAL_TTL: " + err.Error())
+	}
+
+	cacheListTTL, err := time.ParseDuration(getEnv("CACHE_LIST_TTL", "168h"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_LIST_TTL: " + err.Error())
+	}
+
+	cacheDetailTTL, err := time.ParseDuration(getEnv("CACHE_DETAIL_TTL", "168h"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_DETAIL_TTL: " + err.Error())
+	}
+
+	cacheStaleTTL, err := time.ParseDuration(getEnv("CACHE_STALE_TTL", "30s"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_STALE_TTL: " + err.Error())
+	}
+
+	cacheLockTTL, err := time.ParseDuration(getEnv("CACHE_LOCK_TTL", "5s"))
+	if err != nil {
+		return nil, errors.New("invalid CACHE_LOCK_TTL: " + err.Error())
+	}
+
+	replicaMaxLag, err := time.ParseDuration(getEnv("DB_REPLICA_MAX_LAG", "5s"))
+	if err != nil {
+		return nil, errors.New("invalid DB_REPLICA_MAX_LAG: " + err.Error())
+	}
+
 	return &Config{
 		DBURL:       dbURL,
 		BearerToken: bearerToken,
+		Sanitize: SanitizeConfig{
+			TitlePolicy:   getEnv("SANITIZE_TITLE_POLICY", "plain_text"),
+			ExcerptPolicy: getEnv("SANITIZE_EXCERPT_POLICY", "plain_text"),
+			BodyPolicy:    getEnv("SANITIZE_BODY_POLICY", "rich_body"),
+		},
+		RequireIfMatch:       os.Getenv("REQUIRE_IF_MATCH") == "true",
+		AllowPrivateWebhooks: os.Getenv("WEBHOOKS_ALLOW_PRIVATE_TARGETS") == "true",
+		HTTPCache: HTTPCacheConfig{
+			CacheControl:  getEnv("CACHE_CONTROL", "no-cache"),
+			SurrogateKeys: os.Getenv("SURROGATE_KEYS") == "true",
+		},
+		IdempotencyTTL: idempotencyTTL,
+		Unversioned: DeprecationConfig{
+			DeprecatedAt: deprecatedAt,
+			Sunset:       sunset,
+		},
+		DevMode: os.Getenv("APP_ENV") == "development",
+		GraphQL: GraphQLConfig{
+			MaxDepth:      graphQLMaxDepth,
+			MaxComplexity: graphQLMaxComplexity,
+		},
+		GRPCAddr: getEnv("GRPC_ADDR", ":9000"),
+		APIKeys:  splitList(os.Getenv("API_KEYS")),
+		Events: EventsConfig{
+			MaxConnections:          eventsMaxConnections,
+			MaxConnectionsPerClient: eventsMaxPerClient,
+			MaxDuration:             eventsMaxDuration,
+		},
+		Cache: CacheConfig{
+			LocalSize: cacheLocalSize,
+			LocalTTL:  cacheLocalTTL,
+			ListTTL:   cacheListTTL,
+			DetailTTL: cacheDetailTTL,
+			StaleTTL:  cacheStaleTTL,
+			LockTTL:   cacheLockTTL,
+		},
+		Redis: LoadRedisConfig(),
+		Replicas: ReplicaConfig{
+			URLs:   splitList(os.Getenv("DB_REPLICA_URLS")),
+			MaxLag: replicaMaxLag,
+		},
 	}, nil
 }
+
+// getEnv returns the value of the environment variable key, or fallback when it is unset.
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvTime parses an RFC 3339 environment value, returning the zero time
+// when it is unset.
+func getEnvTime(key string) (time.Time, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// splitList splits a comma-separated environment value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"blogklert/breaker"
 	"context"
 	"errors"
 	"fmt"
@@ -10,8 +11,6 @@ import (
 	"time"
 )
 
-var RedisClient *redis.Client
-
 type RedisConfig struct {
 	URL          string
 	PoolSize     int
@@ -19,36 +18,61 @@ type RedisConfig struct {
 	MinIdleConns int
 	ReadTimeout  time.Duration
 	MaxRetries   int
+	// BreakerThreshold consecutive failures open the circuit.
+	BreakerThreshold int
+	// BreakerInterval is how often Redis is probed while the circuit is open.
+	BreakerInterval time.Duration
 }
 
-func init() {
-	config, err := LoadRedisConfig()
-	if err != nil {
-		log.Fatalf("Failed to load Redis configuration: %v", err)
+// LoadRedisConfig reads the Redis settings. Redis is optional: an unset
+// REDIS_URL leaves URL empty and the application runs without it.
+func LoadRedisConfig() RedisConfig {
+	return RedisConfig{
+		URL:              os.Getenv("REDIS_URL"),
+		PoolSize:         10,
+		DialTimeout:      5 * time.Second,
+		MinIdleConns:     5,
+		ReadTimeout:      30 * time.Second,
+		MaxRetries:       3,
+		BreakerThreshold: 5,
+		BreakerInterval:  5 * time.Second,
 	}
+}
 
-	RedisClient, err = NewRedisClient(config)
+// OpenRedis connects to Redis when config.URL is set and returns the client
+// with the breaker tracking whether Redis is reachable; both are nil when
+// Redis is not configured. Commands sent while the breaker is open fail at
+// once with breaker.ErrOpen. A server that cannot be reached starts with the
+// circuit open rather than failing startup; run the breaker to reconnect once
+// it answers.
+func OpenRedis(ctx context.Context, config RedisConfig) (*redis.Client, *breaker.Breaker, error) {
+	if config.URL == "" {
+		log.Println("REDIS_URL is not set: running without Redis.")
+		return nil, nil, nil
+	}
+
+	client, err := NewRedisClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	probe, err := NewRedisClient(RedisConfig{URL: config.URL, PoolSize: 1, DialTimeout: config.DialTimeout})
 	if err != nil {
-		log.Fatalf("Failed to initialize Redis client: %v", err)
+		return nil, nil, err
 	}
 
-	log.Println("Redis connection initialized successfully.")
-}
+	redisBreaker := breaker.New("redis", config.BreakerThreshold, config.BreakerInterval, func(ctx context.Context) error {
+		return probe.Ping(ctx).Err()
+	})
+	client.AddHook(breakerHook{redisBreaker})
 
-func LoadRedisConfig() (RedisConfig, error) {
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		return RedisConfig{}, errors.New("REDIS_URL environment variable is not set")
+	if err := probe.Ping(ctx).Err(); err != nil {
+		redisBreaker.Trip(fmt.Errorf("failed to ping Redis server: %w", err))
+		log.Printf("Redis is unreachable: running degraded until it recovers: %v", err)
+		return client, redisBreaker, nil
 	}
 
-	return RedisConfig{
-		URL:          redisURL,
-		PoolSize:     10,
-		DialTimeout:  30 * time.Second,
-		MinIdleConns: 5,
-		ReadTimeout:  30 * time.Second,
-		MaxRetries:   3,
-	}, nil
+	log.Println("Redis connection initialized successfully.")
+	return client, redisBreaker, nil
 }
 
 func NewRedisClient(config RedisConfig) (*redis.Client, error) {
@@ -57,17 +81,71 @@ func NewRedisClient(config RedisConfig) (*redis.Client, error) {
 		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
 	}
 	opt.DialTimeout = config.DialTimeout
+	opt.PoolSize = config.PoolSize
+	opt.MinIdleConns = config.MinIdleConns
+	opt.ReadTimeout = config.ReadTimeout
+	opt.MaxRetries = config.MaxRetries
+
+	return redis.NewClient(opt), nil
+}
 
-	client := redis.NewClient(opt)
+// breakerHook fails commands fast while the circuit is open and reports
+// connection failures to the breaker.
+type breakerHook struct {
+	breaker *breaker.Breaker
+}
+
+func (h breakerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if !h.breaker.Allow() {
+		return ctx, breaker.ErrOpen
+	}
+	return ctx, nil
+}
+
+func (h breakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.record(cmd.Err())
+	return nil
+}
+
+func (h breakerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	if !h.breaker.Allow() {
+		return ctx, breaker.ErrOpen
+	}
+	return ctx, nil
+}
 
-	if err := client.Ping(context.Background()).Err(); err != nil {
-		return nil, fmt.Errorf("failed to ping Redis server: %v", err)
+func (h breakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if connectionError(cmd.Err()) {
+			h.breaker.Failure(cmd.Err())
+			return nil
+		}
 	}
+	if len(cmds) > 0 {
+		h.record(cmds[0].Err())
+	}
+	return nil
+}
 
-	client.Options().PoolSize = config.PoolSize
-	client.Options().MinIdleConns = config.MinIdleConns
-	client.Options().ReadTimeout = config.ReadTimeout
-	client.Options().MaxRetries = config.MaxRetries
+// record counts err against the breaker. Any reply, including an error
+// reply, shows that Redis is reachable.
+func (h breakerHook) record(err error) {
+	var reply redis.Error
+	if connectionError(err) {
+		h.breaker.Failure(err)
+	} else if err == nil || errors.As(err, &reply) {
+		h.breaker.Success()
+	}
+}
 
-	return client, nil
+// connectionError reports whether err means Redis could not be reached, as
+// opposed to a reply (redis.Nil included) or a caller giving up.
+func connectionError(err error) bool {
+	var reply redis.Error
+	switch {
+	case err == nil, errors.As(err, &reply), errors.Is(err, breaker.ErrOpen),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return true
 }
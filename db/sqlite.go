@@ -0,0 +1,39 @@
+package db
+
+import (
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Database drivers, selected by the scheme of DB_URL.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection: wait for the write
+// lock instead of failing with SQLITE_BUSY.
+const sqlitePragmas = "_pragma=busy_timeout(5000)"
+
+// Driver returns the driver serving dataSourceName: SQLite for sqlite: URLs
+// such as sqlite:///var/lib/blog.db or sqlite::memory:, Postgres otherwise.
+func Driver(dataSourceName string) string {
+	if strings.HasPrefix(dataSourceName, "sqlite:") {
+		return SQLite
+	}
+	return Postgres
+}
+
+// sqliteSource turns a sqlite: URL into the file name and options expected
+// by the driver.
+func sqliteSource(url string) string {
+	name, ok := strings.CutPrefix(url, "sqlite://")
+	if !ok {
+		name = strings.TrimPrefix(url, "sqlite:")
+	}
+	if strings.Contains(name, "?") {
+		return name + "&" + sqlitePragmas
+	}
+	return name + "?" + sqlitePragmas
+}
@@ -0,0 +1,212 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// testSchema exposes items(first) { id, children(first) { ... } } and batches
+// the label lookups of every item through a Loader.
+func testSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	var itemType *graphql.Object
+	itemType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": {Type: graphql.Int},
+				"label": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					loader := p.Context.Value(loaderKey{}).(*Loader[int, string])
+					return loader.Load(p.Context, p.Source.(map[string]interface{})["id"].(int)), nil
+				}},
+				"children": {
+					Type: graphql.NewList(itemType),
+					Args: graphql.FieldConfigArgument{PageSizeArg: {Type: graphql.Int, DefaultValue: 2}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return items(p.Args[PageSizeArg].(int)), nil
+					},
+				},
+			}
+		}),
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"items": {
+				Type: graphql.NewList(itemType),
+				Args: graphql.FieldConfigArgument{PageSizeArg: {Type: graphql.Int, DefaultValue: 10}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return items(p.Args[PageSizeArg].(int)), nil
+				},
+			},
+		},
+	})})
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	return &schema
+}
+
+type loaderKey struct{}
+
+func items(n int) []map[string]interface{} {
+	list := make([]map[string]interface{}, n)
+	for i := range list {
+		list[i] = map[string]interface{}{"id": i}
+	}
+	return list
+}
+
+func TestLimits_Check(t *testing.T) {
+	schema := testSchema(t)
+	tests := []struct {
+		name           string
+		query          string
+		variables      map[string]interface{}
+		limits         Limits
+		wantDepth      int
+		wantComplexity int
+		wantErr        bool
+	}{
+		{
+			name:           "Default page size",
+			query:          `{ items { id } }`,
+			wantDepth:      2,
+			wantComplexity: 1 + 10*1,
+		},
+		{
+			name:           "Literal page size",
+			query:          `{ items(first: 3) { id children(first: 4) { id } } }`,
+			wantDepth:      3,
+			wantComplexity: 1 + 3*(1+1+4*1),
+		},
+		{
+			name:           "Variable page size",
+			query:          `query($n: Int) { items(first: $n) { id } }`,
+			variables:      map[string]interface{}{"n": 5.0},
+			wantDepth:      2,
+			wantComplexity: 1 + 5*1,
+		},
+		{
+			name:           "Fragments are expanded",
+			query:          `{ items(first: 2) { ...fields } } fragment fields on Item { id children { id } }`,
+			wantDepth:      3,
+			wantComplexity: 1 + 2*(1+1+2*1),
+		},
+		{
+			name:           "Introspection is free",
+			query:          `{ __typename items(first: 1) { id } }`,
+			wantDepth:      2,
+			wantComplexity: 2,
+		},
+		{
+			name:      "Too deep",
+			query:     `{ items { children { children { id } } } }`,
+			limits:    Limits{MaxDepth: 3},
+			wantDepth: 4,
+			wantErr:   true,
+		},
+		{
+			name:    "Too complex",
+			query:   `{ items(first: 100) { children(first: 100) { id } } }`,
+			limits:  Limits{MaxComplexity: 1000},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(tt.query)})})
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			cost, err := tt.limits.Check(schema, doc, "", tt.variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := err.(*LimitError); !ok {
+					t.Errorf("Expected a *LimitError, got %T", err)
+				}
+				return
+			}
+			if cost.Depth != tt.wantDepth || cost.Complexity != tt.wantComplexity {
+				t.Errorf("Expected depth %d and complexity %d, got %d and %d", tt.wantDepth, tt.wantComplexity, cost.Depth, cost.Complexity)
+			}
+		})
+	}
+}
+
+func TestLoader_Batches(t *testing.T) {
+	var batches [][]int
+	schema := testSchema(t)
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		batches = append(batches, keys)
+		labels := make(map[int]string, len(keys))
+		for _, key := range keys {
+			labels[key] = "item"
+		}
+		return labels, nil
+	})
+
+	ctx := context.WithValue(context.Background(), loaderKey{}, loader)
+	result := graphql.Do(graphql.Params{
+		Schema:        *schema,
+		RequestString: `{ items(first: 3) { label children(first: 3) { label } } }`,
+		Context:       ctx,
+	})
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("Expected 1 batch, got %d: %v", len(batches), batches)
+	}
+	if len(batches[0]) != 3 {
+		t.Errorf("Expected the batch to hold 3 distinct keys, got %v", batches[0])
+	}
+}
+
+func TestHandler(t *testing.T) {
+	schema := testSchema(t)
+	handler := Handler(schema, Limits{MaxDepth: 3, MaxComplexity: 100})
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		want   int
+	}{
+		{name: "POST query", method: "POST", query: `{ items(first: 2) { id } }`, want: http.StatusOK},
+		{name: "GET query", method: "GET", query: `{ items(first: 2) { id } }`, want: http.StatusOK},
+		{name: "Syntax error", method: "POST", query: `{ items(`, want: http.StatusBadRequest},
+		{name: "Unknown field", method: "POST", query: `{ missing }`, want: http.StatusBadRequest},
+		{name: "Too deep", method: "POST", query: `{ items { children { children { id } } } }`, want: http.StatusBadRequest},
+		{name: "Too complex", method: "GET", query: `{ items(first: 50) { children(first: 50) { id } } }`, want: http.StatusBadRequest},
+		{name: "Missing query", method: "POST", query: ``, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.method == "GET" {
+				req = httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(tt.query), nil)
+			} else {
+				body, _ := json.Marshal(Request{Query: tt.query})
+				req = httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %v, got %v (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// maxRequestBody limits the size of a GraphQL request.
+const maxRequestBody = 1 << 20
+
+// Request is a GraphQL-over-HTTP request.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves schema over HTTP. GET requests read the query from the URL and
+// may only run queries; POST requests carry a JSON body. Operations are
+// validated and checked against limits before any resolver runs.
+func Handler(schema *graphql.Schema, limits Limits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeRequest(r)
+		if err != nil {
+			respond(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+			Body: []byte(req.Query),
+			Name: "GraphQL request",
+		})})
+		if err != nil {
+			respond(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		if validation := graphql.ValidateDocument(schema, doc, nil); !validation.IsValid {
+			respond(w, http.StatusBadRequest, &graphql.Result{Errors: validation.Errors})
+			return
+		}
+
+		if _, err := limits.Check(schema, doc, req.OperationName, req.Variables); err != nil {
+			respond(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		if r.Method == http.MethodGet && !onlyQueries(doc, req.OperationName) {
+			w.Header().Set("Allow", "POST")
+			respond(w, http.StatusMethodNotAllowed, &graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("only queries may be sent with GET"))})
+			return
+		}
+
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        *schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       r.Context(),
+		})
+		respond(w, http.StatusOK, result)
+	})
+}
+
+func decodeRequest(r *http.Request) (Request, error) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if raw := query.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				return req, errors.New("variables must be a JSON object")
+			}
+		}
+	case http.MethodPost:
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+				return req, errors.New("request body must be application/json")
+			}
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+		if err != nil {
+			return req, errors.New("failed to read request body")
+		}
+		if len(body) > maxRequestBody {
+			return req, errors.New("request body is too large")
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return req, errors.New("request body must be a JSON object")
+		}
+	}
+	if req.Query == "" {
+		return req, errors.New("query is required")
+	}
+	return req, nil
+}
+
+// onlyQueries reports whether the selected operation is a query.
+func onlyQueries(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (op.Name == nil || op.Name.Value != operationName)) {
+			continue
+		}
+		if op.Operation != ast.OperationTypeQuery {
+			return false
+		}
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding GraphQL response: %v", err)
+	}
+}
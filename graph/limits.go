@@ -0,0 +1,229 @@
+// Package graph serves GraphQL schemas over HTTP with query cost limits and
+// per-request batching of data loads.
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bounds the cost of a single GraphQL operation.
+type Limits struct {
+	// MaxDepth is the deepest allowed field nesting; 0 disables the check.
+	MaxDepth int
+	// MaxComplexity is the highest allowed query cost; 0 disables the check.
+	MaxComplexity int
+}
+
+// PageSizeArg names the argument that multiplies the cost of a field's
+// selections. A list field fetching first: 50 items costs 50 times its
+// selection.
+const PageSizeArg = "first"
+
+// Cost is the measured cost of an operation.
+type Cost struct {
+	Depth      int
+	Complexity int
+}
+
+// LimitError reports an operation that exceeds its limits.
+type LimitError struct {
+	Limit string
+	Value int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("query %s %d exceeds the maximum of %d", e.Limit, e.Value, e.Max)
+}
+
+// Check measures the operation and returns a *LimitError if it exceeds l.
+func (l Limits) Check(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}) (Cost, error) {
+	cost, err := Measure(schema, doc, operationName, variables)
+	if err != nil {
+		return cost, err
+	}
+	if l.MaxDepth > 0 && cost.Depth > l.MaxDepth {
+		return cost, &LimitError{Limit: "depth", Value: cost.Depth, Max: l.MaxDepth}
+	}
+	if l.MaxComplexity > 0 && cost.Complexity > l.MaxComplexity {
+		return cost, &LimitError{Limit: "complexity", Value: cost.Complexity, Max: l.MaxComplexity}
+	}
+	return cost, nil
+}
+
+// Measure computes the depth and complexity of the selected operation of a
+// validated document. Every field costs 1 plus its selections, multiplied by
+// its PageSizeArg when it has one. Introspection fields are free.
+func Measure(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}) (Cost, error) {
+	m := &measurer{
+		schema:    schema,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				if op != nil && operationName == "" {
+					return Cost{}, fmt.Errorf("an operation name is required when the document has several operations")
+				}
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		return Cost{}, fmt.Errorf("unknown operation %q", operationName)
+	}
+
+	var root *graphql.Object
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	default:
+		root = schema.QueryType()
+	}
+	if root == nil {
+		return Cost{}, fmt.Errorf("the schema has no %s type", op.Operation)
+	}
+
+	complexity, depth := m.selectionSet(root, op.SelectionSet, map[string]bool{})
+	return Cost{Depth: depth, Complexity: complexity}, nil
+}
+
+type measurer struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// selectionSet returns the complexity and depth of set resolved on parent.
+// visiting guards against fragment cycles in documents that skipped validation.
+func (m *measurer) selectionSet(parent graphql.Type, set *ast.SelectionSet, visiting map[string]bool) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	var complexity, depth int
+	add := func(c, d int) {
+		complexity += c
+		if d > depth {
+			depth = d
+		}
+	}
+
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			add(m.field(parent, selection, visiting))
+		case *ast.InlineFragment:
+			on := parent
+			if selection.TypeCondition != nil {
+				if t := m.schema.Type(selection.TypeCondition.Name.Value); t != nil {
+					on = t
+				}
+			}
+			add(m.selectionSet(on, selection.SelectionSet, visiting))
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := m.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			on := parent
+			if t := m.schema.Type(fragment.TypeCondition.Name.Value); t != nil {
+				on = t
+			}
+			visiting[name] = true
+			add(m.selectionSet(on, fragment.SelectionSet, visiting))
+			delete(visiting, name)
+		}
+	}
+	return complexity, depth
+}
+
+func (m *measurer) field(parent graphql.Type, field *ast.Field, visiting map[string]bool) (int, int) {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") {
+		return 0, 0
+	}
+
+	var def *graphql.FieldDefinition
+	switch parent := parent.(type) {
+	case *graphql.Object:
+		def = parent.Fields()[name]
+	case *graphql.Interface:
+		def = parent.Fields()[name]
+	}
+	if def == nil {
+		return 1, 1
+	}
+
+	complexity, depth := m.selectionSet(namedType(def.Type), field.SelectionSet, visiting)
+	return 1 + m.multiplier(def, field)*complexity, 1 + depth
+}
+
+// multiplier returns the page size requested from a field, falling back to the
+// argument's default.
+func (m *measurer) multiplier(def *graphql.FieldDefinition, field *ast.Field) int {
+	for _, arg := range def.Args {
+		if arg.Name() != PageSizeArg {
+			continue
+		}
+		n := toInt(arg.DefaultValue)
+		for _, given := range field.Arguments {
+			if given.Name.Value != PageSizeArg {
+				continue
+			}
+			switch value := given.Value.(type) {
+			case *ast.IntValue:
+				n, _ = strconv.Atoi(value.Value)
+			case *ast.Variable:
+				if v, ok := m.variables[value.Name.Value]; ok {
+					n = toInt(v)
+				}
+			}
+		}
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+	return 1
+}
+
+// namedType unwraps list and non-null modifiers.
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.List:
+			t = wrapped.OfType
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
+
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
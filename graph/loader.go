@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchFunc loads the values for keys in one round trip. Keys missing from the
+// returned map resolve to the zero value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader collects the keys requested while one level of a query resolves and
+// fetches them with a single BatchFunc call, avoiding N+1 queries. Results are
+// memoized, so a Loader must not outlive its request.
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*loadResult[V]
+}
+
+type loadResult[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// NewLoader returns a Loader that fetches keys with batch.
+func NewLoader[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{
+		batch:   batch,
+		results: make(map[K]*loadResult[V]),
+	}
+}
+
+// Load queues key and returns a thunk that resolves it. Resolvers return the
+// thunk so the executor can queue every sibling key before the first thunk
+// runs and dispatches the batch.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (interface{}, error) {
+	l.mu.Lock()
+	result, ok := l.results[key]
+	if !ok {
+		result = &loadResult[V]{done: make(chan struct{})}
+		l.results[key] = result
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.dispatch(ctx)
+		<-result.done
+		return result.value, result.err
+	}
+}
+
+// dispatch fetches every pending key.
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	values, err := l.batch(ctx, keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		result := l.results[key]
+		if err != nil {
+			result.err = err
+			// Drop failures so a later load can retry.
+			delete(l.results, key)
+		} else {
+			result.value = values[key]
+		}
+		close(result.done)
+	}
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ConnLimiter caps the number of concurrent long-lived requests, such as event
+// streams, overall and per client IP.
+type ConnLimiter struct {
+	maxTotal     int
+	maxPerClient int
+
+	mu        sync.Mutex
+	total     int
+	perClient map[string]int
+}
+
+// NewConnLimiter returns a ConnLimiter allowing maxTotal concurrent requests,
+// at most maxPerClient of them from the same client. A zero limit disables it.
+func NewConnLimiter(maxTotal, maxPerClient int) *ConnLimiter {
+	return &ConnLimiter{
+		maxTotal:     maxTotal,
+		maxPerClient: maxPerClient,
+		perClient:    make(map[string]int),
+	}
+}
+
+// acquire reserves a connection for client, returning the status to reject
+// the request with when a limit is reached.
+func (l *ConnLimiter) acquire(client string) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return http.StatusServiceUnavailable, false
+	}
+	if l.maxPerClient > 0 && l.perClient[client] >= l.maxPerClient {
+		return http.StatusTooManyRequests, false
+	}
+	l.total++
+	l.perClient[client]++
+	return 0, true
+}
+
+func (l *ConnLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perClient[client]--; l.perClient[client] <= 0 {
+		delete(l.perClient, client)
+	}
+}
+
+// Limit rejects requests beyond the configured limits until earlier ones finish.
+func (l *ConnLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := hashIP(getClientIP(r))
+		status, ok := l.acquire(client)
+		if !ok {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Too many open connections. Please try again later.", status)
+			return
+		}
+		defer l.release(client)
+
+		next.ServeHTTP(w, r)
+	})
+}
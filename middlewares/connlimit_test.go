@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnLimiter_Limit(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxTotal     int
+		maxPerClient int
+		clients      []string
+		want         []int
+	}{
+		{
+			name:         "Per-client limit",
+			maxTotal:     10,
+			maxPerClient: 2,
+			clients:      []string{"10.0.0.1", "10.0.0.1", "10.0.0.1", "10.0.0.2"},
+			want:         []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:         "Total limit",
+			maxTotal:     2,
+			maxPerClient: 2,
+			clients:      []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want:         []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable},
+		},
+		{
+			name:    "No limits",
+			clients: []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"},
+			want:    []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewConnLimiter(tt.maxTotal, tt.maxPerClient)
+			handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, client := range tt.clients {
+				req := httptest.NewRequest("GET", "/events", nil)
+				req.RemoteAddr = client + ":1234"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != tt.want[i] {
+					t.Errorf("Request %d: expected status %v, got %v", i, tt.want[i], rec.Code)
+				}
+
+				// Keep accepted connections open for the following requests.
+				if rec.Code == http.StatusOK {
+					limiter.acquire(hashIP(client))
+				}
+			}
+		})
+	}
+}
+
+func TestConnLimiter_Release(t *testing.T) {
+	limiter := NewConnLimiter(1, 1)
+	handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/events", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200 after earlier connections closed, got %v", i, rec.Code)
+		}
+	}
+	if limiter.total != 0 || len(limiter.perClient) != 0 {
+		t.Errorf("Expected every connection to be released, got total %d and %v", limiter.total, limiter.perClient)
+	}
+}
@@ -10,6 +10,7 @@ type CorsConfig struct {
 	AllowedOrigins   []string
 	AllowedMethods   []string
 	AllowedHeaders   []string
+	ExposedHeaders   []string
 	AllowCredentials bool
 }
 
@@ -24,6 +25,9 @@ func CorsMiddleware(config *CorsConfig) func(http.Handler) http.Handler {
 
 			w.Header().Set("Access-Control-Allow-Methods", commaSeparated(config.AllowedMethods))
 			w.Header().Set("Access-Control-Allow-Headers", commaSeparated(config.AllowedHeaders))
+			if len(config.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", commaSeparated(config.ExposedHeaders))
+			}
 			if config.AllowCredentials {
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
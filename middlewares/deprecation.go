@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DeprecationConfig describes a deprecated set of routes and their replacement.
+type DeprecationConfig struct {
+	// DeprecatedAt is when the routes were deprecated.
+	DeprecatedAt time.Time
+	// Sunset is when the routes will stop responding.
+	Sunset time.Time
+	// SuccessorPrefix is prepended to the request URI to link to the replacement route.
+	SuccessorPrefix string
+}
+
+// Deprecation marks responses with the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers and links to the successor version of the route.
+func Deprecation(config DeprecationConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.DeprecatedAt.IsZero() {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%d", config.DeprecatedAt.Unix()))
+			} else {
+				w.Header().Set("Deprecation", "true")
+			}
+			if !config.Sunset.IsZero() {
+				w.Header().Set("Sunset", config.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if config.SuccessorPrefix != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, config.SuccessorPrefix, r.URL.RequestURI()))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecation(t *testing.T) {
+	config := DeprecationConfig{
+		DeprecatedAt:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:          time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+		SuccessorPrefix: "/v1",
+	}
+	handler := Deprecation(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/posts?id=42", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Deprecation"), "@1790812800"; got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Sunset"), "Thu, 01 Apr 2027 00:00:00 GMT"; got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Link"), `</v1/posts?id=42>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
+
+func TestDeprecation_NoDates(t *testing.T) {
+	handler := Deprecation(DeprecationConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/posts", nil))
+
+	if got := rec.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, want %q", got, "true")
+	}
+	if got := rec.Header().Get("Sunset"); got != "" {
+		t.Errorf("Expected no Sunset header, got %q", got)
+	}
+}
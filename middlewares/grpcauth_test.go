@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCAuth_UnaryInterceptor(t *testing.T) {
+	auth := GRPCAuth{BearerToken: "secret", APIKeys: []string{"key-1", "key-2"}}
+	interceptor := auth.UnaryInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{name: "Valid bearer token", md: metadata.Pairs("authorization", "Bearer secret"), want: codes.OK},
+		{name: "Valid API key", md: metadata.Pairs(APIKeyMetadata, "key-2"), want: codes.OK},
+		{name: "Invalid bearer token", md: metadata.Pairs("authorization", "Bearer wrong"), want: codes.Unauthenticated},
+		{name: "Wrong authorization scheme", md: metadata.Pairs("authorization", "Basic secret"), want: codes.Unauthenticated},
+		{name: "Invalid API key", md: metadata.Pairs(APIKeyMetadata, "key-3"), want: codes.Unauthenticated},
+		{name: "Missing credentials", md: metadata.MD{}, want: codes.Unauthenticated},
+		{name: "Missing metadata", want: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Expected code %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGRPCAuth_NoAPIKeys(t *testing.T) {
+	auth := GRPCAuth{BearerToken: "secret"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyMetadata, ""))
+	if err := auth.authenticate(ctx); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected an empty API key to be rejected, got %v", err)
+	}
+}
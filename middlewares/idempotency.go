@@ -0,0 +1,271 @@
+package middlewares
+
+import (
+	"blogklert/breaker"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// IdempotencyHeader is the request header carrying the client-chosen idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyReservationTTL bounds how long a key stays in progress when the
+// request holding it never completes, e.g. because the server crashed. It
+// outlasts the server's 30s write timeout, so a retry cannot overlap a
+// request still running.
+const idempotencyReservationTTL = time.Minute
+
+// idempotencyStoreTimeout bounds saving or releasing a key once the handler
+// has run, which outlives the request.
+const idempotencyStoreTimeout = 5 * time.Second
+
+// IdempotencyRecord is the stored outcome of a request made with an idempotency key.
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyStore persists idempotency records.
+type IdempotencyStore interface {
+	// Reserve claims key for an in-flight request. When the key is already in
+	// use it returns the existing record and false.
+	Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error)
+	// Save stores the completed record for key.
+	Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release removes key so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// RedisIdempotencyStore stores idempotency records in Redis.
+type RedisIdempotencyStore struct {
+	client *redis.Client
+}
+
+// NewRedisIdempotencyStore creates an IdempotencyStore backed by client.
+func NewRedisIdempotencyStore(client *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client}
+}
+
+func (s *RedisIdempotencyStore) redisKey(key string) string {
+	return "idempotency:" + key
+}
+
+// Reserve claims key with SETNX so concurrent retries cannot both run.
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	// The key may expire between SETNX and GET, so it is claimed twice at most.
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := s.client.SetNX(ctx, s.redisKey(key), data, ttl).Result()
+		if err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("error reserving idempotency key: %w", err)
+		}
+		if ok {
+			return record, true, nil
+		}
+
+		stored, err := s.client.Get(ctx, s.redisKey(key)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("error fetching idempotency key: %w", err)
+		}
+		var existing IdempotencyRecord
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("error unmarshalling idempotency record: %w", err)
+		}
+		return existing, false, nil
+	}
+	return IdempotencyRecord{}, false, errors.New("error reserving idempotency key: it keeps expiring")
+}
+
+// Save overwrites the reservation with the completed record.
+func (s *RedisIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.redisKey(key), data, ttl).Err()
+}
+
+// Release deletes the reservation for key.
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.redisKey(key)).Err()
+}
+
+// Idempotency replays the stored response for requests repeated with the same
+// Idempotency-Key header for ttl. Keys are scoped to the client's credentials,
+// or its address when it sends none. Reusing a key with a different request is
+// rejected with 422, and a retry that arrives while the first request is still
+// running is rejected with 409. The outcome is stored even when the client
+// disconnects, so its retry is answered rather than rejected.
+//
+// route names the operation: requests are compared by route, query and body,
+// so a retry through another mount of the same route, such as a versioned
+// prefix, is still recognised. Only the headers set by the handler are
+// stored; those of the middlewares around it are set again on the replay.
+//
+// While the circuit of the store is open the key is ignored and the request
+// runs as if it had none, the same as when no store is configured: writes
+// keep working through a Redis outage at the cost of retries possibly
+// repeating. Any other store error is answered with 503 so the client retries.
+func Idempotency(store IdempotencyStore, ttl time.Duration, route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "Idempotency-Key header is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			key = idempotencyScope(r) + ":" + key
+			fingerprint := requestFingerprint(route, r, body)
+			record, reserved, err := store.Reserve(ctx, key, IdempotencyRecord{Fingerprint: fingerprint}, idempotencyReservationTTL)
+			if errors.Is(err, breaker.ErrOpen) {
+				log.Printf("idempotency store unavailable, ignoring Idempotency-Key: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				log.Printf("idempotency store unavailable: %v", err)
+				http.Error(w, "Failed to process Idempotency-Key", http.StatusServiceUnavailable)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case record.Fingerprint != fingerprint:
+					http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+				case !record.Completed:
+					http.Error(w, "A request with this Idempotency-Key is already in progress", http.StatusConflict)
+				default:
+					replayResponse(w, record)
+				}
+				return
+			}
+
+			outer := w.Header().Clone()
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreTimeout)
+			defer cancel()
+
+			// Server errors are not stored so the client can retry them.
+			if rec.status >= http.StatusInternalServerError {
+				if err := store.Release(ctx, key); err != nil {
+					log.Printf("failed to release idempotency key: %v", err)
+				}
+				return
+			}
+
+			record = IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      rec.status,
+				Header:      changedHeaders(outer, rec.Header()),
+				Body:        rec.body.Bytes(),
+			}
+			if err := store.Save(ctx, key, record, ttl); err != nil {
+				log.Printf("failed to save idempotency record: %v", err)
+			}
+		})
+	}
+}
+
+// requestFingerprint hashes the parts of a request to route that must match on retry.
+func requestFingerprint(route string, r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(route + "?" + r.URL.RawQuery + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyScope identifies the client a key belongs to by a hash of its
+// credentials, so clients cannot read or block each other's keys.
+func idempotencyScope(r *http.Request) string {
+	client := r.Header.Get("Authorization")
+	if client == "" {
+		client = "ip " + getClientIP(r)
+	}
+	sum := sha256.Sum256([]byte(client))
+	return hex.EncodeToString(sum[:16])
+}
+
+// changedHeaders returns the headers of after that differ from before.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := make(http.Header)
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			changed[name] = slices.Clone(values)
+		}
+	}
+	return changed
+}
+
+// replayResponse writes a stored response back to the client. Stored headers
+// replace any the middlewares have set.
+func replayResponse(w http.ResponseWriter, record IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	if _, err := w.Write(record.Body); err != nil {
+		log.Printf("Error writing replayed response: %v", err)
+	}
+}
+
+// responseRecorder captures the status and body written by a handler while passing them through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,294 @@
+package middlewares
+
+import (
+	"blogklert/breaker"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryIdempotencyStore keeps records in memory. Like Redis, it fails calls
+// made with a cancelled context.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+	// ttls holds the TTL each key was last written with.
+	ttls map[string]time.Duration
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]IdempotencyRecord), ttls: make(map[string]time.Duration)}
+}
+
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[key]; ok {
+		return existing, false, nil
+	}
+	s.records[key] = record
+	s.ttls[key] = ttl
+	return record, true, nil
+}
+
+func (s *memoryIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = record
+	s.ttls[key] = ttl
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	handler := Idempotency(newMemoryIdempotencyStore(), time.Hour, "POST /posts")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/posts?id=1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/posts", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("abc", `{"title":"a"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", first.Code)
+	}
+
+	replay := send("abc", `{"title":"a"}`)
+	if replay.Code != http.StatusCreated || replay.Body.String() != `{"id":"1"}` {
+		t.Errorf("Expected replayed response, got %v %q", replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get("Location") != "/posts?id=1" || replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected replayed headers, got %v", replay.Header())
+	}
+	if calls != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", calls)
+	}
+
+	if mismatch := send("abc", `{"title":"b"}`); mismatch.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status UnprocessableEntity for reused key, got %v", mismatch.Code)
+	}
+
+	send("", `{"title":"a"}`)
+	send("", `{"title":"a"}`)
+	if calls != 3 {
+		t.Errorf("Expected requests without a key to always run, ran %d times", calls)
+	}
+}
+
+func TestIdempotency_InProgressAndServerErrors(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	status := http.StatusInternalServerError
+	handler := Idempotency(store, time.Hour, "POST /posts")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	req := httptest.NewRequest("POST", "/posts", strings.NewReader("{}"))
+	req.Header.Set(IdempotencyHeader, "retry")
+	fingerprint := requestFingerprint("POST /posts", req, []byte("{}"))
+
+	// Another request holds the key.
+	key := idempotencyScope(req) + ":retry"
+	store.records[key] = IdempotencyRecord{Fingerprint: fingerprint}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict, got %v", rec.Code)
+	}
+
+	// Server errors release the key for a later retry.
+	delete(store.records, key)
+	req = httptest.NewRequest("POST", "/posts", strings.NewReader("{}"))
+	req.Header.Set(IdempotencyHeader, "retry")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if _, ok := store.records[key]; ok {
+		t.Error("Expected the key to be released after a server error")
+	}
+}
+
+func TestIdempotency_ClientDisconnects(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		// wantStored is whether the key keeps a completed record.
+		wantStored bool
+	}{
+		{name: "Success is saved", status: http.StatusCreated, wantStored: true},
+		{name: "Server error is released", status: http.StatusInternalServerError, wantStored: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryIdempotencyStore()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var reservationTTL time.Duration
+			req := httptest.NewRequest("POST", "/posts", strings.NewReader("{}")).WithContext(ctx)
+			req.Header.Set(IdempotencyHeader, "mobile")
+			key := idempotencyScope(req) + ":mobile"
+			handler := Idempotency(store, 24*time.Hour, "POST /posts")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reservationTTL = store.ttls[key]
+				// The client goes away once the post is committed.
+				cancel()
+				w.WriteHeader(tt.status)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if reservationTTL != idempotencyReservationTTL {
+				t.Errorf("reservation TTL = %v, want %v", reservationTTL, idempotencyReservationTTL)
+			}
+			record, ok := store.records[key]
+			if ok != tt.wantStored {
+				t.Fatalf("key stored = %v, want %v (record %+v)", ok, tt.wantStored, record)
+			}
+			if !tt.wantStored {
+				return
+			}
+			if !record.Completed || record.Status != tt.status {
+				t.Errorf("record = %+v, want the completed response", record)
+			}
+			if store.ttls[key] != 24*time.Hour {
+				t.Errorf("record TTL = %v, want 24h", store.ttls[key])
+			}
+
+			// The retry is answered with the saved response.
+			retry := httptest.NewRequest("POST", "/posts", strings.NewReader("{}"))
+			retry.Header.Set(IdempotencyHeader, "mobile")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, retry)
+			if rec.Code != tt.status || rec.Header().Get("Idempotent-Replayed") != "true" {
+				t.Errorf("retry = %d with headers %v, want the replayed response", rec.Code, rec.Header())
+			}
+		})
+	}
+}
+
+// failingIdempotencyStore fails every call with err.
+type failingIdempotencyStore struct {
+	err error
+}
+
+func (s failingIdempotencyStore) Reserve(context.Context, string, IdempotencyRecord, time.Duration) (IdempotencyRecord, bool, error) {
+	return IdempotencyRecord{}, false, s.err
+}
+
+func (s failingIdempotencyStore) Save(context.Context, string, IdempotencyRecord, time.Duration) error {
+	return s.err
+}
+
+func (s failingIdempotencyStore) Release(context.Context, string) error {
+	return s.err
+}
+
+func TestIdempotency_StoreUnavailable(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "Circuit open", err: fmt.Errorf("redis: %w", breaker.ErrOpen), wantStatus: http.StatusCreated, wantCalls: 1},
+		{name: "Store error", err: errors.New("i/o timeout"), wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := Idempotency(failingIdempotencyStore{err: tt.err}, time.Hour, "POST /posts")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			req := httptest.NewRequest("POST", "/posts", strings.NewReader("{}"))
+			req.Header.Set(IdempotencyHeader, "outage")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus || calls != tt.wantCalls {
+				t.Errorf("status = %d after %d calls, want %d after %d", rec.Code, calls, tt.wantStatus, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	cors := CorsMiddleware(&CorsConfig{AllowedOrigins: []string{"http://a"}, AllowedMethods: []string{"POST"}})
+	tests := []struct {
+		name            string
+		retryTarget     string
+		retryAuth       string
+		wantReplayed    bool
+		wantHandlerRuns int
+	}{
+		{name: "Same mount", retryTarget: "/v1/posts", retryAuth: "Bearer one", wantReplayed: true, wantHandlerRuns: 1},
+		{name: "Another mount of the route", retryTarget: "/posts", retryAuth: "Bearer one", wantReplayed: true, wantHandlerRuns: 1},
+		{name: "Another client", retryTarget: "/v1/posts", retryAuth: "Bearer two", wantHandlerRuns: 2},
+		{name: "Other query", retryTarget: "/v1/posts?draft=true", retryAuth: "Bearer one", wantHandlerRuns: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			handler := cors(Idempotency(newMemoryIdempotencyStore(), time.Hour, "POST /posts")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				runs++
+				w.Header().Set("Location", "/v1/posts?id=1")
+				w.WriteHeader(http.StatusCreated)
+			})))
+			send := func(target, auth string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("POST", target, strings.NewReader(`{"title":"a"}`))
+				req.Header.Set(IdempotencyHeader, "abc")
+				req.Header.Set("Authorization", auth)
+				req.Header.Set("Origin", "http://a")
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec
+			}
+
+			send("/v1/posts", "Bearer one")
+			rec := send(tt.retryTarget, tt.retryAuth)
+			if runs != tt.wantHandlerRuns {
+				t.Errorf("handler ran %d times, want %d", runs, tt.wantHandlerRuns)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v (status %d)", replayed, tt.wantReplayed, rec.Code)
+			}
+			if tt.wantHandlerRuns == 1 && !tt.wantReplayed && rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d, want 422 for a different request", rec.Code)
+			}
+			if got := rec.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "http://a" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want one value", got)
+			}
+			if tt.wantReplayed && len(rec.Header().Values("Location")) != 1 {
+				t.Errorf("Location = %q, want the handler's one value", rec.Header().Values("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import "testing"
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "text/html", "text/markdown", "text/plain"}
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "Empty header", accept: "", want: "application/json"},
+		{name: "Exact match", accept: "text/markdown", want: "text/markdown"},
+		{name: "Wildcard", accept: "*/*", want: "application/json"},
+		{name: "Type wildcard", accept: "text/*", want: "text/html"},
+		{name: "Quality values", accept: "text/html;q=0.5, text/plain", want: "text/plain"},
+		{name: "Browser header", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: "text/html"},
+		{name: "Specific range overrides wildcard", accept: "*/*;q=0.9, application/json;q=0", want: "text/html"},
+		{name: "Unsupported type", accept: "application/xml", want: ""},
+		{name: "Malformed entries are skipped", accept: "garbage, text/plain", want: "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateContentType(tt.accept, offers); got != tt.want {
+				t.Errorf("NegotiateContentType(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,71 @@
 package middlewares
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-// SanitizeInput sanitizes user input by removing potentially harmful characters and limiting word count.
-func SanitizeInput(input string, maxWordCount int) string {
+// SanitizePolicy describes how user input is cleaned before it is stored.
+// Policies are built on Unicode categories rather than a symbol allowlist, so
+// punctuation, symbols and emoji from any script survive while control and
+// bidi-override characters are removed.
+type SanitizePolicy struct {
+	// Name identifies the policy in configuration.
+	Name string
+	// LineBreaks keeps newlines; when false every line break folds into a space.
+	LineBreaks bool
+	// MaxBlankLines caps the number of consecutive empty lines kept between paragraphs.
+	MaxBlankLines int
+	// PreserveIndent keeps leading whitespace on each line (e.g. Markdown code and lists).
+	PreserveIndent bool
+}
+
+// Built-in sanitization policies.
+var (
+	// PlainTextPolicy is used for single-line fields such as titles and excerpts.
+	PlainTextPolicy = SanitizePolicy{Name: "plain_text"}
+	// RichBodyPolicy is used for long-form content that keeps its paragraph structure.
+	RichBodyPolicy = SanitizePolicy{Name: "rich_body", LineBreaks: true, MaxBlankLines: 2, PreserveIndent: true}
+	// CommentPolicy is used for short multi-line reader input.
+	CommentPolicy = SanitizePolicy{Name: "comment", LineBreaks: true, MaxBlankLines: 1}
+)
+
+var sanitizePolicies = map[string]SanitizePolicy{
+	PlainTextPolicy.Name: PlainTextPolicy,
+	RichBodyPolicy.Name:  RichBodyPolicy,
+	CommentPolicy.Name:   CommentPolicy,
+}
+
+// LookupSanitizePolicy returns the built-in policy registered under name.
+func LookupSanitizePolicy(name string) (SanitizePolicy, error) {
+	policy, ok := sanitizePolicies[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return SanitizePolicy{}, fmt.Errorf("unknown sanitize policy %q", name)
+	}
+	return policy, nil
+}
+
+// Sanitize normalizes the input to NFC, removes potentially harmful characters and limits word count.
+func (p SanitizePolicy) Sanitize(input string, maxWordCount int) string {
 	if maxWordCount <= 0 {
 		return "" // Return empty for invalid word limit
 	}
 
-	// Remove potentially harmful characters.
-	sanitizedInput := removeUnsafeCharacters(input)
+	// Compose characters so equivalent strings compare and count the same.
+	sanitizedInput := norm.NFC.String(input)
 
-	// Normalize spaces (trim and reduce multiple spaces)
-	sanitizedInput = normalizeSpaces(sanitizedInput)
+	// Remove control, format and bidi-override characters.
+	sanitizedInput = p.removeUnsafeCharacters(sanitizedInput)
+
+	// Normalize whitespace according to the policy's line handling.
+	if p.LineBreaks {
+		sanitizedInput = p.normalizeLines(sanitizedInput)
+	} else {
+		sanitizedInput = normalizeSpaces(sanitizedInput)
+	}
 
 	// Limit input length based on word count to prevent buffer overflows and DoS attacks.
 	return truncateByWordCount(sanitizedInput, maxWordCount)
@@ -29,33 +79,98 @@ func normalizeSpaces(input string) string {
 	return strings.Join(strings.Fields(input), " ")
 }
 
+// normalizeLines collapses spaces within each line and limits runs of blank lines.
+func (p SanitizePolicy) normalizeLines(input string) string {
+	lines := strings.Split(input, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, line := range lines {
+		indent := ""
+		if p.PreserveIndent {
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+		line = normalizeSpaces(line)
+		if line == "" {
+			blank++
+			if blank > p.MaxBlankLines {
+				continue
+			}
+			out = append(out, "")
+			continue
+		}
+		blank = 0
+		out = append(out, indent+line)
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
 // removeUnsafeCharacters removes potentially harmful characters from the input.
-func removeUnsafeCharacters(input string) string {
-	var safeRunes []rune
+func (p SanitizePolicy) removeUnsafeCharacters(input string) string {
+	input = strings.ReplaceAll(input, "\r\n", "\n")
+
+	var b strings.Builder
+	b.Grow(len(input))
 	for _, r := range input {
-		if isSafeCharacter(r) {
-			safeRunes = append(safeRunes, r)
+		switch {
+		case isLineBreak(r):
+			if p.LineBreaks {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(' ')
+			}
+		case r == '\t':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case isSafeCharacter(r):
+			b.WriteRune(r)
 		}
 	}
-	return string(safeRunes)
+	return b.String()
+}
+
+// isLineBreak reports whether r terminates a line.
+func isLineBreak(r rune) bool {
+	switch r {
+	case '\n', '\r', '\v', '\f', '\u0085', '\u2028', '\u2029':
+		return true
+	}
+	return false
 }
 
-// isSafeCharacter checks if a rune is a safe character (letters, digits, or safe symbols).
+// isSafeCharacter checks if a rune is a safe character (letters, marks, digits, punctuation or symbols).
 func isSafeCharacter(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r) || isSafeSymbol(r)
+	if isBidiControl(r) {
+		return false
+	}
+	if unicode.Is(unicode.Cf, r) {
+		// Joiners are required to render emoji sequences and several scripts correctly.
+		return r == '\u200c' || r == '\u200d'
+	}
+	return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S)
 }
 
-// isSafeSymbol checks if a rune is a safe symbol.
-func isSafeSymbol(r rune) bool {
-	safeSymbols := " .,~-!/@#%*&$+÷€£¥×=;:?<>[]{}|\\\"'()"
-	return strings.ContainsRune(safeSymbols, r)
+// isBidiControl checks if a rune is a bidirectional embedding, override or isolate.
+func isBidiControl(r rune) bool {
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
 }
 
-// truncateByWordCount truncates the input string based on word count.
+// truncateByWordCount truncates the input string based on word count, keeping any line breaks before the cut.
 func truncateByWordCount(input string, maxWordCount int) string {
-	words := strings.Fields(input)
-	if len(words) > maxWordCount {
-		return strings.Join(words[:maxWordCount], " ")
+	words := 0
+	inWord := false
+	for i, r := range input {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		if !inWord {
+			inWord = true
+			words++
+			if words > maxWordCount {
+				return strings.TrimRight(input[:i], " \t\n")
+			}
+		}
 	}
 	return input
 }
@@ -4,7 +4,7 @@ import (
 	"testing"
 )
 
-func TestSanitizeInput(t *testing.T) {
+func TestPlainTextPolicy_Sanitize(t *testing.T) {
 	type args struct {
 		input        string
 		maxWordCount int
@@ -70,12 +70,118 @@ func TestSanitizeInput(t *testing.T) {
 			},
 			want: "",
 		},
+		{
+			name: "Typographic punctuation and emoji",
+			args: args{
+				input:        "Go 1.23 — “what’s new”… 🚀",
+				maxWordCount: 10,
+			},
+			want: "Go 1.23 — “what’s new”… 🚀",
+		},
+		{
+			name: "Control and bidi-override characters",
+			args: args{
+				input:        "safe\u0000 text\u202e\u2066 here\u0007",
+				maxWordCount: 10,
+			},
+			want: "safe text here",
+		},
+		{
+			name: "Line breaks fold into spaces",
+			args: args{
+				input:        "first line\r\nsecond\u2028line",
+				maxWordCount: 10,
+			},
+			want: "first line second line",
+		},
+		{
+			name: "NFC normalization",
+			args: args{
+				input:        "Cafe\u0301",
+				maxWordCount: 10,
+			},
+			want: "Caf\u00e9",
+		},
+		{
+			name: "Non-Latin punctuation",
+			args: args{
+				input:        "你好，世界。「引用」",
+				maxWordCount: 10,
+			},
+			want: "你好，世界。「引用」",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainTextPolicy.Sanitize(tt.args.input, tt.args.maxWordCount); got != tt.want {
+				t.Errorf("PlainTextPolicy.Sanitize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRichBodyPolicy_Sanitize(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		maxWordCount int
+		want         string
+	}{
+		{
+			name:         "Keeps paragraphs",
+			input:        "First paragraph.\r\n\r\nSecond   paragraph.",
+			maxWordCount: 10,
+			want:         "First paragraph.\n\nSecond paragraph.",
+		},
+		{
+			name:         "Limits blank lines",
+			input:        "one\n\n\n\n\ntwo",
+			maxWordCount: 10,
+			want:         "one\n\n\ntwo",
+		},
+		{
+			name:         "Preserves indentation",
+			input:        "list:\n  - item\n\tcode()",
+			maxWordCount: 10,
+			want:         "list:\n  - item\n\tcode()",
+		},
+		{
+			name:         "Truncates across lines",
+			input:        "one two\nthree four\nfive",
+			maxWordCount: 3,
+			want:         "one two\nthree",
+		},
+		{
+			name:         "Keeps emoji joiners",
+			input:        "family: 👩\u200d👩\u200d👧",
+			maxWordCount: 10,
+			want:         "family: 👩\u200d👩\u200d👧",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := SanitizeInput(tt.args.input, tt.args.maxWordCount); got != tt.want {
-				t.Errorf("SanitizeInput() = %v, want %v", got, tt.want)
+			if got := RichBodyPolicy.Sanitize(tt.input, tt.maxWordCount); got != tt.want {
+				t.Errorf("RichBodyPolicy.Sanitize() = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestCommentPolicy_Sanitize(t *testing.T) {
+	got := CommentPolicy.Sanitize("  Nice post!\n\n\n    Thanks  ", 50)
+	want := "Nice post!\n\nThanks"
+	if got != want {
+		t.Errorf("CommentPolicy.Sanitize() = %q, want %q", got, want)
+	}
+}
+
+func TestLookupSanitizePolicy(t *testing.T) {
+	for _, name := range []string{"plain_text", "rich_body", "comment", " Rich_Body "} {
+		if _, err := LookupSanitizePolicy(name); err != nil {
+			t.Errorf("LookupSanitizePolicy(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := LookupSanitizePolicy("html"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -7,8 +7,11 @@ import (
 
 type Post struct {
 	ID        uuid.UUID `json:"id"`
+	Slug      string    `json:"slug"`
 	Title     string    `json:"title"`
 	Excerpt   string    `json:"excerpt"`
 	Body      string    `json:"body"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
 }
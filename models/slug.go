@@ -0,0 +1,41 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// maxSlugLength limits the title-derived part of a slug.
+const maxSlugLength = 60
+
+// PostSlug builds a URL-friendly, unique slug from the post title and ID:
+// the lowercased letters and digits of the title, with every other run of
+// characters replaced by a dash, followed by the start of the ID. The
+// migration adding slugs fills them in with it too.
+func PostSlug(title string, id uuid.UUID) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if b.Len() >= maxSlugLength {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	suffix := id.String()[:8]
+	if slug == "" {
+		return suffix
+	}
+	return slug + "-" + suffix
+}
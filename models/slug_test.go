@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPostSlug(t *testing.T) {
+	id := uuid.MustParse("0f8e2a1c-5b7d-4c3e-9a6f-1d2b3c4d5e6f")
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{name: "Words", title: "Hello, World!", want: "hello-world-0f8e2a1c"},
+		{name: "Digits", title: "Go 1.23 released", want: "go-1-23-released-0f8e2a1c"},
+		{name: "Surrounding symbols", title: "  -- Why? --  ", want: "why-0f8e2a1c"},
+		{name: "Accented letters", title: "Crème Brûlée", want: "crème-brûlée-0f8e2a1c"},
+		{name: "Other scripts", title: "日本語 タイトル", want: "日本語-タイトル-0f8e2a1c"},
+		{name: "Empty title", title: "", want: "0f8e2a1c"},
+		{name: "Only symbols", title: "!!! ???", want: "0f8e2a1c"},
+		{name: "Long title", title: strings.Repeat("a", 100), want: strings.Repeat("a", 60) + "-0f8e2a1c"},
+		{name: "Long multibyte title", title: strings.Repeat("é", 40), want: strings.Repeat("é", 30) + "-0f8e2a1c"},
+		{name: "Cut after a separator", title: strings.Repeat("a", 59) + " b", want: strings.Repeat("a", 59) + "-0f8e2a1c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PostSlug(tt.title, id); got != tt.want {
+				t.Errorf("PostSlug(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
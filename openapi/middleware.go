@@ -0,0 +1,195 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxValidatedBody limits how much of a request body is buffered for validation.
+const maxValidatedBody = 1 << 20
+
+// Validator rejects requests that do not match the operation described in doc.
+// Requests for paths or methods the document does not describe are passed
+// through so the router can answer them. When validateResponses is set,
+// responses are also checked and violations are logged.
+func Validator(doc *Document, validateResponses bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, ok := doc.Operation(r.Method, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := doc.validateRequest(op, r); err != nil {
+				status := http.StatusBadRequest
+				if _, ok := err.(unsupportedMediaTypeError); ok {
+					status = http.StatusUnsupportedMediaType
+				}
+				http.Error(w, "Request validation failed: "+err.Error(), status)
+				return
+			}
+
+			if !validateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			if err := doc.validateResponse(op, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+				log.Printf("OpenAPI response violation for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+type unsupportedMediaTypeError struct {
+	mediaType string
+}
+
+func (e unsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q", e.mediaType)
+}
+
+func (d *Document) validateRequest(op *Operation, r *http.Request) error {
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var (
+			raw     string
+			present bool
+		)
+		switch param.In {
+		case "query":
+			_, present = query[param.Name]
+			raw = query.Get(param.Name)
+		case "header":
+			raw = r.Header.Get(param.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				return &ValidationError{Path: param.Name, Message: "required " + param.In + " parameter is missing"}
+			}
+			continue
+		}
+		if err := d.ValidateParameter(param, raw); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBody+1))
+	if err != nil {
+		return &ValidationError{Message: "failed to read request body"}
+	}
+	if len(body) > maxValidatedBody {
+		return &ValidationError{Message: "request body is too large"}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return &ValidationError{Message: "request body is required"}
+		}
+		return nil
+	}
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return unsupportedMediaTypeError{mediaType: contentType}
+		}
+	}
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		return unsupportedMediaTypeError{mediaType: mediaType}
+	}
+	return d.validateJSON(content.Schema, mediaType, body)
+}
+
+func (d *Document) validateResponse(op *Operation, status int, contentType string, body []byte) error {
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = op.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if !ok {
+		response, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("undocumented status %d", status)
+	}
+	if len(response.Content) == 0 || len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q", contentType)
+	}
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("undocumented content type %q for status %d", mediaType, status)
+	}
+	return d.validateJSON(content.Schema, mediaType, body)
+}
+
+// validateJSON decodes JSON bodies and validates them against schema. Other
+// media types are accepted as-is.
+func (d *Document) validateJSON(schema *Schema, mediaType string, body []byte) error {
+	if schema == nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return &ValidationError{Message: "body is not valid JSON"}
+	}
+	return d.ValidateValue(schema, value)
+}
+
+// responseRecorder captures the status and body written by a handler while passing them through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	truncated   bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write buffers at most maxValidatedBody bytes so streamed responses do not
+// accumulate in memory; oversized bodies are not validated.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	if !r.truncated && r.body.Len()+len(b) <= maxValidatedBody {
+		r.body.Write(b)
+	} else {
+		r.truncated = true
+		r.body.Reset()
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush event streams.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
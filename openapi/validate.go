@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// ValidationError describes where a value violates its schema.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidateValue checks a decoded JSON value against schema.
+func (d *Document) ValidateValue(schema *Schema, value interface{}) error {
+	return d.validate(schema, value, "")
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, path string) error {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if len(schema.OneOf) > 0 {
+		matches := 0
+		for _, option := range schema.OneOf {
+			if d.validate(option, value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fail("must match exactly one schema, matched %d", matches)
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, allowed := range schema.Enum {
+			if reflect.DeepEqual(normalizeNumber(allowed), normalizeNumber(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of %v", schema.Enum)
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "null":
+		if value != nil {
+			return fail("must be null")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fail("must be a %s", schema.Type)
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			return fail("must be an integer")
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return fail("must be at least %v", *schema.Minimum)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			return fail("must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return fail("must be at most %d characters", *schema.MaxLength)
+		}
+		if err := validateFormat(schema.Format, s); err != nil {
+			return fail("%v", err)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return fail("must contain at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			return fail("must contain at most %d items", *schema.MaxItems)
+		}
+		for i, item := range items {
+			if err := d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					return fail("unknown property %q", name)
+				}
+				continue
+			}
+			if err := d.validate(property, object[name], joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fail("unsupported schema type %q", schema.Type)
+	}
+	return nil
+}
+
+// ValidateParameter checks a raw query or header value against the parameter schema.
+func (d *Document) ValidateParameter(param *Parameter, raw string) error {
+	schema := d.resolve(param.Schema)
+	var value interface{} = raw
+	if schema != nil && (schema.Type == "integer" || schema.Type == "number") {
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return &ValidationError{Path: param.Name, Message: "must be a " + schema.Type}
+		}
+		value = n
+	}
+	return d.validate(schema, value, param.Name)
+}
+
+func validateFormat(format, s string) error {
+	switch format {
+	case "uuid":
+		if _, err := uuid.Parse(s); err != nil {
+			return fmt.Errorf("must be a UUID")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Errorf("must be an RFC 3339 date-time")
+		}
+	}
+	return nil
+}
+
+func normalizeNumber(v interface{}) interface{} {
+	if n, ok := v.(int); ok {
+		return float64(n)
+	}
+	return v
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
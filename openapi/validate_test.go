@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testDocument() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: "test", Version: "1"},
+		Components: Components{Schemas: map[string]*Schema{
+			"Item": {
+				Type:                 "object",
+				Required:             []string{"name"},
+				AdditionalProperties: Bool(false),
+				Properties: map[string]*Schema{
+					"name":  {Type: "string", MinLength: Int(1)},
+					"count": {Type: "integer", Minimum: Float(0)},
+					"kind":  {Type: "string", Enum: []interface{}{"a", "b"}},
+				},
+			},
+		}},
+	}
+	doc.AddPaths(map[string]PathItem{
+		"/items": {
+			"post": {
+				OperationID: "createItem",
+				Parameters: []*Parameter{
+					{Name: "id", In: "query", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}},
+				},
+				RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: Ref("Item")}}},
+				Responses: map[string]*Response{
+					"201": {Description: "created", Content: map[string]MediaType{"application/json": {Schema: Ref("Item")}}},
+				},
+			},
+		},
+	})
+	return doc
+}
+
+func TestDocument_ValidateValue(t *testing.T) {
+	doc := testDocument()
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantErr bool
+	}{
+		{name: "Valid object", value: map[string]interface{}{"name": "x", "count": 2.0, "kind": "a"}},
+		{name: "Missing required property", value: map[string]interface{}{"count": 2.0}, wantErr: true},
+		{name: "Unknown property", value: map[string]interface{}{"name": "x", "extra": true}, wantErr: true},
+		{name: "Wrong type", value: map[string]interface{}{"name": 1.0}, wantErr: true},
+		{name: "Too short", value: map[string]interface{}{"name": ""}, wantErr: true},
+		{name: "Not an integer", value: map[string]interface{}{"name": "x", "count": 1.5}, wantErr: true},
+		{name: "Below minimum", value: map[string]interface{}{"name": "x", "count": -1.0}, wantErr: true},
+		{name: "Not in enum", value: map[string]interface{}{"name": "x", "kind": "c"}, wantErr: true},
+		{name: "Not an object", value: []interface{}{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := doc.ValidateValue(Ref("Item"), tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	handler := Validator(testDocument(), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "Valid request", method: "POST", target: "/items?id=6f1c2a54-6c1d-4d8e-9a53-0f7d3a1c2b3e", body: `{"name":"x"}`, want: http.StatusCreated},
+		{name: "Missing query parameter", method: "POST", target: "/items", body: `{"name":"x"}`, want: http.StatusBadRequest},
+		{name: "Invalid query parameter", method: "POST", target: "/items?id=42", body: `{"name":"x"}`, want: http.StatusBadRequest},
+		{name: "Invalid body", method: "POST", target: "/items?id=6f1c2a54-6c1d-4d8e-9a53-0f7d3a1c2b3e", body: `{"name":""}`, want: http.StatusBadRequest},
+		{name: "Missing body", method: "POST", target: "/items?id=6f1c2a54-6c1d-4d8e-9a53-0f7d3a1c2b3e", want: http.StatusBadRequest},
+		{name: "Unsupported media type", method: "POST", target: "/items?id=6f1c2a54-6c1d-4d8e-9a53-0f7d3a1c2b3e", contentType: "text/xml", body: `<x/>`, want: http.StatusUnsupportedMediaType},
+		{name: "Undocumented path passes through", method: "GET", target: "/other", want: http.StatusCreated},
+		{name: "Undocumented method passes through", method: "DELETE", target: "/items", want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %v, got %v (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDocument_ValidateResponse(t *testing.T) {
+	doc := testDocument()
+	op, _ := doc.Operation("POST", "/items")
+
+	if err := doc.validateResponse(op, http.StatusCreated, "application/json", []byte(`{"name":"x"}`)); err != nil {
+		t.Errorf("Expected valid response, got %v", err)
+	}
+	if err := doc.validateResponse(op, http.StatusCreated, "application/json", []byte(`{"count":1}`)); err == nil {
+		t.Error("Expected an error for a response missing a required property")
+	}
+	if err := doc.validateResponse(op, http.StatusTeapot, "text/plain", nil); err == nil {
+		t.Error("Expected an error for an undocumented status")
+	}
+}
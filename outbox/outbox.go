@@ -0,0 +1,41 @@
+// Package outbox implements a transactional outbox. Events are written in the
+// same transaction as the change they describe, so they are recorded if and
+// only if the change commits, and a Relay hands them to registered handlers
+// afterwards with at-least-once delivery.
+package outbox
+
+import (
+	"blogklert/queue"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a recorded domain event.
+type Event struct {
+	ID          int64
+	Type        string
+	AggregateID string
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+}
+
+// Handler processes an event. Handlers may see the same event more than once
+// and must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+// Write records an event with payload encoded as JSON. q should be the
+// transaction that applies the change the event describes.
+func Write(ctx context.Context, q queue.Execer, eventType, aggregateID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO outbox (event_type, aggregate_id, payload) VALUES ($1, $2, $3)",
+		eventType, aggregateID, string(data))
+	if err != nil {
+		return fmt.Errorf("error writing %s event to the outbox: %w", eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package outbox
+
+import (
+	"blogklert/queue"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Relay polls the outbox and runs every registered handler on each event.
+// Progress is recorded per handler, so a retry after a failure only runs the
+// handlers that have not succeeded yet. Several relays may share a database,
+// as described in package queue.
+type Relay struct {
+	DB *sql.DB
+	// PollInterval is how often the outbox is checked for new events.
+	PollInterval time.Duration
+	// BatchSize is how many events are claimed per poll.
+	BatchSize int
+	// Lease is how long a claimed event is hidden from other relays.
+	Lease time.Duration
+	// Retention is how long processed events are kept before being pruned.
+	Retention time.Duration
+
+	names    []string
+	handlers map[string]Handler
+	delays   map[string]time.Duration
+}
+
+// NewRelay returns a Relay reading the outbox from db.
+func NewRelay(db *sql.DB) *Relay {
+	return &Relay{
+		DB:           db,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		Lease:        time.Minute,
+		Retention:    7 * 24 * time.Hour,
+		handlers:     make(map[string]Handler),
+		delays:       make(map[string]time.Duration),
+	}
+}
+
+// Register adds a handler under name. Handlers run in registration order and
+// must be registered before Run is called. The name is stored with each event
+// the handler has processed, so it should not change between releases.
+func (r *Relay) Register(name string, handler Handler) {
+	if _, ok := r.handlers[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.handlers[name] = handler
+}
+
+// RegisterDelayed is like Register, except that handler only runs once an
+// event is at least delay old. The event stays in the outbox until then.
+func (r *Relay) RegisterDelayed(name string, delay time.Duration, handler Handler) {
+	r.Register(name, handler)
+	r.delays[name] = delay
+}
+
+// Run relays events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	var lastPrune time.Time
+	queue.Poll(ctx, r.PollInterval, r.BatchSize, "relaying outbox events", r.relayDue, func(ctx context.Context) {
+		if time.Since(lastPrune) > time.Hour {
+			if err := r.prune(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("error pruning outbox: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+	})
+}
+
+type claimedEvent struct {
+	Event
+	handled  []string
+	attempts int
+	// age is how long ago the event was recorded, by the database's clock.
+	age time.Duration
+}
+
+// relayDue claims and handles one batch of due events, returning how many were claimed.
+func (r *Relay) relayDue(ctx context.Context) (int, error) {
+	batch, err := queue.Claim(ctx, r.DB, `WITH due AS (
+			SELECT id FROM outbox
+			WHERE processed_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due WHERE o.id = due.id
+		RETURNING o.id, o.event_type, o.aggregate_id, o.payload, o.created_at, o.handled, o.attempts,
+			EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - o.created_at)`,
+		func(rows *sql.Rows, event *claimedEvent) error {
+			var age float64
+			err := rows.Scan(&event.ID, &event.Type, &event.AggregateID, &event.Payload, &event.CreatedAt,
+				pq.Array(&event.handled), &event.attempts, &age)
+			event.age = time.Duration(age * float64(time.Second))
+			return err
+		},
+		r.BatchSize, r.Lease.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error claiming outbox events: %w", err)
+	}
+
+	for _, event := range batch {
+		if err := r.handle(ctx, event); err != nil {
+			return len(batch), err
+		}
+	}
+	return len(batch), nil
+}
+
+// handle runs the handlers that have not yet processed event, recording each
+// success. One failing handler does not hold back the others: the event is
+// scheduled for a retry with backoff that only reruns the failed ones. An
+// event with delayed handlers still to run is rescheduled for when the first
+// of them is due.
+func (r *Relay) handle(ctx context.Context, event claimedEvent) error {
+	var failures []string
+	ready, wait := readyHandlers(pendingHandlers(r.names, event.handled), r.delays, event.age)
+	for _, name := range ready {
+		if err := r.handlers[name](ctx, event.Event); err != nil {
+			if ctx.Err() != nil {
+				// Shutting down: leave the lease to expire so the event is retried.
+				return ctx.Err()
+			}
+			log.Printf("outbox handler %s failed on event %d (attempt %d): %v", name, event.ID, event.attempts+1, err)
+			failures = append(failures, name+": "+err.Error())
+			continue
+		}
+
+		if _, err := r.DB.ExecContext(ctx, "UPDATE outbox SET handled = array_append(handled, $1) WHERE id = $2", name, event.ID); err != nil {
+			return fmt.Errorf("error recording outbox event %d as handled by %s: %w", event.ID, name, err)
+		}
+	}
+
+	if len(failures) > 0 {
+		attempts := event.attempts + 1
+		_, err := r.DB.ExecContext(ctx,
+			"UPDATE outbox SET attempts = $1, last_error = $2, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3) WHERE id = $4",
+			attempts, strings.Join(failures, "; "), backoff(attempts).Seconds(), event.ID)
+		if err != nil {
+			return fmt.Errorf("error rescheduling outbox event %d: %w", event.ID, err)
+		}
+		return nil
+	}
+
+	if wait > 0 {
+		_, err := r.DB.ExecContext(ctx, "UPDATE outbox SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1) WHERE id = $2",
+			wait.Seconds(), event.ID)
+		if err != nil {
+			return fmt.Errorf("error scheduling delayed handlers of outbox event %d: %w", event.ID, err)
+		}
+		return nil
+	}
+
+	if _, err := r.DB.ExecContext(ctx, "UPDATE outbox SET processed_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1", event.ID); err != nil {
+		return fmt.Errorf("error marking outbox event %d processed: %w", event.ID, err)
+	}
+	return nil
+}
+
+// prune deletes events processed longer than Retention ago.
+func (r *Relay) prune(ctx context.Context) error {
+	_, err := r.DB.ExecContext(ctx, "DELETE FROM outbox WHERE processed_at < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		r.Retention.Seconds())
+	return err
+}
+
+// pendingHandlers returns the names that are not in handled, in order.
+func pendingHandlers(names, handled []string) []string {
+	done := make(map[string]bool, len(handled))
+	for _, name := range handled {
+		done[name] = true
+	}
+	var pending []string
+	for _, name := range names {
+		if !done[name] {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+// readyHandlers splits pending into the handlers that may run on an event of
+// age and how long until the first delayed one may, zero when none is waiting.
+func readyHandlers(pending []string, delays map[string]time.Duration, age time.Duration) ([]string, time.Duration) {
+	var ready []string
+	var wait time.Duration
+	for _, name := range pending {
+		if remaining := delays[name] - age; remaining > 0 {
+			if wait == 0 || remaining < wait {
+				wait = remaining
+			}
+			continue
+		}
+		ready = append(ready, name)
+	}
+	return ready, wait
+}
+
+// backoff returns the delay before retrying an event whose handlers have
+// failed attempts times: 1s doubling per attempt, capped at 5m.
+func backoff(attempts int) time.Duration {
+	const maximum = 5 * time.Minute
+	delay := time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maximum {
+			return maximum
+		}
+	}
+	return delay
+}
@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPendingHandlers(t *testing.T) {
+	names := []string{"cache", "events", "webhooks"}
+	tests := []struct {
+		name    string
+		handled []string
+		want    []string
+	}{
+		{name: "None handled", handled: nil, want: []string{"cache", "events", "webhooks"}},
+		{name: "Some handled", handled: []string{"cache"}, want: []string{"events", "webhooks"}},
+		{name: "Out of order", handled: []string{"webhooks", "cache"}, want: []string{"events"}},
+		{name: "All handled", handled: []string{"cache", "events", "webhooks"}, want: nil},
+		{name: "Unknown handler", handled: []string{"search"}, want: []string{"cache", "events", "webhooks"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pendingHandlers(names, tt.handled); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingHandlers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{9, 256 * time.Second},
+		{10, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	relay := NewRelay(nil)
+	relay.Register("cache", nil)
+	relay.Register("events", nil)
+	relay.Register("cache", nil)
+	if want := []string{"cache", "events"}; !reflect.DeepEqual(relay.names, want) {
+		t.Errorf("names = %v, want %v", relay.names, want)
+	}
+}
+
+func TestReadyHandlers(t *testing.T) {
+	delays := map[string]time.Duration{"cache-replicas": 10 * time.Second, "audit": time.Minute}
+	tests := []struct {
+		name      string
+		pending   []string
+		age       time.Duration
+		wantReady []string
+		wantWait  time.Duration
+	}{
+		{name: "No delays", pending: []string{"cache", "events"}, wantReady: []string{"cache", "events"}},
+		{name: "Delayed held back", pending: []string{"cache", "cache-replicas"}, age: 4 * time.Second, wantReady: []string{"cache"}, wantWait: 6 * time.Second},
+		{name: "Delayed due", pending: []string{"cache-replicas"}, age: 10 * time.Second, wantReady: []string{"cache-replicas"}},
+		{name: "Nothing ready", pending: []string{"cache-replicas", "audit"}, age: time.Second, wantWait: 9 * time.Second},
+		{name: "Next delay", pending: []string{"audit"}, age: 20 * time.Second, wantWait: 40 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, wait := readyHandlers(tt.pending, delays, tt.age)
+			if !reflect.DeepEqual(ready, tt.wantReady) || wait != tt.wantWait {
+				t.Errorf("readyHandlers() = %v, %v; want %v, %v", ready, wait, tt.wantReady, tt.wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package queue holds what the Postgres work queues of the outbox and the
+// webhook dispatcher share. Several workers may share a database: each claims
+// a batch of due rows with SKIP LOCKED and leases it by moving the rows' next
+// attempt time past the lease, so other workers skip them until the lease
+// expires. A worker that stops mid-batch leaves its rows to be retried then.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Execer runs a statement on a database or transaction.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Poll calls work every interval until ctx is cancelled. work claims and
+// processes one batch, returning how many rows it claimed. A full batch is
+// followed at once by the next, so a backlog drains without waiting for the
+// ticker. Errors are logged as "error <what>: ..." unless ctx is done. idle,
+// when not nil, runs once the queue is drained.
+func Poll(ctx context.Context, interval time.Duration, batchSize int, what string,
+	work func(context.Context) (int, error), idle func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := work(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("error %s: %v", what, err)
+				}
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+
+		if idle != nil {
+			idle(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Claim runs query, which claims and leases a batch of rows and returns them,
+// and scans each row with scan. Errors are returned unwrapped for the caller
+// to describe.
+func Claim[T any](ctx context.Context, db *sql.DB, query string, scan func(*sql.Rows, *T) error, args ...interface{}) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []T
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		batch = append(batch, item)
+	}
+	return batch, rows.Err()
+}
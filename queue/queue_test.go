@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	tests := []struct {
+		name string
+		// claimed is what successive calls to work return, then 0.
+		claimed []int
+		err     error
+		// wantCalls is how many times work is called before the first idle.
+		wantCalls int
+	}{
+		{name: "Empty queue", wantCalls: 1},
+		{name: "Partial batch", claimed: []int{3}, wantCalls: 1},
+		{name: "Backlog drains at once", claimed: []int{10, 10, 4}, wantCalls: 3},
+		{name: "Exactly full batches", claimed: []int{10, 10}, wantCalls: 3},
+		{name: "Error ends the drain", claimed: []int{10, 10}, err: errors.New("connection reset"), wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			calls, idles := 0, 0
+			work := func(context.Context) (int, error) {
+				calls++
+				if tt.err != nil {
+					return 0, tt.err
+				}
+				if calls <= len(tt.claimed) {
+					return tt.claimed[calls-1], nil
+				}
+				return 0, nil
+			}
+			idle := func(context.Context) {
+				idles++
+				if idles == 1 && calls != tt.wantCalls {
+					t.Errorf("work called %d times before idle, want %d", calls, tt.wantCalls)
+				}
+				cancel()
+			}
+
+			done := make(chan struct{})
+			go func() {
+				Poll(ctx, time.Hour, 10, "testing", work, idle)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Poll() did not return after ctx was cancelled")
+			}
+			if idles != 1 {
+				t.Errorf("idle called %d times, want 1", idles)
+			}
+		})
+	}
+}
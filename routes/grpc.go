@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"blogklert/controllers"
+	"blogklert/middlewares"
+	postsv1 "blogklert/proto/posts/v1"
+	"blogklert/store"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// SetupGRPCServer creates the gRPC server exposing PostService with server
+// reflection. Every call must carry the bearer token or an API key.
+func SetupGRPCServer(config Config, h *controllers.Handlers) *grpc.Server {
+	auth := middlewares.GRPCAuth{
+		BearerToken: config.GetBearerToken(),
+		APIKeys:     config.GetAPIKeys(),
+	}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.UnaryInterceptor(), readYourWritesUnary),
+		grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+	)
+	postsv1.RegisterPostServiceServer(server, h.PostService())
+	reflection.Register(server)
+
+	return server
+}
+
+// readYourWritesUnary sends the reads following a write in the same call to
+// the primary database.
+func readYourWritesUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(store.WithSession(ctx), req)
+}
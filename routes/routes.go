@@ -2,7 +2,14 @@ package routes
 
 import (
 	"blogklert/controllers"
+	"blogklert/db"
+	"blogklert/graph"
 	"blogklert/middlewares"
+	"blogklert/openapi"
+	"blogklert/store"
+	"encoding/json"
+	"expvar"
+	"log"
 	"net/http"
 	"time"
 
@@ -12,24 +19,33 @@ import (
 // Config interface represents the configuration needed for setting up routes.
 type Config interface {
 	GetBearerToken() string
+	GetUnversionedDeprecation() db.DeprecationConfig
+	GetDevMode() bool
+	GetGraphQLConfig() db.GraphQLConfig
+	GetAPIKeys() []string
 }
 
-// SetupRoutes sets up the application routes and middlewares.
-func SetupRoutes(config Config) http.Handler {
+// SetupRoutes sets up the application routes and middlewares around h.
+func SetupRoutes(config Config, h *controllers.Handlers) (http.Handler, error) {
 	router := mux.NewRouter()
-	controllers.SetupRootRoute(router)
-	controllers.SetupPostRoutes(router)
+	doc := apiDocument()
+	if err := registerRoutes(router, config, h, doc); err != nil {
+		return nil, err
+	}
 
 	// Create a CorsConfig instance
 	corsConfig := &middlewares.CorsConfig{
 		AllowedOrigins:   []string{"http://0.0.0.0:3000", "http://localhost:8000", "https://www.klevertopee.app", "https://klevert-dev.koyeb.app"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "Authorization", "If-Match", "If-None-Match", "If-Modified-Since", "Idempotency-Key", "Prefer", "Last-Event-ID"},
+		ExposedHeaders:   []string{"ETag", "Last-Modified", "Location", "Idempotent-Replayed", "Preference-Applied", "Deprecation", "Sunset", "Link"},
 		AllowCredentials: true,
 	}
 
 	// Apply Cors middlewares to all requests by wrapping the router
 	router.Use(middlewares.CorsMiddleware(corsConfig))
+	router.Use(openapi.Validator(doc, config.GetDevMode()))
+	router.Use(readYourWrites)
 
 	// Initialize rate limiter with limit, window duration, and cleanup interval
 	rateLimiter := middlewares.NewRateLimiter(15, 1*time.Minute, 1*time.Minute, 1)
@@ -38,5 +54,111 @@ func SetupRoutes(config Config) http.Handler {
 	middlewareChain := rateLimiter.Limit(middlewares.ValidateBearerToken(config.GetBearerToken())(router))
 	middlewareChain = middlewares.LoggingMiddleware(middlewareChain)
 
-	return middlewareChain
+	// Serve the health check to load balancers without a token or rate limit
+	root := http.NewServeMux()
+	root.Handle("/healthz", h.HealthHandler())
+	root.Handle("/", middlewareChain)
+
+	return root, nil
+}
+
+// registerRoutes registers the routes of h on router, serving doc as the
+// OpenAPI document. Every one of them must be described by doc.
+func registerRoutes(router *mux.Router, config Config, h *controllers.Handlers, doc *openapi.Document) error {
+	controllers.SetupRootRoute(router)
+
+	// Mount the versioned API
+	v1Router := router.PathPrefix(controllers.V1.Prefix).Subrouter()
+	h.SetupPostRoutes(v1Router, controllers.V1)
+	h.SetupWebhookRoutes(v1Router)
+	h.SetupCacheRoutes(v1Router)
+
+	// Keep the unversioned routes as deprecated aliases of v1
+	deprecation := config.GetUnversionedDeprecation()
+	legacyRouter := router.NewRoute().Subrouter()
+	legacyRouter.Use(middlewares.Deprecation(middlewares.DeprecationConfig{
+		DeprecatedAt:    deprecation.DeprecatedAt,
+		Sunset:          deprecation.Sunset,
+		SuccessorPrefix: controllers.V1.Prefix,
+	}))
+	h.SetupPostRoutes(legacyRouter, controllers.V1)
+
+	// Serve GraphQL alongside the REST API
+	graphQL := config.GetGraphQLConfig()
+	if err := h.SetupGraphQLRoute(router, graph.Limits(graphQL)); err != nil {
+		return err
+	}
+
+	// Stream post changes as Server-Sent Events
+	h.SetupEventRoutes(router)
+
+	// Expose cache hit and miss counters alongside the runtime metrics
+	router.Handle("/debug/vars", metricsHandler(func() interface{} { return h.Posts.Cache.Stats() })).Methods("GET")
+
+	// Serve the OpenAPI document
+	router.Handle("/openapi.json", openapi.Handler(doc)).Methods("GET")
+	return nil
+}
+
+// apiDocument describes every route registered by SetupRoutes.
+func apiDocument() *openapi.Document {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Blogklert API",
+			Version:     "1.0.0",
+			Description: "Blog posts API. Unversioned routes are deprecated aliases of /v1.",
+		},
+		Components: openapi.Components{
+			Schemas: controllers.PostSchemas(),
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+			},
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}},
+	}
+	for name, schema := range controllers.WebhookSchemas() {
+		doc.Components.Schemas[name] = schema
+	}
+	doc.AddPaths(controllers.RootPaths())
+	doc.AddPaths(controllers.PostPaths(controllers.V1.Prefix, false))
+	doc.AddPaths(controllers.PostPaths("", true))
+	doc.AddPaths(controllers.WebhookPaths(controllers.V1.Prefix))
+	doc.AddPaths(controllers.CachePaths(controllers.V1.Prefix))
+	doc.AddPaths(controllers.GraphQLPaths())
+	doc.AddPaths(controllers.EventPaths())
+	doc.AddPaths(controllers.HealthPaths())
+	doc.AddPaths(controllers.ServicePaths())
+	return doc
+}
+
+// readYourWrites sends the reads following a write in the same request to
+// the primary database rather than a replica that may not have it yet.
+func readYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(store.WithSession(r.Context())))
+	})
+}
+
+// metricsHandler serves the expvar variables with the cache statistics of
+// these handlers added. The statistics are not published with expvar so that
+// several instances can share a process.
+func metricsHandler(cacheStats func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := make(map[string]json.RawMessage)
+		expvar.Do(func(kv expvar.KeyValue) {
+			vars[kv.Key] = json.RawMessage(kv.Value.String())
+		})
+		stats, err := json.Marshal(cacheStats())
+		if err != nil {
+			http.Error(w, "Failed to encode cache metrics", http.StatusInternalServerError)
+			return
+		}
+		vars["cache"] = stats
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(vars); err != nil {
+			log.Printf("Error encoding metrics: %v", err)
+		}
+	})
 }
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"blogklert/controllers"
+	"blogklert/db"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testConfig is the configuration of the routes under test.
+type testConfig struct{}
+
+func (testConfig) GetBearerToken() string                          { return "token" }
+func (testConfig) GetUnversionedDeprecation() db.DeprecationConfig { return db.DeprecationConfig{} }
+func (testConfig) GetDevMode() bool                                { return false }
+func (testConfig) GetGraphQLConfig() db.GraphQLConfig              { return db.GraphQLConfig{} }
+func (testConfig) GetAPIKeys() []string                            { return nil }
+
+func TestAPIDocumentCoversRoutes(t *testing.T) {
+	// Postgres mounts every route; other drivers stub out the webhook admin API.
+	h := controllers.New(controllers.Deps{Driver: db.Postgres, Logger: log.New(io.Discard, "", 0)})
+	router := mux.NewRouter()
+	doc := apiDocument()
+	if err := registerRoutes(router, testConfig{}, h, doc); err != nil {
+		t.Fatalf("registerRoutes() error = %v", err)
+	}
+
+	routes := 0
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			// A prefix or subrouter rather than a route
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("%s is served for every method", path)
+			return nil
+		}
+		for _, method := range methods {
+			routes++
+			if _, ok := doc.Operation(method, path); !ok {
+				t.Errorf("%s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if routes == 0 {
+		t.Fatal("no routes registered")
+	}
+	if _, ok := doc.Operation("GET", "/healthz"); !ok {
+		t.Error("GET /healthz is missing from the OpenAPI document")
+	}
+}
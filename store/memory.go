@@ -0,0 +1,414 @@
+package store
+
+import (
+	"blogklert/models"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Memory keeps posts in process memory. It behaves like Postgres, including
+// transactions, and suits tests and running without a database.
+type Memory struct {
+	// OnChange, when set, is called with every change once it is committed.
+	OnChange func(ctx context.Context, change Change)
+	// Clock stamps writes; nil reads the system clock.
+	Clock func() time.Time
+
+	mu    sync.RWMutex
+	posts memoryPosts
+}
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{posts: make(memoryPosts)}
+}
+
+func (m *Memory) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.list(columns)
+}
+
+func (m *Memory) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.get(id, columns)
+}
+
+func (m *Memory) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.getByIDs(ids), nil
+}
+
+func (m *Memory) GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.getBySlugs(slugs), nil
+}
+
+func (m *Memory) Page(ctx context.Context, query PageQuery) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.page(query), nil
+}
+
+func (m *Memory) Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.adjacent(ids, older), nil
+}
+
+func (m *Memory) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.posts.version(id)
+}
+
+func (m *Memory) Create(ctx context.Context, post models.Post) (created models.Post, err error) {
+	err = m.write(ctx, func(tx *memoryTx) error {
+		created, err = tx.Create(ctx, post)
+		return err
+	})
+	return created, err
+}
+
+func (m *Memory) Update(ctx context.Context, post models.Post, expected *int) (version int, err error) {
+	err = m.write(ctx, func(tx *memoryTx) error {
+		version, err = tx.Update(ctx, post, expected)
+		return err
+	})
+	return version, err
+}
+
+func (m *Memory) Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (version int, err error) {
+	err = m.write(ctx, func(tx *memoryTx) error {
+		version, err = tx.Patch(ctx, id, changes, expected)
+		return err
+	})
+	return version, err
+}
+
+func (m *Memory) Delete(ctx context.Context, id uuid.UUID, expected *int) error {
+	return m.write(ctx, func(tx *memoryTx) error {
+		return tx.Delete(ctx, id, expected)
+	})
+}
+
+// write applies a single write in place. Writes check everything before
+// changing a post, so a failed one leaves the posts untouched.
+func (m *Memory) write(ctx context.Context, fn func(tx *memoryTx) error) error {
+	m.mu.Lock()
+	tx := &memoryTx{posts: m.posts, clock: m.Clock}
+	err := fn(tx)
+	m.mu.Unlock()
+	if err == nil {
+		m.notify(ctx, tx.changes)
+	}
+	return err
+}
+
+func (m *Memory) notify(ctx context.Context, changes []Change) {
+	if m.OnChange == nil {
+		return
+	}
+	for _, change := range changes {
+		m.OnChange(ctx, change)
+	}
+}
+
+// WithTx runs fn against a copy of the posts, which replaces them when fn
+// returns nil. Writes are serialized for the duration of fn.
+func (m *Memory) WithTx(ctx context.Context, fn func(tx PostStore) error) error {
+	m.mu.Lock()
+	tx := &memoryTx{posts: m.posts.clone(), clock: m.Clock}
+	err := fn(tx)
+	if err == nil {
+		m.posts = tx.posts
+	}
+	m.mu.Unlock()
+	if err == nil {
+		m.notify(ctx, tx.changes)
+	}
+	return err
+}
+
+// memoryTx applies writes to a set of posts that is either a private copy or
+// guarded by the Memory lock, so it needs no locking of its own.
+type memoryTx struct {
+	posts   memoryPosts
+	changes []Change
+	clock   func() time.Time
+}
+
+func (t *memoryTx) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	return t.posts.list(columns)
+}
+
+func (t *memoryTx) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	return t.posts.get(id, columns)
+}
+
+func (t *memoryTx) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	return t.posts.getByIDs(ids), nil
+}
+
+func (t *memoryTx) GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error) {
+	return t.posts.getBySlugs(slugs), nil
+}
+
+func (t *memoryTx) Page(ctx context.Context, query PageQuery) ([]models.Post, error) {
+	return t.posts.page(query), nil
+}
+
+func (t *memoryTx) Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error) {
+	return t.posts.adjacent(ids, older), nil
+}
+
+func (t *memoryTx) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	return t.posts.version(id)
+}
+
+func (t *memoryTx) Create(ctx context.Context, post models.Post) (models.Post, error) {
+	if _, ok := t.posts[post.ID]; ok {
+		return models.Post{}, fmt.Errorf("post %s already exists", post.ID)
+	}
+	for _, existing := range t.posts {
+		if existing.Slug == post.Slug {
+			return models.Post{}, fmt.Errorf("post slug %q already exists", post.Slug)
+		}
+	}
+	post.CreatedAt = timestamp(t.clock)
+	post.UpdatedAt = post.CreatedAt
+	post.Version = 1
+	t.posts[post.ID] = post
+	t.changes = append(t.changes, Change{Type: Created, PostID: post.ID, Version: post.Version})
+	return post, nil
+}
+
+func (t *memoryTx) Update(ctx context.Context, post models.Post, expected *int) (int, error) {
+	return t.Patch(ctx, post.ID, map[string]string{"title": post.Title, "excerpt": post.Excerpt, "body": post.Body}, expected)
+}
+
+func (t *memoryTx) Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (int, error) {
+	for column := range changes {
+		if !isPatchable(column) {
+			return 0, fmt.Errorf("post column %q cannot be changed", column)
+		}
+	}
+	post, ok := t.posts[id]
+	if !ok {
+		return 0, notFound(id)
+	}
+	if expected != nil && post.Version != *expected {
+		return 0, ErrVersionMismatch
+	}
+	if len(changes) == 0 {
+		return post.Version, nil
+	}
+
+	for column, value := range changes {
+		*Field(&post, column).(*string) = value
+	}
+	post.UpdatedAt = timestamp(t.clock)
+	post.Version++
+	t.posts[id] = post
+	t.changes = append(t.changes, Change{Type: Updated, PostID: id, Version: post.Version})
+	return post.Version, nil
+}
+
+func (t *memoryTx) Delete(ctx context.Context, id uuid.UUID, expected *int) error {
+	post, ok := t.posts[id]
+	if !ok {
+		if expected == nil {
+			return nil
+		}
+		return notFound(id)
+	}
+	if expected != nil && post.Version != *expected {
+		return ErrVersionMismatch
+	}
+	delete(t.posts, id)
+	t.changes = append(t.changes, Change{Type: Deleted, PostID: id})
+	return nil
+}
+
+// WithTx runs fn against a copy of the transaction's posts, like a savepoint.
+func (t *memoryTx) WithTx(ctx context.Context, fn func(tx PostStore) error) error {
+	nested := &memoryTx{posts: t.posts.clone(), clock: t.clock}
+	if err := fn(nested); err != nil {
+		return err
+	}
+	t.posts = nested.posts
+	t.changes = append(t.changes, nested.changes...)
+	return nil
+}
+
+// memoryPosts holds posts by id.
+type memoryPosts map[uuid.UUID]models.Post
+
+func (p memoryPosts) clone() memoryPosts {
+	clone := make(memoryPosts, len(p))
+	for id, post := range p {
+		clone[id] = post
+	}
+	return clone
+}
+
+// sorted returns every post newest first, like the ORDER BY created_at DESC,
+// id DESC of Postgres.
+func (p memoryPosts) sorted() []models.Post {
+	posts := make([]models.Post, 0, len(p))
+	for _, post := range p {
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return newer(posts[i], posts[j].CreatedAt, posts[j].ID)
+	})
+	return posts
+}
+
+// newer reports whether post comes before the position (createdAt, id) in the
+// newest-first order.
+func newer(post models.Post, createdAt time.Time, id uuid.UUID) bool {
+	if !post.CreatedAt.Equal(createdAt) {
+		return post.CreatedAt.After(createdAt)
+	}
+	return bytes.Compare(post.ID[:], id[:]) > 0
+}
+
+func (p memoryPosts) list(columns []string) ([]models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	for _, post := range p.sorted() {
+		posts = append(posts, project(post, columns))
+	}
+	return posts, nil
+}
+
+func (p memoryPosts) get(id uuid.UUID, columns []string) (models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return models.Post{}, err
+	}
+	post, ok := p[id]
+	if !ok {
+		return models.Post{}, notFound(id)
+	}
+	return project(post, columns), nil
+}
+
+func (p memoryPosts) getByIDs(ids []uuid.UUID) []models.Post {
+	var posts []models.Post
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if post, ok := p[id]; ok && !seen[id] {
+			seen[id] = true
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+func (p memoryPosts) getBySlugs(slugs []string) []models.Post {
+	wanted := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		wanted[slug] = true
+	}
+	var posts []models.Post
+	for _, post := range p {
+		if wanted[post.Slug] {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+func (p memoryPosts) page(query PageQuery) []models.Post {
+	search := strings.ToLower(query.Search)
+	var posts []models.Post
+	for _, post := range p.sorted() {
+		if len(posts) == query.Limit {
+			break
+		}
+		switch {
+		case query.After != nil && !newer(models.Post{CreatedAt: query.After.CreatedAt, ID: query.After.ID}, post.CreatedAt, post.ID):
+		case search != "" && !strings.Contains(strings.ToLower(post.Title), search) &&
+			!strings.Contains(strings.ToLower(post.Excerpt), search) && !strings.Contains(strings.ToLower(post.Body), search):
+		case query.CreatedAfter != nil && !post.CreatedAt.After(*query.CreatedAfter):
+		case query.CreatedBefore != nil && !post.CreatedAt.Before(*query.CreatedBefore):
+		default:
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+func (p memoryPosts) adjacent(ids []uuid.UUID, older bool) map[uuid.UUID]models.Post {
+	posts := p.sorted()
+	index := make(map[uuid.UUID]int, len(posts))
+	for i, post := range posts {
+		index[post.ID] = i
+	}
+
+	adjacent := make(map[uuid.UUID]models.Post, len(ids))
+	for _, id := range ids {
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		if older {
+			i++
+		} else {
+			i--
+		}
+		if i >= 0 && i < len(posts) {
+			adjacent[id] = posts[i]
+		}
+	}
+	return adjacent
+}
+
+func (p memoryPosts) version(id uuid.UUID) (int, error) {
+	post, ok := p[id]
+	if !ok {
+		return 0, notFound(id)
+	}
+	return post.Version, nil
+}
+
+// project returns a copy of post with only columns set.
+func project(post models.Post, columns []string) models.Post {
+	var projected models.Post
+	for _, column := range columns {
+		switch column {
+		case "id":
+			projected.ID = post.ID
+		case "slug":
+			projected.Slug = post.Slug
+		case "title":
+			projected.Title = post.Title
+		case "excerpt":
+			projected.Excerpt = post.Excerpt
+		case "body":
+			projected.Body = post.Body
+		case "created_at":
+			projected.CreatedAt = post.CreatedAt
+		case "updated_at":
+			projected.UpdatedAt = post.UpdatedAt
+		case "version":
+			projected.Version = post.Version
+		}
+	}
+	return projected
+}
@@ -0,0 +1,13 @@
+package store_test
+
+import (
+	"blogklert/store"
+	"blogklert/store/storetest"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.PostStore {
+		return store.NewMemory()
+	})
+}
@@ -0,0 +1,330 @@
+package store
+
+import (
+	"blogklert/models"
+	"blogklert/queue"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Postgres stores posts in the posts table.
+type Postgres struct {
+	// Record, when set, is called with every write inside the transaction
+	// applying it, so it can record the change through q atomically, for
+	// example in an outbox. An error aborts the write.
+	Record func(ctx context.Context, q queue.Execer, change Change) error
+	// Clock stamps writes; nil reads the system clock.
+	Clock func() time.Time
+
+	db *sql.DB
+	// tx is the transaction the store runs in, or nil outside of WithTx.
+	tx *sql.Tx
+	// depth counts the savepoints nested in tx.
+	depth int
+}
+
+// NewPostgres returns a store reading and writing db.
+func NewPostgres(db *sql.DB, record func(ctx context.Context, q queue.Execer, change Change) error) *Postgres {
+	return &Postgres{db: db, Record: record}
+}
+
+func (p *Postgres) q() dbtx {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.db
+}
+
+// WithTx runs fn in a transaction, or under a savepoint when p is already in one.
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx PostStore) error) error {
+	if p.tx != nil {
+		return p.withSavepoint(ctx, fn)
+	}
+
+	return inTx(ctx, p.db, func(tx *sql.Tx) error {
+		return fn(&Postgres{Record: p.Record, Clock: p.Clock, db: p.db, tx: tx})
+	})
+}
+
+func (p *Postgres) withSavepoint(ctx context.Context, fn func(tx PostStore) error) error {
+	return inSavepoint(ctx, p.tx, p.depth+1, func() error {
+		return fn(&Postgres{Record: p.Record, Clock: p.Clock, db: p.db, tx: p.tx, depth: p.depth + 1})
+	})
+}
+
+// atomically runs fn in the current transaction, or in a new one outside of
+// WithTx, so a write and its recorded change commit together.
+func (p *Postgres) atomically(ctx context.Context, fn func(s *Postgres) error) error {
+	if p.tx != nil {
+		return fn(p)
+	}
+	return p.WithTx(ctx, func(tx PostStore) error {
+		return fn(tx.(*Postgres))
+	})
+}
+
+// record passes change to Record, inside the current transaction.
+func (p *Postgres) record(ctx context.Context, change Change) error {
+	if p.Record == nil {
+		return nil
+	}
+	return p.Record(ctx, p.q(), change)
+}
+
+func (p *Postgres) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return nil, err
+	}
+	return p.query(ctx, columns, "SELECT "+strings.Join(columns, ",")+" FROM posts ORDER BY created_at DESC, id DESC")
+}
+
+func (p *Postgres) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return models.Post{}, err
+	}
+	var post models.Post
+	err = p.q().QueryRowContext(ctx, "SELECT "+strings.Join(columns, ",")+" FROM posts WHERE id = $1", id).
+		Scan(scanTargets(&post, columns)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Post{}, notFound(id)
+	}
+	if err != nil {
+		return models.Post{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return post, nil
+}
+
+func (p *Postgres) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	return p.query(ctx, Columns, "SELECT "+strings.Join(Columns, ",")+" FROM posts WHERE id = ANY($1::uuid[])", pq.Array(keys))
+}
+
+func (p *Postgres) GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error) {
+	return p.query(ctx, Columns, "SELECT "+strings.Join(Columns, ",")+" FROM posts WHERE slug = ANY($1)", pq.Array(slugs))
+}
+
+func (p *Postgres) Page(ctx context.Context, query PageQuery) ([]models.Post, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if query.After != nil {
+		conditions = append(conditions, "(created_at, id) < ("+arg(query.After.CreatedAt)+", "+arg(query.After.ID)+")")
+	}
+	if query.Search != "" {
+		pattern := arg("%" + escapeLike(query.Search) + "%")
+		conditions = append(conditions, "(title ILIKE "+pattern+" OR excerpt ILIKE "+pattern+" OR body ILIKE "+pattern+")")
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+arg(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*query.CreatedBefore))
+	}
+
+	statement := "SELECT " + strings.Join(Columns, ",") + " FROM posts"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY created_at DESC, id DESC LIMIT " + arg(query.Limit)
+	return p.query(ctx, Columns, statement, args...)
+}
+
+func (p *Postgres) Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error) {
+	op, order := ">", "ASC"
+	if older {
+		op, order = "<", "DESC"
+	}
+	query := "SELECT k.id," + qualified("a") +
+		" FROM unnest($1::uuid[]) AS k(id)" +
+		" JOIN posts c ON c.id = k.id" +
+		" JOIN LATERAL (SELECT " + qualified("p") + " FROM posts p" +
+		" WHERE (p.created_at, p.id) " + op + " (c.created_at, c.id)" +
+		" ORDER BY p.created_at " + order + ", p.id " + order + " LIMIT 1) a ON true"
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	rows, err := p.q().QueryContext(ctx, query, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	posts := make(map[uuid.UUID]models.Post, len(ids))
+	for rows.Next() {
+		var (
+			key  uuid.UUID
+			post models.Post
+		)
+		if err := rows.Scan(append([]interface{}{&key}, scanTargets(&post, Columns)...)...); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts[key] = post
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return posts, nil
+}
+
+func (p *Postgres) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	var version int
+	err := p.q().QueryRowContext(ctx, "SELECT version FROM posts WHERE id = $1", id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, notFound(id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying database: %w", err)
+	}
+	return version, nil
+}
+
+func (p *Postgres) Create(ctx context.Context, post models.Post) (models.Post, error) {
+	post.CreatedAt = timestamp(p.Clock)
+	post.UpdatedAt = post.CreatedAt
+	post.Version = 1
+	err := p.atomically(ctx, func(s *Postgres) error {
+		_, err := s.tx.ExecContext(ctx, "INSERT INTO posts (id, slug, title, excerpt, body, created_at, updated_at, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			post.ID, post.Slug, post.Title, post.Excerpt, post.Body, post.CreatedAt, post.UpdatedAt, post.Version)
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, Change{Type: Created, PostID: post.ID, Version: post.Version})
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+func (p *Postgres) Update(ctx context.Context, post models.Post, expected *int) (int, error) {
+	return p.Patch(ctx, post.ID, map[string]string{"title": post.Title, "excerpt": post.Excerpt, "body": post.Body}, expected)
+}
+
+func (p *Postgres) Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (int, error) {
+	var (
+		sets []string
+		args []interface{}
+	)
+	for _, column := range Patchable {
+		value, ok := changes[column]
+		if !ok {
+			continue
+		}
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	for column := range changes {
+		if !isPatchable(column) {
+			return 0, fmt.Errorf("post column %q cannot be changed", column)
+		}
+	}
+
+	if len(sets) == 0 {
+		version, err := p.Version(ctx, id)
+		if err == nil && expected != nil && version != *expected {
+			return 0, ErrVersionMismatch
+		}
+		return version, err
+	}
+
+	args = append(args, timestamp(p.Clock), id)
+	query := fmt.Sprintf("UPDATE posts SET %s, updated_at = $%d, version = version + 1 WHERE id = $%d", strings.Join(sets, ", "), len(args)-1, len(args))
+	if expected != nil {
+		args = append(args, *expected)
+		query += fmt.Sprintf(" AND version = $%d", len(args))
+	}
+
+	var version int
+	err := p.atomically(ctx, func(s *Postgres) error {
+		err := s.tx.QueryRowContext(ctx, query+" RETURNING version", args...).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.writeConflict(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, Change{Type: Updated, PostID: id, Version: version})
+	})
+	return version, err
+}
+
+func (p *Postgres) Delete(ctx context.Context, id uuid.UUID, expected *int) error {
+	query := "DELETE FROM posts WHERE id = $1"
+	args := []interface{}{id}
+	if expected != nil {
+		query += " AND version = $2"
+		args = append(args, *expected)
+	}
+
+	return p.atomically(ctx, func(s *Postgres) error {
+		result, err := s.tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			if expected == nil {
+				// Deleting a missing post succeeds without a change to record.
+				return nil
+			}
+			return s.writeConflict(ctx, id)
+		}
+		return s.record(ctx, Change{Type: Deleted, PostID: id})
+	})
+}
+
+// ReplicationLag returns how far a streaming replica is behind its primary:
+// zero when it has replayed everything it received, otherwise the age of the
+// last transaction it replayed. A primary reports zero.
+func (p *Postgres) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	var seconds float64
+	err := p.db.QueryRowContext(ctx, `SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("error querying replication lag: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// writeConflict explains why a conditional write matched no rows.
+func (p *Postgres) writeConflict(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	if err := p.q().QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1)", id).Scan(&exists); err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	if !exists {
+		return notFound(id)
+	}
+	return ErrVersionMismatch
+}
+
+// query runs a statement selecting columns and scans every row.
+func (p *Postgres) query(ctx context.Context, columns []string, query string, args ...interface{}) ([]models.Post, error) {
+	return queryPosts(ctx, p.q(), columns, query, args...)
+}
@@ -0,0 +1,35 @@
+package store_test
+
+import (
+	"blogklert/db"
+	"blogklert/store"
+	"blogklert/store/storetest"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// TestPostgres runs the conformance suite against the database at
+// TEST_DB_URL, which it migrates and empties. It is skipped when unset.
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	conn, err := sql.Open(db.Postgres, url)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer conn.Close()
+	if _, err := db.Migrate(context.Background(), conn, db.Postgres); err != nil {
+		t.Fatalf("db.Migrate() error = %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) store.PostStore {
+		if _, err := conn.Exec("TRUNCATE posts"); err != nil {
+			t.Fatalf("error emptying posts: %v", err)
+		}
+		return store.NewPostgres(conn, nil)
+	})
+}
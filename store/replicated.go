@@ -0,0 +1,256 @@
+package store
+
+import (
+	"blogklert/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReplicaStore is a read-only copy of the primary's posts that can tell how
+// far behind it is.
+type ReplicaStore interface {
+	PostStore
+	// ReplicationLag returns how long ago the newest change the replica has
+	// applied was committed on the primary, or zero when it is caught up.
+	ReplicationLag(ctx context.Context) (time.Duration, error)
+}
+
+// replicaCheckTimeout bounds the lag check of one replica.
+const replicaCheckTimeout = 2 * time.Second
+
+// ReplicaStatus describes a replica for health checks.
+type ReplicaStatus struct {
+	Name string
+	// InRotation is set while reads are sent to the replica.
+	InRotation bool
+	Lag        time.Duration
+	// Err is why the replica is out of rotation, if it is.
+	Err error
+}
+
+// Replicated sends writes and transactions to a primary and spreads reads
+// over the replicas in rotation, round robin. Replicas leave the rotation
+// when they lag more than MaxLag behind or fail a read, and come back once a
+// check finds them caught up. Reads fall back to the primary when no replica
+// is in rotation.
+//
+// Reads made with a context from WithSession go to the primary once a write
+// has been made with it, so a request reads its own writes.
+type Replicated struct {
+	Primary PostStore
+	// MaxLag is how far behind a replica may be and stay in rotation.
+	MaxLag time.Duration
+	// CheckInterval is how often Run checks the replicas.
+	CheckInterval time.Duration
+
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+// replica tracks whether one replica is in rotation.
+type replica struct {
+	name  string
+	store ReplicaStore
+
+	mu         sync.Mutex
+	inRotation bool
+	lag        time.Duration
+	err        error
+}
+
+// NewReplicated returns a store over primary and replicas, which stay out
+// of rotation until a check finds them caught up.
+func NewReplicated(primary PostStore, replicas []ReplicaStore, maxLag time.Duration) *Replicated {
+	r := &Replicated{Primary: primary, MaxLag: maxLag, CheckInterval: time.Second}
+	for i, s := range replicas {
+		r.replicas = append(r.replicas, &replica{
+			name:  fmt.Sprintf("replica-%d", i+1),
+			store: s,
+			err:   errors.New("not checked yet"),
+		})
+	}
+	return r
+}
+
+// Run checks the replicas every CheckInterval until ctx is done.
+func (r *Replicated) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.CheckInterval)
+	defer ticker.Stop()
+	for {
+		r.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check measures the lag of every replica and updates the rotation.
+func (r *Replicated) Check(ctx context.Context) {
+	for _, rep := range r.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		lag, err := rep.store.ReplicationLag(checkCtx)
+		cancel()
+		if err == nil && lag > r.MaxLag {
+			err = fmt.Errorf("lagging %s behind the primary", lag.Round(time.Millisecond))
+		}
+		rep.set(lag, err)
+	}
+}
+
+// Status reports the state of every replica.
+func (r *Replicated) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(r.replicas))
+	for i, rep := range r.replicas {
+		rep.mu.Lock()
+		statuses[i] = ReplicaStatus{Name: rep.name, InRotation: rep.inRotation, Lag: rep.lag, Err: rep.err}
+		rep.mu.Unlock()
+	}
+	return statuses
+}
+
+// set records the outcome of a check or read, logging rotation changes.
+func (rep *replica) set(lag time.Duration, err error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.lag = lag
+	switch {
+	case err != nil && rep.inRotation:
+		log.Printf("read replica %s is out of rotation: %v", rep.name, err)
+	case err == nil && !rep.inRotation:
+		log.Printf("read replica %s is in rotation", rep.name)
+	}
+	rep.inRotation = err == nil
+	rep.err = err
+}
+
+func (rep *replica) available() bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.inRotation
+}
+
+// reader returns the next replica in rotation, or nil when ctx must read
+// from the primary or no replica is available.
+func (r *Replicated) reader(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || wrote(ctx) {
+		return nil
+	}
+	available := make([]*replica, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		if rep.available() {
+			available = append(available, rep)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	return available[r.next.Add(1)%uint64(len(available))]
+}
+
+// read runs fn on a replica, retrying on the primary when the replica fails.
+// The replica leaves the rotation if the primary then succeeds, so that a
+// bad query does not take every replica out.
+func read[T any](ctx context.Context, r *Replicated, fn func(s PostStore) (T, error)) (T, error) {
+	rep := r.reader(ctx)
+	if rep == nil {
+		return fn(r.Primary)
+	}
+	value, err := fn(rep.store)
+	if err == nil || errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+		return value, err
+	}
+	value, primaryErr := fn(r.Primary)
+	if primaryErr == nil {
+		rep.set(0, err)
+	}
+	return value, primaryErr
+}
+
+func (r *Replicated) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	return read(ctx, r, func(s PostStore) ([]models.Post, error) { return s.List(ctx, columns) })
+}
+
+func (r *Replicated) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	return read(ctx, r, func(s PostStore) (models.Post, error) { return s.Get(ctx, id, columns) })
+}
+
+func (r *Replicated) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	return read(ctx, r, func(s PostStore) ([]models.Post, error) { return s.GetByIDs(ctx, ids) })
+}
+
+func (r *Replicated) GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error) {
+	return read(ctx, r, func(s PostStore) ([]models.Post, error) { return s.GetBySlugs(ctx, slugs) })
+}
+
+func (r *Replicated) Page(ctx context.Context, query PageQuery) ([]models.Post, error) {
+	return read(ctx, r, func(s PostStore) ([]models.Post, error) { return s.Page(ctx, query) })
+}
+
+func (r *Replicated) Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error) {
+	return read(ctx, r, func(s PostStore) (map[uuid.UUID]models.Post, error) { return s.Adjacent(ctx, ids, older) })
+}
+
+// Version reads from the primary: callers compare it before writing.
+func (r *Replicated) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	return r.Primary.Version(ctx, id)
+}
+
+func (r *Replicated) Create(ctx context.Context, post models.Post) (models.Post, error) {
+	markWrite(ctx)
+	return r.Primary.Create(ctx, post)
+}
+
+func (r *Replicated) Update(ctx context.Context, post models.Post, expected *int) (int, error) {
+	markWrite(ctx)
+	return r.Primary.Update(ctx, post, expected)
+}
+
+func (r *Replicated) Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (int, error) {
+	markWrite(ctx)
+	return r.Primary.Patch(ctx, id, changes, expected)
+}
+
+func (r *Replicated) Delete(ctx context.Context, id uuid.UUID, expected *int) error {
+	markWrite(ctx)
+	return r.Primary.Delete(ctx, id, expected)
+}
+
+// WithTx runs fn on the primary, where every read of the transaction is made.
+func (r *Replicated) WithTx(ctx context.Context, fn func(tx PostStore) error) error {
+	markWrite(ctx)
+	return r.Primary.WithTx(ctx, fn)
+}
+
+// sessionKey is the context key of a session.
+type sessionKey struct{}
+
+// session records whether a write was made in a request.
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a context in which reads through Replicated go to the
+// primary once a write has been made with it. Servers derive one per request.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+func markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+func wrote(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
@@ -0,0 +1,111 @@
+package store_test
+
+import (
+	"blogklert/models"
+	"blogklert/store"
+	"blogklert/store/storetest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeReplica is an in-memory replica reporting a fixed lag.
+type fakeReplica struct {
+	store.PostStore
+	lag time.Duration
+	err error
+}
+
+func (r *fakeReplica) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	return r.lag, r.err
+}
+
+// TestReplicatedConformance runs the suite with a replica sharing the
+// primary's data, as a caught-up replica would.
+func TestReplicatedConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.PostStore {
+		primary := store.NewMemory()
+		s := store.NewReplicated(primary, []store.ReplicaStore{&fakeReplica{PostStore: primary}}, time.Second)
+		s.Check(context.Background())
+		return s
+	})
+}
+
+func TestReplicatedRouting(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name string
+		// lag and err are reported by the replica's lag check.
+		lag time.Duration
+		err error
+		// write makes a write with the session before reading.
+		write bool
+		// fromPrimary is whether the read is expected on the primary.
+		fromPrimary bool
+		inRotation  bool
+	}{
+		{name: "Caught up", fromPrimary: false, inRotation: true},
+		{name: "Within lag", lag: 500 * time.Millisecond, fromPrimary: false, inRotation: true},
+		{name: "Lagging", lag: 2 * time.Second, fromPrimary: true, inRotation: false},
+		{name: "Unreachable", err: errDown, fromPrimary: true, inRotation: false},
+		{name: "Read after write", write: true, fromPrimary: true, inRotation: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := store.WithSession(context.Background())
+			primary, replica := store.NewMemory(), store.NewMemory()
+			post, err := primary.Create(ctx, models.Post{ID: uuid.New(), Slug: "primary", Title: "On the primary"})
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			s := store.NewReplicated(primary, []store.ReplicaStore{&fakeReplica{PostStore: replica, lag: tt.lag, err: tt.err}}, time.Second)
+			s.Check(ctx)
+			if tt.write {
+				if _, err := s.Patch(ctx, post.ID, map[string]string{"title": "Patched"}, nil); err != nil {
+					t.Fatalf("Patch() error = %v", err)
+				}
+			}
+
+			// Only the primary holds the post, so finding it tells where the read went.
+			_, err = s.Get(ctx, post.ID, nil)
+			if got := err == nil; got != tt.fromPrimary {
+				t.Errorf("Get() read from primary = %v, want %v (error %v)", got, tt.fromPrimary, err)
+			}
+			if got := s.Status()[0].InRotation; got != tt.inRotation {
+				t.Errorf("InRotation = %v, want %v", got, tt.inRotation)
+			}
+		})
+	}
+}
+
+func TestReplicatedRoundRobin(t *testing.T) {
+	ctx := context.Background()
+	primary := store.NewMemory()
+	var replicas []store.ReplicaStore
+	for _, slug := range []string{"first", "second", "third"} {
+		replica := store.NewMemory()
+		if _, err := replica.Create(ctx, models.Post{ID: uuid.New(), Slug: slug}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		replicas = append(replicas, &fakeReplica{PostStore: replica})
+	}
+	replicas[1].(*fakeReplica).lag = time.Minute
+
+	s := store.NewReplicated(primary, replicas, time.Second)
+	s.Check(ctx)
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		posts, err := s.List(ctx, nil)
+		if err != nil || len(posts) != 1 {
+			t.Fatalf("List() = %v, %v; want one post", posts, err)
+		}
+		seen[posts[0].Slug]++
+	}
+	if seen["first"] != 3 || seen["third"] != 3 || seen["second"] != 0 {
+		t.Errorf("reads per replica = %v, want 3 each from first and third", seen)
+	}
+}
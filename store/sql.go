@@ -0,0 +1,110 @@
+package store
+
+import (
+	"blogklert/models"
+	"blogklert/queue"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Helpers shared by the SQL stores.
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	queue.Execer
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn in a transaction of db, committed when fn succeeds.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction: %v", err)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// inSavepoint runs fn under the savepoint numbered depth of tx, rolled back
+// to when fn fails.
+func inSavepoint(ctx context.Context, tx *sql.Tx, depth int, fn func() error) error {
+	savepoint := "store_" + strconv.Itoa(depth)
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("error creating savepoint: %w", err)
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("error rolling back savepoint: %w", rollbackErr))
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("error releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+// queryPosts runs a statement selecting columns and scans every row.
+func queryPosts(ctx context.Context, q dbtx, columns []string, query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(scanTargets(&post, columns)...); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return posts, nil
+}
+
+// scanTargets returns pointers into post for each column, in order.
+func scanTargets(post *models.Post, columns []string) []interface{} {
+	targets := make([]interface{}, len(columns))
+	for i, name := range columns {
+		targets[i] = Field(post, name)
+	}
+	return targets
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// qualified returns every column prefixed with a table alias.
+func qualified(alias string) string {
+	columns := make([]string, len(Columns))
+	for i, name := range Columns {
+		columns[i] = alias + "." + name
+	}
+	return strings.Join(columns, ",")
+}
+
+func notFound(id uuid.UUID) error {
+	return fmt.Errorf("post %s: %w", id, ErrNotFound)
+}
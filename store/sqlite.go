@@ -0,0 +1,333 @@
+package store
+
+import (
+	"blogklert/models"
+	"blogklert/queue"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// sqliteTime is the layout of timestamps stored by SQLite. It has a fixed
+// width so that comparing the text orders posts by time.
+const sqliteTime = "2006-01-02 15:04:05.000000"
+
+// SQLite stores posts in the posts table of a SQLite database, searched
+// through the posts_fts full-text index. Timestamps are stored in UTC.
+type SQLite struct {
+	// Record, when set, is called with every write inside the transaction
+	// applying it, so it can record the change through q atomically.
+	Record func(ctx context.Context, q queue.Execer, change Change) error
+	// Clock stamps writes; nil reads the system clock.
+	Clock func() time.Time
+
+	db *sql.DB
+	// tx is the transaction the store runs in, or nil outside of WithTx.
+	tx *sql.Tx
+	// depth counts the savepoints nested in tx.
+	depth int
+}
+
+// NewSQLite returns a store reading and writing db.
+func NewSQLite(db *sql.DB, record func(ctx context.Context, q queue.Execer, change Change) error) *SQLite {
+	return &SQLite{db: db, Record: record}
+}
+
+func (s *SQLite) q() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// WithTx runs fn in a transaction, or under a savepoint when s is already in one.
+func (s *SQLite) WithTx(ctx context.Context, fn func(tx PostStore) error) error {
+	if s.tx != nil {
+		return inSavepoint(ctx, s.tx, s.depth+1, func() error {
+			return fn(&SQLite{Record: s.Record, Clock: s.Clock, db: s.db, tx: s.tx, depth: s.depth + 1})
+		})
+	}
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(&SQLite{Record: s.Record, Clock: s.Clock, db: s.db, tx: tx})
+	})
+}
+
+// atomically runs fn in the current transaction, or in a new one outside of
+// WithTx, so a write and its recorded change commit together.
+func (s *SQLite) atomically(ctx context.Context, fn func(s *SQLite) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	return s.WithTx(ctx, func(tx PostStore) error {
+		return fn(tx.(*SQLite))
+	})
+}
+
+// record passes change to Record, inside the current transaction.
+func (s *SQLite) record(ctx context.Context, change Change) error {
+	if s.Record == nil {
+		return nil
+	}
+	return s.Record(ctx, s.q(), change)
+}
+
+func (s *SQLite) List(ctx context.Context, columns []string) ([]models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return nil, err
+	}
+	return queryPosts(ctx, s.q(), columns, "SELECT "+strings.Join(columns, ",")+" FROM posts ORDER BY created_at DESC, id DESC")
+}
+
+func (s *SQLite) Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error) {
+	columns, err := selected(columns)
+	if err != nil {
+		return models.Post{}, err
+	}
+	var post models.Post
+	err = s.q().QueryRowContext(ctx, "SELECT "+strings.Join(columns, ",")+" FROM posts WHERE id = ?", id.String()).
+		Scan(scanTargets(&post, columns)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Post{}, notFound(id)
+	}
+	if err != nil {
+		return models.Post{}, fmt.Errorf("error querying database: %w", err)
+	}
+	return post, nil
+}
+
+func (s *SQLite) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	return queryPosts(ctx, s.q(), Columns, "SELECT "+strings.Join(Columns, ",")+" FROM posts WHERE id IN ("+placeholders(len(keys))+")", keys...)
+}
+
+func (s *SQLite) GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error) {
+	if len(slugs) == 0 {
+		return nil, nil
+	}
+	keys := make([]interface{}, len(slugs))
+	for i, slug := range slugs {
+		keys[i] = slug
+	}
+	return queryPosts(ctx, s.q(), Columns, "SELECT "+strings.Join(Columns, ",")+" FROM posts WHERE slug IN ("+placeholders(len(keys))+")", keys...)
+}
+
+func (s *SQLite) Page(ctx context.Context, query PageQuery) ([]models.Post, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if query.After != nil {
+		conditions = append(conditions, "(created_at, id) < (?, ?)")
+		args = append(args, query.After.CreatedAt.UTC().Format(sqliteTime), query.After.ID.String())
+	}
+	if query.Search != "" {
+		// The trigram index only finds substrings of three or more characters.
+		if utf8.RuneCountInString(query.Search) >= 3 {
+			conditions = append(conditions, "rowid IN (SELECT rowid FROM posts_fts WHERE posts_fts MATCH ?)")
+			args = append(args, `"`+strings.ReplaceAll(query.Search, `"`, `""`)+`"`)
+		} else {
+			conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR excerpt LIKE ? ESCAPE '\' OR body LIKE ? ESCAPE '\')`)
+			pattern := "%" + escapeLike(query.Search) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, query.CreatedAfter.UTC().Format(sqliteTime))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.CreatedBefore.UTC().Format(sqliteTime))
+	}
+
+	statement := "SELECT " + strings.Join(Columns, ",") + " FROM posts"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, query.Limit)
+	return queryPosts(ctx, s.q(), Columns, statement, args...)
+}
+
+func (s *SQLite) Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error) {
+	posts := make(map[uuid.UUID]models.Post, len(ids))
+	if len(ids) == 0 {
+		return posts, nil
+	}
+	op, order := ">", "ASC"
+	if older {
+		op, order = "<", "DESC"
+	}
+	query := "SELECT c.id," + qualified("a") +
+		" FROM posts c" +
+		" JOIN posts a ON a.id = (SELECT p.id FROM posts p" +
+		" WHERE (p.created_at, p.id) " + op + " (c.created_at, c.id)" +
+		" ORDER BY p.created_at " + order + ", p.id " + order + " LIMIT 1)" +
+		" WHERE c.id IN (" + placeholders(len(ids)) + ")"
+
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	rows, err := s.q().QueryContext(ctx, query, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key  uuid.UUID
+			post models.Post
+		)
+		if err := rows.Scan(append([]interface{}{&key}, scanTargets(&post, Columns)...)...); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		posts[key] = post
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return posts, nil
+}
+
+func (s *SQLite) Version(ctx context.Context, id uuid.UUID) (int, error) {
+	var version int
+	err := s.q().QueryRowContext(ctx, "SELECT version FROM posts WHERE id = ?", id.String()).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, notFound(id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying database: %w", err)
+	}
+	return version, nil
+}
+
+func (s *SQLite) Create(ctx context.Context, post models.Post) (models.Post, error) {
+	post.CreatedAt = timestamp(s.Clock)
+	post.UpdatedAt = post.CreatedAt
+	post.Version = 1
+	err := s.atomically(ctx, func(s *SQLite) error {
+		_, err := s.tx.ExecContext(ctx, "INSERT INTO posts (id, slug, title, excerpt, body, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			post.ID.String(), post.Slug, post.Title, post.Excerpt, post.Body,
+			post.CreatedAt.Format(sqliteTime), post.UpdatedAt.Format(sqliteTime), post.Version)
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, Change{Type: Created, PostID: post.ID, Version: post.Version})
+	})
+	if err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+func (s *SQLite) Update(ctx context.Context, post models.Post, expected *int) (int, error) {
+	return s.Patch(ctx, post.ID, map[string]string{"title": post.Title, "excerpt": post.Excerpt, "body": post.Body}, expected)
+}
+
+func (s *SQLite) Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (int, error) {
+	var (
+		sets []string
+		args []interface{}
+	)
+	for _, column := range Patchable {
+		value, ok := changes[column]
+		if !ok {
+			continue
+		}
+		args = append(args, value)
+		sets = append(sets, column+" = ?")
+	}
+	for column := range changes {
+		if !isPatchable(column) {
+			return 0, fmt.Errorf("post column %q cannot be changed", column)
+		}
+	}
+
+	if len(sets) == 0 {
+		version, err := s.Version(ctx, id)
+		if err == nil && expected != nil && version != *expected {
+			return 0, ErrVersionMismatch
+		}
+		return version, err
+	}
+
+	args = append(args, timestamp(s.Clock).Format(sqliteTime), id.String())
+	query := "UPDATE posts SET " + strings.Join(sets, ", ") + ", updated_at = ?, version = version + 1 WHERE id = ?"
+	if expected != nil {
+		args = append(args, *expected)
+		query += " AND version = ?"
+	}
+
+	var version int
+	err := s.atomically(ctx, func(s *SQLite) error {
+		err := s.tx.QueryRowContext(ctx, query+" RETURNING version", args...).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.writeConflict(ctx, id)
+		}
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, Change{Type: Updated, PostID: id, Version: version})
+	})
+	return version, err
+}
+
+func (s *SQLite) Delete(ctx context.Context, id uuid.UUID, expected *int) error {
+	query := "DELETE FROM posts WHERE id = ?"
+	args := []interface{}{id.String()}
+	if expected != nil {
+		query += " AND version = ?"
+		args = append(args, *expected)
+	}
+
+	return s.atomically(ctx, func(s *SQLite) error {
+		result, err := s.tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			if expected == nil {
+				// Deleting a missing post succeeds without a change to record.
+				return nil
+			}
+			return s.writeConflict(ctx, id)
+		}
+		return s.record(ctx, Change{Type: Deleted, PostID: id})
+	})
+}
+
+// writeConflict explains why a conditional write matched no rows.
+func (s *SQLite) writeConflict(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	if err := s.q().QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", id.String()).Scan(&exists); err != nil {
+		return fmt.Errorf("error querying database: %w", err)
+	}
+	if !exists {
+		return notFound(id)
+	}
+	return ErrVersionMismatch
+}
+
+// placeholders returns n comma-separated ? parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,28 @@
+package store_test
+
+import (
+	"blogklert/db"
+	"blogklert/store"
+	"blogklert/store/storetest"
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// TestSQLite runs the conformance suite against a migrated in-memory
+// database per test.
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.PostStore {
+		conn, err := sql.Open(db.SQLite, ":memory:")
+		if err != nil {
+			t.Fatalf("sql.Open() error = %v", err)
+		}
+		// Every connection would open its own in-memory database.
+		conn.SetMaxOpenConns(1)
+		t.Cleanup(func() { conn.Close() })
+		if _, err := db.Migrate(context.Background(), conn, db.SQLite); err != nil {
+			t.Fatalf("db.Migrate() error = %v", err)
+		}
+		return store.NewSQLite(conn, nil)
+	})
+}
@@ -0,0 +1,156 @@
+// Package store persists posts. PostStore is implemented by Postgres for
+// production, by SQLite for single-node deployments and by Memory for tests
+// and experiments; all must pass the conformance suite in package storetest.
+package store
+
+import (
+	"blogklert/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned when a post does not exist.
+	ErrNotFound = errors.New("post not found")
+	// ErrVersionMismatch is returned when a conditional write targets a stale
+	// version of a post.
+	ErrVersionMismatch = errors.New("post version does not match")
+)
+
+// Change types, recorded with each write.
+const (
+	Created = "post.created"
+	Updated = "post.updated"
+	Deleted = "post.deleted"
+)
+
+// Change describes a committed write to a post.
+type Change struct {
+	Type    string
+	PostID  uuid.UUID
+	Version int
+}
+
+// Columns lists every post column in order.
+var Columns = []string{"id", "slug", "title", "excerpt", "body", "created_at", "updated_at", "version"}
+
+// Patchable lists the columns Patch may change, in column order.
+var Patchable = []string{"title", "excerpt", "body"}
+
+// PageQuery selects one page of posts, newest first.
+type PageQuery struct {
+	// Limit is the maximum number of posts returned.
+	Limit int
+	// After continues the listing after this post.
+	After *Cursor
+	// Search keeps posts whose title, excerpt or body contains this text,
+	// ignoring case.
+	Search        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// Cursor is the position of a post in the newest-first order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// PostStore reads and writes posts. Reads taking columns only populate those
+// columns; the others return every column. Conditional writes take the
+// version the post must still have, or nil.
+type PostStore interface {
+	// List returns every post.
+	List(ctx context.Context, columns []string) ([]models.Post, error)
+	// Get returns a post, or ErrNotFound.
+	Get(ctx context.Context, id uuid.UUID, columns []string) (models.Post, error)
+	// GetByIDs returns the posts that exist among ids, in no particular order.
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Post, error)
+	// GetBySlugs returns the posts that exist among slugs, in no particular order.
+	GetBySlugs(ctx context.Context, slugs []string) ([]models.Post, error)
+	// Page returns the posts matching query, newest first.
+	Page(ctx context.Context, query PageQuery) ([]models.Post, error)
+	// Adjacent returns, for each of ids, the closest older post when older is
+	// set or the closest newer one otherwise. Posts without one are left out.
+	Adjacent(ctx context.Context, ids []uuid.UUID, older bool) (map[uuid.UUID]models.Post, error)
+	// Version returns the current version of a post, or ErrNotFound.
+	Version(ctx context.Context, id uuid.UUID) (int, error)
+
+	// Create stores a new post with the ID and slug set by the caller and
+	// returns it with its timestamps and version set.
+	Create(ctx context.Context, post models.Post) (models.Post, error)
+	// Update replaces the title, excerpt and body of post.ID and returns its
+	// new version.
+	Update(ctx context.Context, post models.Post, expected *int) (int, error)
+	// Patch sets the Patchable columns in changes and returns the post's
+	// version, which is unchanged when changes is empty.
+	Patch(ctx context.Context, id uuid.UUID, changes map[string]string, expected *int) (int, error)
+	// Delete removes a post. Deleting a missing post unconditionally succeeds.
+	Delete(ctx context.Context, id uuid.UUID, expected *int) error
+
+	// WithTx runs fn against a view of the store whose writes commit together
+	// when fn returns nil and are discarded otherwise. Nested calls roll back
+	// on their own, like savepoints.
+	WithTx(ctx context.Context, fn func(tx PostStore) error) error
+}
+
+// Field returns a pointer to the post field stored in column, or nil.
+func Field(post *models.Post, column string) interface{} {
+	switch column {
+	case "id":
+		return &post.ID
+	case "slug":
+		return &post.Slug
+	case "title":
+		return &post.Title
+	case "excerpt":
+		return &post.Excerpt
+	case "body":
+		return &post.Body
+	case "created_at":
+		return &post.CreatedAt
+	case "updated_at":
+		return &post.UpdatedAt
+	case "version":
+		return &post.Version
+	}
+	return nil
+}
+
+// selected returns the columns a read populates: columns, or every column
+// when it is empty. Unknown columns are rejected.
+func selected(columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		return Columns, nil
+	}
+	for _, column := range columns {
+		if Field(&models.Post{}, column) == nil {
+			return nil, fmt.Errorf("unknown post column %q", column)
+		}
+	}
+	return columns, nil
+}
+
+// isPatchable reports whether Patch may change column.
+func isPatchable(column string) bool {
+	for _, name := range Patchable {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// timestamp returns the time read from clock, or the system clock when nil,
+// at the precision Postgres stores so a created post compares equal to the
+// one read back.
+func timestamp(clock func() time.Time) time.Time {
+	if clock == nil {
+		clock = time.Now
+	}
+	return clock().UTC().Truncate(time.Microsecond)
+}
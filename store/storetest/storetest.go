@@ -0,0 +1,388 @@
+// Package storetest is a conformance suite for store.PostStore
+// implementations.
+package storetest
+
+import (
+	"blogklert/models"
+	"blogklert/store"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Run runs the conformance suite. newStore must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) store.PostStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.PostStore)
+	}{
+		{"Create and Get", testCreateGet},
+		{"Get projects columns", testGetColumns},
+		{"Get missing", testGetMissing},
+		{"List", testList},
+		{"GetByIDs and GetBySlugs", testGetMany},
+		{"Page", testPage},
+		{"Adjacent", testAdjacent},
+		{"Update", testUpdate},
+		{"Patch", testPatch},
+		{"Delete", testDelete},
+		{"WithTx", testWithTx},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+// create stores a post titled title. Posts are created at least a millisecond
+// apart so their order is deterministic.
+func create(t *testing.T, s store.PostStore, title string) models.Post {
+	t.Helper()
+	id := uuid.New()
+	post, err := s.Create(ctx, models.Post{ID: id, Slug: title + "-" + id.String()[:8], Title: title, Excerpt: title + " excerpt", Body: title + " body"})
+	if err != nil {
+		t.Fatalf("Create(%q) error = %v", title, err)
+	}
+	time.Sleep(time.Millisecond)
+	return post
+}
+
+func get(t *testing.T, s store.PostStore, id uuid.UUID) models.Post {
+	t.Helper()
+	post, err := s.Get(ctx, id, nil)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", id, err)
+	}
+	return post
+}
+
+// samePost reports whether two posts are equal, comparing times as instants.
+func samePost(a, b models.Post) bool {
+	return a.ID == b.ID && a.Slug == b.Slug && a.Title == b.Title && a.Excerpt == b.Excerpt && a.Body == b.Body &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.UpdatedAt.Equal(b.UpdatedAt) && a.Version == b.Version
+}
+
+func titles(posts []models.Post) []string {
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func sortedTitles(posts []models.Post) []string {
+	titles := titles(posts)
+	sort.Strings(titles)
+	return titles
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func testCreateGet(t *testing.T, s store.PostStore) {
+	created := create(t, s, "first")
+	if created.Version != 1 {
+		t.Errorf("created version = %d, want 1", created.Version)
+	}
+	if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("created timestamps = %v, %v, want equal and set", created.CreatedAt, created.UpdatedAt)
+	}
+	if got := get(t, s, created.ID); !samePost(got, created) {
+		t.Errorf("Get() = %+v, want %+v", got, created)
+	}
+	if version, err := s.Version(ctx, created.ID); err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v, want 1", version, err)
+	}
+	if _, err := s.Create(ctx, created); err == nil {
+		t.Error("Create() with an existing id succeeded")
+	}
+}
+
+func testGetColumns(t *testing.T, s store.PostStore) {
+	created := create(t, s, "first")
+	got, err := s.Get(ctx, created.ID, []string{"id", "title", "version"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	want := models.Post{ID: created.ID, Title: created.Title, Version: created.Version}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+	if _, err := s.Get(ctx, created.ID, []string{"id", "password"}); err == nil {
+		t.Error("Get() with an unknown column succeeded")
+	}
+}
+
+func testGetMissing(t *testing.T, s store.PostStore) {
+	if _, err := s.Get(ctx, uuid.New(), nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Version(ctx, uuid.New()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Version() error = %v, want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, s store.PostStore) {
+	posts, err := s.List(ctx, nil)
+	if err != nil || len(posts) != 0 {
+		t.Fatalf("List() on an empty store = %v, %v", posts, err)
+	}
+
+	create(t, s, "first")
+	create(t, s, "second")
+	create(t, s, "third")
+	posts, err = s.List(ctx, []string{"id", "title"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got, want := titles(posts), []string{"third", "second", "first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() titles = %v, want %v", got, want)
+	}
+	for _, post := range posts {
+		if post.Body != "" || post.Version != 0 {
+			t.Errorf("List() populated unselected columns: %+v", post)
+		}
+	}
+}
+
+func testGetMany(t *testing.T, s store.PostStore) {
+	first := create(t, s, "first")
+	second := create(t, s, "second")
+	create(t, s, "third")
+
+	posts, err := s.GetByIDs(ctx, []uuid.UUID{first.ID, second.ID, uuid.New()})
+	if err != nil {
+		t.Fatalf("GetByIDs() error = %v", err)
+	}
+	if got, want := sortedTitles(posts), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetByIDs() titles = %v, want %v", got, want)
+	}
+
+	posts, err = s.GetBySlugs(ctx, []string{second.Slug, "missing"})
+	if err != nil {
+		t.Fatalf("GetBySlugs() error = %v", err)
+	}
+	if len(posts) != 1 || !samePost(posts[0], second) {
+		t.Errorf("GetBySlugs() = %+v, want [%+v]", posts, second)
+	}
+}
+
+func testPage(t *testing.T, s store.PostStore) {
+	first := create(t, s, "first")
+	second := create(t, s, "second")
+	third := create(t, s, "third")
+	percent := create(t, s, "100% done")
+
+	tests := []struct {
+		name  string
+		query store.PageQuery
+		want  []string
+	}{
+		{name: "Limit", query: store.PageQuery{Limit: 2}, want: []string{"100% done", "third"}},
+		{name: "After", query: store.PageQuery{Limit: 2, After: &store.Cursor{CreatedAt: third.CreatedAt, ID: third.ID}}, want: []string{"second", "first"}},
+		{name: "Search ignores case", query: store.PageQuery{Limit: 10, Search: "SECOND"}, want: []string{"second"}},
+		{name: "Search in body", query: store.PageQuery{Limit: 10, Search: "first body"}, want: []string{"first"}},
+		{name: "Search is literal", query: store.PageQuery{Limit: 10, Search: "0%"}, want: []string{"100% done"}},
+		{name: "Created after", query: store.PageQuery{Limit: 10, CreatedAfter: &second.CreatedAt}, want: []string{"100% done", "third"}},
+		{name: "Created before", query: store.PageQuery{Limit: 10, CreatedBefore: &second.CreatedAt}, want: []string{"first"}},
+		{name: "Past the end", query: store.PageQuery{Limit: 10, After: &store.Cursor{CreatedAt: first.CreatedAt, ID: first.ID}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := s.Page(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Page() error = %v", err)
+			}
+			if got := titles(posts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Page() titles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	posts, err := s.Page(ctx, store.PageQuery{Limit: 1})
+	if err != nil || len(posts) != 1 || !samePost(posts[0], percent) {
+		t.Errorf("Page() = %+v, %v, want every column of %+v", posts, err, percent)
+	}
+}
+
+func testAdjacent(t *testing.T, s store.PostStore) {
+	first := create(t, s, "first")
+	second := create(t, s, "second")
+	third := create(t, s, "third")
+	ids := []uuid.UUID{first.ID, second.ID, third.ID, uuid.New()}
+
+	older, err := s.Adjacent(ctx, ids, true)
+	if err != nil {
+		t.Fatalf("Adjacent(older) error = %v", err)
+	}
+	if len(older) != 2 || older[second.ID].Title != "first" || older[third.ID].Title != "second" {
+		t.Errorf("Adjacent(older) = %+v, want second→first and third→second", older)
+	}
+
+	newer, err := s.Adjacent(ctx, ids, false)
+	if err != nil {
+		t.Fatalf("Adjacent(newer) error = %v", err)
+	}
+	if len(newer) != 2 || newer[first.ID].Title != "second" || !samePost(newer[second.ID], third) {
+		t.Errorf("Adjacent(newer) = %+v, want first→second and second→third", newer)
+	}
+}
+
+func testUpdate(t *testing.T, s store.PostStore) {
+	created := create(t, s, "first")
+
+	update := models.Post{ID: created.ID, Slug: "ignored", Title: "updated", Excerpt: "new excerpt", Body: "new body"}
+	version, err := s.Update(ctx, update, nil)
+	if err != nil || version != 2 {
+		t.Fatalf("Update() = %d, %v, want 2", version, err)
+	}
+	got := get(t, s, created.ID)
+	if got.Title != "updated" || got.Excerpt != "new excerpt" || got.Body != "new body" || got.Slug != created.Slug || got.Version != 2 {
+		t.Errorf("updated post = %+v", got)
+	}
+	if !got.CreatedAt.Equal(created.CreatedAt) || got.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("updated timestamps = %v, %v, created %v", got.CreatedAt, got.UpdatedAt, created.CreatedAt)
+	}
+
+	tests := []struct {
+		name     string
+		id       uuid.UUID
+		expected *int
+		want     error
+		version  int
+	}{
+		{name: "Matching version", id: created.ID, expected: intPtr(2), version: 3},
+		{name: "Stale version", id: created.ID, expected: intPtr(2), want: store.ErrVersionMismatch},
+		{name: "Missing post", id: uuid.New(), want: store.ErrNotFound},
+		{name: "Missing post with version", id: uuid.New(), expected: intPtr(1), want: store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update.ID = tt.id
+			version, err := s.Update(ctx, update, tt.expected)
+			if !errors.Is(err, tt.want) || version != tt.version {
+				t.Errorf("Update() = %d, %v, want %d, %v", version, err, tt.version, tt.want)
+			}
+		})
+	}
+}
+
+func testPatch(t *testing.T, s store.PostStore) {
+	created := create(t, s, "first")
+
+	tests := []struct {
+		name     string
+		id       uuid.UUID
+		changes  map[string]string
+		expected *int
+		want     error
+		version  int
+	}{
+		{name: "One column", id: created.ID, changes: map[string]string{"title": "patched"}, version: 2},
+		{name: "Conditional", id: created.ID, changes: map[string]string{"body": "patched body"}, expected: intPtr(2), version: 3},
+		{name: "Stale version", id: created.ID, changes: map[string]string{"body": "lost"}, expected: intPtr(2), want: store.ErrVersionMismatch},
+		{name: "No changes", id: created.ID, changes: map[string]string{}, version: 3},
+		{name: "No changes with stale version", id: created.ID, changes: map[string]string{}, expected: intPtr(1), want: store.ErrVersionMismatch},
+		{name: "No changes to a missing post", id: uuid.New(), changes: map[string]string{}, want: store.ErrNotFound},
+		{name: "Missing post", id: uuid.New(), changes: map[string]string{"title": "patched"}, want: store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := s.Patch(ctx, tt.id, tt.changes, tt.expected)
+			if !errors.Is(err, tt.want) || version != tt.version {
+				t.Errorf("Patch() = %d, %v, want %d, %v", version, err, tt.version, tt.want)
+			}
+		})
+	}
+
+	got := get(t, s, created.ID)
+	if got.Title != "patched" || got.Body != "patched body" || got.Excerpt != created.Excerpt || got.Version != 3 {
+		t.Errorf("patched post = %+v", got)
+	}
+	if _, err := s.Patch(ctx, created.ID, map[string]string{"slug": "taken"}, nil); err == nil {
+		t.Error("Patch() of the slug succeeded")
+	}
+}
+
+func testDelete(t *testing.T, s store.PostStore) {
+	created := create(t, s, "first")
+
+	tests := []struct {
+		name     string
+		id       uuid.UUID
+		expected *int
+		want     error
+	}{
+		{name: "Stale version", id: created.ID, expected: intPtr(2), want: store.ErrVersionMismatch},
+		{name: "Matching version", id: created.ID, expected: intPtr(1)},
+		{name: "Missing post", id: created.ID},
+		{name: "Missing post with version", id: created.ID, expected: intPtr(1), want: store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Delete(ctx, tt.id, tt.expected); !errors.Is(err, tt.want) {
+				t.Errorf("Delete() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.Get(ctx, created.ID, nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func testWithTx(t *testing.T, s store.PostStore) {
+	errRollback := errors.New("rollback")
+	kept := create(t, s, "kept")
+
+	err := s.WithTx(ctx, func(tx store.PostStore) error {
+		create(t, tx, "discarded")
+		if _, err := tx.Patch(ctx, kept.ID, map[string]string{"title": "discarded"}, nil); err != nil {
+			return err
+		}
+		if got := get(t, tx, kept.ID); got.Title != "discarded" {
+			t.Errorf("Get() in the transaction = %+v, want its own write", got)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx() error = %v, want %v", err, errRollback)
+	}
+	posts, err := s.List(ctx, nil)
+	if err != nil || len(posts) != 1 || !samePost(posts[0], kept) {
+		t.Fatalf("List() after a rollback = %+v, %v, want only %+v", posts, err, kept)
+	}
+
+	err = s.WithTx(ctx, func(tx store.PostStore) error {
+		create(t, tx, "committed")
+		nestedErr := tx.WithTx(ctx, func(nested store.PostStore) error {
+			create(t, nested, "nested")
+			return errRollback
+		})
+		if !errors.Is(nestedErr, errRollback) {
+			t.Errorf("nested WithTx() error = %v, want %v", nestedErr, errRollback)
+		}
+		return tx.WithTx(ctx, func(nested store.PostStore) error {
+			return nested.Delete(ctx, kept.ID, intPtr(1))
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	posts, err = s.List(ctx, nil)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got, want := titles(posts), []string{"committed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() titles after a commit = %v, want %v", got, want)
+	}
+}
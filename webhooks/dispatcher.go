@@ -0,0 +1,215 @@
+package webhooks
+
+import (
+	"blogklert/queue"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Enqueue queues payload for every active webhook subscribed to eventType. A
+// webhook without an event filter receives every event.
+func Enqueue(ctx context.Context, q queue.Execer, eventType string, payload []byte) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT id, $1, $2 FROM webhooks WHERE active AND (cardinality(events) = 0 OR $1 = ANY(events))`,
+		eventType, string(payload))
+	if err != nil {
+		return fmt.Errorf("error enqueueing %s webhooks: %w", eventType, err)
+	}
+	return nil
+}
+
+// Dispatcher delivers queued webhooks. Several dispatchers may share a
+// database, as described in package queue.
+type Dispatcher struct {
+	DB     *sql.DB
+	Client *http.Client
+	// PollInterval is how often the queue is checked for due deliveries.
+	PollInterval time.Duration
+	// BatchSize is how many deliveries are claimed per poll.
+	BatchSize int
+	// MaxAttempts marks a delivery failed after this many unsuccessful attempts.
+	MaxAttempts int
+	// Lease is how long a claimed delivery is hidden from other dispatchers.
+	// Deliveries are sent one at a time, so it is raised when shorter than a
+	// batch sent at Client.Timeout each.
+	Lease time.Duration
+	// AllowPrivateTargets lets deliveries connect to loopback and private
+	// addresses, which the client built by NewDispatcher refuses.
+	AllowPrivateTargets bool
+}
+
+// leaseMargin covers the bookkeeping around the sends of a batch.
+const leaseMargin = 30 * time.Second
+
+// NewDispatcher returns a Dispatcher reading the queue from db.
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	d := &Dispatcher{
+		DB:           db,
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+		MaxAttempts:  10,
+	}
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			if d.AllowPrivateTargets {
+				return nil
+			}
+			return checkDial(network, address, conn)
+		},
+	}
+	// Connect directly: through a proxy the check would see the proxy's address
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	d.Client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	d.Lease = d.lease()
+	return d
+}
+
+// Run delivers due webhooks until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	queue.Poll(ctx, d.PollInterval, d.BatchSize, "delivering webhooks", d.deliverDue, nil)
+}
+
+type delivery struct {
+	id        uuid.UUID
+	eventType string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+// deliverDue claims and attempts one batch of due deliveries, returning how many were claimed.
+func (d *Dispatcher) deliverDue(ctx context.Context) (int, error) {
+	batch, err := queue.Claim(ctx, d.DB, `WITH due AS (
+			SELECT wd.id FROM webhook_deliveries wd
+			JOIN webhooks w ON w.id = wd.webhook_id
+			WHERE wd.status = 'pending' AND wd.next_attempt_at <= CURRENT_TIMESTAMP AND w.active
+			ORDER BY wd.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF wd SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries wd SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			FROM due WHERE wd.id = due.id
+			RETURNING wd.id, wd.webhook_id, wd.event_type, wd.payload, wd.attempts
+		)
+		SELECT c.id, c.event_type, c.payload, c.attempts, w.url, w.secret
+		FROM claimed c JOIN webhooks w ON w.id = c.webhook_id`,
+		func(rows *sql.Rows, item *delivery) error {
+			return rows.Scan(&item.id, &item.eventType, &item.payload, &item.attempts, &item.url, &item.secret)
+		},
+		d.BatchSize, d.lease().Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error claiming deliveries: %w", err)
+	}
+
+	for _, item := range batch {
+		if err := d.attempt(ctx, item); err != nil {
+			return len(batch), err
+		}
+	}
+	return len(batch), nil
+}
+
+// lease returns Lease, raised if need be to cover sending a whole batch so no
+// delivery is claimed again while it waits its turn. Without a client timeout
+// there is no bound to cover.
+func (d *Dispatcher) lease() time.Duration {
+	if d.Client == nil || d.Client.Timeout <= 0 {
+		return d.Lease
+	}
+	if minimum := time.Duration(d.BatchSize)*d.Client.Timeout + leaseMargin; d.Lease < minimum {
+		return minimum
+	}
+	return d.Lease
+}
+
+// attempt sends one delivery and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, item delivery) error {
+	start := time.Now()
+	statusCode, sendErr := d.send(ctx, item)
+	duration := time.Since(start)
+	if ctx.Err() != nil {
+		// Shutting down: leave the lease to expire so the delivery is retried.
+		return ctx.Err()
+	}
+
+	var code sql.NullInt64
+	if statusCode > 0 {
+		code = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	}
+	var message sql.NullString
+	if sendErr != nil {
+		message = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	if _, err := d.DB.ExecContext(ctx,
+		"INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)",
+		item.id, code, message, duration.Milliseconds()); err != nil {
+		return fmt.Errorf("error recording attempt for delivery %s: %w", item.id, err)
+	}
+
+	attempts := item.attempts + 1
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = d.DB.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET status = $1, attempts = $2, delivered_at = CURRENT_TIMESTAMP WHERE id = $3",
+			StatusSucceeded, attempts, item.id)
+	case attempts >= d.MaxAttempts:
+		_, err = d.DB.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET status = $1, attempts = $2 WHERE id = $3",
+			StatusFailed, attempts, item.id)
+	default:
+		_, err = d.DB.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET attempts = $1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2) WHERE id = $3",
+			attempts, Backoff(attempts).Seconds(), item.id)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating delivery %s: %w", item.id, err)
+	}
+	return nil
+}
+
+// send posts the signed payload. Any non-2xx response is a failure.
+func (d *Dispatcher) send(ctx context.Context, item delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.url, bytes.NewReader(item.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blogklert-webhooks")
+	req.Header.Set(EventHeader, item.eventType)
+	req.Header.Set(DeliveryHeader, item.id.String())
+	req.Header.Set(SignatureHeader, Sign(item.secret, time.Now(), item.payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,185 @@
+package webhooks
+
+import (
+	"blogklert/db"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLease(t *testing.T) {
+	tests := []struct {
+		name      string
+		lease     time.Duration
+		batchSize int
+		timeout   time.Duration
+		want      time.Duration
+	}{
+		{name: "Covers a batch", lease: 10 * time.Minute, batchSize: 20, timeout: 10 * time.Second, want: 10 * time.Minute},
+		{name: "Raised to cover a batch", lease: 2 * time.Minute, batchSize: 20, timeout: 10 * time.Second, want: 200*time.Second + leaseMargin},
+		{name: "Small batch", lease: time.Minute, batchSize: 2, timeout: 10 * time.Second, want: time.Minute},
+		{name: "No client timeout", lease: time.Minute, batchSize: 20, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dispatcher{Client: &http.Client{Timeout: tt.timeout}, BatchSize: tt.batchSize, Lease: tt.lease}
+			if got := d.lease(); got != tt.want {
+				t.Errorf("lease() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	d := NewDispatcher(nil)
+	if minimum := time.Duration(d.BatchSize) * d.Client.Timeout; d.Lease <= minimum {
+		t.Errorf("NewDispatcher() Lease = %v, want more than %v", d.Lease, minimum)
+	}
+}
+
+func TestSend(t *testing.T) {
+	payload := []byte(`{"type":"post.created"}`)
+	item := delivery{id: uuid.New(), eventType: "post.created", payload: payload, secret: "secret"}
+
+	var received *http.Request
+	var body []byte
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	item.url = server.URL
+
+	t.Run("Private target refused", func(t *testing.T) {
+		received = nil
+		_, err := NewDispatcher(nil).send(context.Background(), item)
+		if !errors.Is(err, ErrPrivateTarget) {
+			t.Errorf("send() error = %v, want ErrPrivateTarget", err)
+		}
+		if received != nil {
+			t.Error("the private target received the delivery")
+		}
+	})
+
+	d := NewDispatcher(nil)
+	d.AllowPrivateTargets = true
+
+	t.Run("Signed delivery", func(t *testing.T) {
+		code, err := d.send(context.Background(), item)
+		if err != nil || code != http.StatusNoContent {
+			t.Fatalf("send() = %d, %v; want 204", code, err)
+		}
+		if received.Header.Get(EventHeader) != item.eventType || received.Header.Get(DeliveryHeader) != item.id.String() {
+			t.Errorf("headers = %v, want the event type and delivery ID", received.Header)
+		}
+		if err := Verify("secret", received.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	})
+
+	t.Run("Non-2xx response", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		code, err := d.send(context.Background(), item)
+		if err == nil || code != http.StatusServiceUnavailable {
+			t.Errorf("send() = %d, %v; want 503 with an error", code, err)
+		}
+	})
+}
+
+// TestDispatcher delivers from the queue in the database at TEST_DB_URL,
+// which it migrates and empties of webhooks. It is skipped when unset.
+func TestDispatcher(t *testing.T) {
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	ctx := context.Background()
+	conn, err := sql.Open(db.Postgres, url)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer conn.Close()
+	if _, err := db.Migrate(ctx, conn, db.Postgres); err != nil {
+		t.Fatalf("db.Migrate() error = %v", err)
+	}
+	if _, err := conn.Exec("TRUNCATE webhooks CASCADE"); err != nil {
+		t.Fatalf("error emptying webhooks: %v", err)
+	}
+
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	if _, err := conn.Exec("INSERT INTO webhooks (url, secret, events) VALUES ($1, 'secret', '{post.created}')", server.URL); err != nil {
+		t.Fatalf("error creating webhook: %v", err)
+	}
+
+	d := NewDispatcher(conn)
+	d.AllowPrivateTargets = true
+	d.MaxAttempts = 2
+
+	// deliver claims one batch and returns the state of the only delivery.
+	deliver := func(t *testing.T, wantClaimed int) (status string, attempts int, due bool) {
+		t.Helper()
+		n, err := d.deliverDue(ctx)
+		if err != nil || n != wantClaimed {
+			t.Fatalf("deliverDue() = %d, %v; want %d", n, err, wantClaimed)
+		}
+		err = conn.QueryRow("SELECT status, attempts, next_attempt_at <= CURRENT_TIMESTAMP FROM webhook_deliveries").
+			Scan(&status, &attempts, &due)
+		if err != nil {
+			t.Fatalf("error reading delivery: %v", err)
+		}
+		return status, attempts, due
+	}
+
+	if err := Enqueue(ctx, conn, "post.deleted", []byte(`{}`)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := Enqueue(ctx, conn, "post.created", []byte(`{"type":"post.created"}`)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		if got, attempts, _ := deliver(t, 1); got != StatusSucceeded || attempts != 1 {
+			t.Errorf("delivery = %s after %d attempts, want succeeded after 1", got, attempts)
+		}
+	})
+
+	t.Run("Failure is retried with backoff", func(t *testing.T) {
+		status.Store(http.StatusInternalServerError)
+		if _, err := conn.Exec("UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP", StatusPending); err != nil {
+			t.Fatalf("error requeueing delivery: %v", err)
+		}
+		if got, attempts, due := deliver(t, 1); got != StatusPending || attempts != 1 || due {
+			t.Errorf("delivery = %s after %d attempts (due %v), want pending after 1 and not due", got, attempts, due)
+		}
+		// Not due until the backoff has passed
+		deliver(t, 0)
+	})
+
+	t.Run("Failed after MaxAttempts", func(t *testing.T) {
+		if _, err := conn.Exec("UPDATE webhook_deliveries SET next_attempt_at = CURRENT_TIMESTAMP"); err != nil {
+			t.Fatalf("error rescheduling delivery: %v", err)
+		}
+		if got, attempts, _ := deliver(t, 1); got != StatusFailed || attempts != 2 {
+			t.Errorf("delivery = %s after %d attempts, want failed after 2", got, attempts)
+		}
+	})
+
+	var attempts int
+	if err := conn.QueryRow("SELECT count(*) FROM webhook_attempts").Scan(&attempts); err != nil || attempts != 3 {
+		t.Errorf("recorded attempts = %d, %v; want 3", attempts, err)
+	}
+}
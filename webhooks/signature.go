@@ -0,0 +1,90 @@
+// Package webhooks signs and delivers outbound webhook notifications from a
+// persistent Postgres queue, retrying failures with exponential backoff.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	SignatureHeader = "X-Blogklert-Signature"
+	EventHeader     = "X-Blogklert-Event"
+	DeliveryHeader  = "X-Blogklert-Delivery"
+)
+
+// Sign returns the signature header value for body: the Unix timestamp and the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret. Including the
+// timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header produced by Sign, rejecting signatures
+// older than tolerance.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("malformed signature header")
+	}
+	if tolerance > 0 && now.Sub(time.Unix(unix, 0)) > tolerance {
+		return errors.New("signature timestamp is too old")
+	}
+
+	expected := mac(secret, t, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Backoff returns the delay before retrying a delivery that has failed
+// attempts times: 30s doubling per attempt, capped at 6h.
+func Backoff(attempts int) time.Duration {
+	const (
+		base    = 30 * time.Second
+		maximum = 6 * time.Hour
+	)
+	if attempts < 1 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maximum {
+			return maximum
+		}
+	}
+	return delay
+}
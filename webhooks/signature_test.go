@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"post.created"}`)
+	valid := Sign("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "Valid signature", secret: "secret", header: valid, body: body, now: now},
+		{name: "Within tolerance", secret: "secret", header: valid, body: body, now: now.Add(4 * time.Minute)},
+		{name: "Tampered body", secret: "secret", header: valid, body: []byte(`{"type":"post.deleted"}`), now: now, wantErr: true},
+		{name: "Wrong secret", secret: "other", header: valid, body: body, now: now, wantErr: true},
+		{name: "Expired timestamp", secret: "secret", header: valid, body: body, now: now.Add(10 * time.Minute), wantErr: true},
+		{name: "Missing timestamp", secret: "secret", header: "v1=abcd", body: body, now: now, wantErr: true},
+		{name: "Missing signature", secret: "secret", header: "t=1700000000", body: body, now: now, wantErr: true},
+		{name: "Rotated secret", secret: "secret", header: valid + ",v1=00ff", body: body, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrPrivateTarget is returned for a webhook URL or connection that points at
+// a loopback, private, link-local or unspecified address. Such targets would
+// let webhook owners reach internal services and cloud metadata endpoints.
+var ErrPrivateTarget = errors.New("webhook target is a private or loopback address")
+
+// CheckHost rejects host when it names the local machine or is an IP literal
+// in a private range. Other names are checked when the dispatcher connects,
+// since they may resolve to a private address.
+func CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && privateIP(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
+
+// checkDial rejects a connection to a private address. It runs as the
+// net.Dialer Control, after the host name has been resolved.
+func checkDial(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || privateIP(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
+
+// privateIP reports whether ip is not publicly routable.
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
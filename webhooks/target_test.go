@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "example.com"},
+		{host: "hooks.example.com."},
+		{host: "93.184.216.34"},
+		{host: "2606:2800:220:1:248:1893:25c8:1946"},
+		{host: "localhost", wantErr: true},
+		{host: "LOCALHOST.", wantErr: true},
+		{host: "api.localhost", wantErr: true},
+		{host: "127.0.0.1", wantErr: true},
+		{host: "::1", wantErr: true},
+		{host: "0.0.0.0", wantErr: true},
+		{host: "10.1.2.3", wantErr: true},
+		{host: "172.16.0.1", wantErr: true},
+		{host: "192.168.1.1", wantErr: true},
+		{host: "169.254.169.254", wantErr: true},
+		{host: "fe80::1", wantErr: true},
+		{host: "fd00:ec2::254", wantErr: true},
+		{host: "::ffff:127.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := CheckHost(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrPrivateTarget) {
+				t.Errorf("CheckHost() error = %v, want ErrPrivateTarget", err)
+			}
+		})
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443"},
+		{address: "127.0.0.1:8080", wantErr: true},
+		{address: "[::1]:80", wantErr: true},
+		{address: "169.254.169.254:80", wantErr: true},
+		{address: "10.0.0.1:443", wantErr: true},
+		{address: "example.com:443", wantErr: true},
+		{address: "93.184.216.34", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if err := checkDial("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+				t.Errorf("checkDial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}